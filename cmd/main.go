@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -46,6 +49,11 @@ func main() {
 		}
 	}()
 
+	// ctx is cancelled on SIGTERM or SIGINT: from then on no new work is
+	// started, and what is under way gets ShutdownGraceSeconds to finish.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
 	sslmode := cfg.SSLMode
 	fmt.Printf("sslmode -> %s\n", sslmode)
 	if len(sslmode) > 0 {
@@ -78,14 +86,22 @@ func main() {
 	}
 
 	router := gin.Default()
+	// ClientIP keys the rate limits; only trust forwarding headers from
+	// the proxies we run behind.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.Fatal("invalid TRUSTED_PROXIES", zap.Error(err))
+	}
+	router.TrustedPlatform = cfg.TrustedPlatform
 	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
 
 	corsConfig := cors.Config{
 		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders: append(
-			[]string{"Content-Type", "Authorization"},
+			[]string{"Content-Type", "Authorization", middleware.RequestIDHeader, domains.IdempotencyKeyHeader},
 			domains.CartQuoteHeaders...,
 		),
+		ExposeHeaders: []string{middleware.RequestIDHeader, middleware.IdempotentReplayedHeader, "Retry-After"},
 	}
 	if cfg.Debug == "1" {
 		corsConfig.AllowAllOrigins = true
@@ -106,7 +122,7 @@ func main() {
 
 	r4Repository := r4bank.NewR4Repository(logger, cfg.R4EntryPoint, cfg.R4APIEcommerce, cfg.R4Secret)
 
-	bcvClient := bcv.NewClient(r4Repository, loc, logger)
+	bcvClient := bcv.NewClient(r4Repository, gormDB, loc, logger)
 	_, err = bcvClient.Get(context.Background())
 	if err != nil {
 		logger.Error("could not connect to BCV client", zap.Error(err))
@@ -122,48 +138,217 @@ func main() {
 	mailgunClient := mailgun.NewClient(cfg.MailgunAPIKey)
 	mailgunRepo := mailgun.NewRepository(mailgunClient, cfg.MailgunDomain, cfg.MailgunSender, cfg.SupportEmail, logger)
 
+	authenticator, err := middleware.NewAuthenticator(cfg.APIKeys, logger)
+	if err != nil {
+		logger.Fatal("invalid API_KEYS", zap.Error(err))
+	}
+	idempotency := middleware.NewIdempotency(
+		gormDB,
+		time.Duration(cfg.IdempotencyLockSeconds)*time.Second,
+		time.Duration(cfg.IdempotencyTTLHours)*time.Hour,
+		logger,
+	)
+
+	rateLimits, err := domains.ParseRateLimits(cfg.RateLimits)
+	if err != nil {
+		logger.Fatal("invalid RATE_LIMITS", zap.Error(err))
+	}
+	var rateLimitStore domains.RateLimitStore
+	switch cfg.RateLimitStore {
+	case "", "postgres":
+		rateLimitStore = middleware.NewPostgresRateLimitStore(gormDB, logger)
+	case "memory":
+		rateLimitStore = middleware.NewMemoryRateLimitStore()
+	default:
+		logger.Fatal("invalid RATE_LIMIT_STORE", zap.String("store", cfg.RateLimitStore))
+	}
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore, rateLimits, logger)
+
+	igtfRates, err := domains.ParseIGTFRates(cfg.IGTFRates)
+	if err != nil {
+		logger.Fatal("invalid IGTF_RATES", zap.Error(err))
+	}
+	recurrentRetryBackoff, err := domains.ParseRecurrentRetryBackoff(cfg.RecurrentRetryBackoffDays)
+	if err != nil {
+		logger.Fatal("invalid RECURRENT_RETRY_BACKOFF_DAYS", zap.Error(err))
+	}
+	recurrentRetryPolicy := domains.RecurrentRetryPolicy{
+		BackoffDays: recurrentRetryBackoff,
+		MaxAttempts: cfg.RecurrentRetryMaxAttempts,
+		MaxDays:     cfg.RecurrentRetryMaxDays,
+	}
+
 	// initialize services
-	storeService := services.NewStoreService(shopifyRepo, r4Repository, gormDB, bcvClient, cfg.RecurrentDirectDebitAppID, logger)
-	paymentService := services.NewPaymentService(gormDB, shopifyRepo, r4Repository, bcvClient, driveClient, mailgunRepo, loc, cfg.RecurrentDirectDebitAppID, logger)
-	cartPaymentService := services.NewCartPaymentService(shopifyRepo, r4Repository, bcvClient, gormDB, loc, mailgunRepo, logger)
+	auditService := services.NewAuditService(gormDB, loc, logger)
+	ledgerService := services.NewLedgerService(gormDB, shopifyRepo, bcvClient, logger)
+	otpStore := services.NewOTPStore(gormDB, domains.OTPLimits{
+		MaxAttempts:    cfg.OTPMaxAttempts,
+		ResendCooldown: time.Duration(cfg.OTPResendCooldownSeconds) * time.Second,
+		DailySends:     cfg.OTPDailySends,
+	}, cfg.OTPHashSecret, logger)
+	chargeLocker := services.NewChargeLocker(gormDB, time.Duration(cfg.ChargeLockTimeoutSeconds)*time.Second, logger)
+	affiliationService := services.NewAffiliationService(gormDB, shopifyRepo, auditService, logger)
+	storeService := services.NewStoreService(shopifyRepo, r4Repository, gormDB, bcvClient, auditService, igtfRates, cfg.RecurrentDirectDebitAppID, logger)
+	paymentService := services.NewPaymentService(gormDB, shopifyRepo, r4Repository, bcvClient, driveClient, mailgunRepo, loc, auditService, ledgerService, chargeLocker, otpStore, affiliationService, igtfRates, cfg.RecurrentDirectDebitAppID, logger)
+	cartPaymentService := services.NewCartPaymentService(shopifyRepo, r4Repository, bcvClient, gormDB, loc, mailgunRepo, auditService, ledgerService, chargeLocker, otpStore, affiliationService, logger)
+	manualOrderService := services.NewManualOrderService(gormDB, paymentService, shopifyRepo, r4Repository, bcvClient, mailgunRepo, auditService, ledgerService, loc, logger)
 
 	// initialize handlers
 	storeHandler := handlers.NewStoreHandler(storeService)
 	paymentHandler := handlers.NewPaymentHandler(paymentService, bcvClient)
 	cartPaymentHandler := handlers.NewCartPaymentHandler(cartPaymentService, bcvClient)
+	manualOrderHandler := handlers.NewManualOrderHandler(manualOrderService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	exportHandler := handlers.NewExportHandler(services.NewExportService(gormDB, loc, logger))
+	settlementService := services.NewSettlementService(gormDB, loc, logger)
+	settlementHandler := handlers.NewSettlementHandler(settlementService)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService)
+
+	// recurrent direct-debit retry, fed by webhook declines and run by cron
+	recurrentRetryService := services.NewRecurrentRetryService(gormDB, paymentService, storeService, shopifyRepo, mailgunRepo, auditService, recurrentRetryPolicy, loc, logger)
+
+	// subscriptions, charged on the recurring path by cron
+	subscriptionService := services.NewSubscriptionService(gormDB, paymentService, shopifyRepo, mailgunRepo, auditService, recurrentRetryPolicy, loc, logger)
 
 	// webhook
-	webhookService := services.NewWebhookService(paymentService, gormDB, logger)
-	webhookHandler := handlers.NewWebhookHandler(cfg.RecurrentDirectDebitAppID, webhookService, logger)
-	webhookRoutes := routes.NewWebhookRoutes(webhookHandler)
+	webhookService := services.NewWebhookService(paymentService, recurrentRetryService, logger)
+	webhookQueue := services.NewWebhookQueue(gormDB, webhookService, auditService, logger)
+	webhookWorkersDone := make(chan struct{})
+	go func() {
+		webhookQueue.Run(ctx)
+		close(webhookWorkersDone)
+	}()
+	webhookHandler := handlers.NewWebhookHandler(cfg.RecurrentDirectDebitAppID, webhookQueue, logger)
+	webhookRoutes := routes.NewWebhookRoutes(webhookHandler, authenticator)
 
-	// recurrent direct-debit retry cron
-	recurrentRetryService := services.NewRecurrentRetryService(gormDB, paymentService, storeService, loc, logger)
-	jobHandler := jobs.NewJobHandler(recurrentRetryService, logger)
+	reconciliationService := services.NewReconciliationService(gormDB, shopifyRepo, mailgunRepo, loc, logger)
+	orphanMobilePaymentService := services.NewOrphanMobilePaymentService(
+		gormDB, r4Repository, auditService, ledgerService,
+		cfg.OrphanMobilePaymentDays, cfg.OrphanRefundEnabled, cfg.OrphanRefundMaxPerRun,
+		logger,
+	)
+	orphanMobilePaymentHandler := handlers.NewOrphanMobilePaymentHandler(orphanMobilePaymentService)
+	cartChargeMonitorService := services.NewCartChargeMonitorService(
+		gormDB, r4Repository, mailgunRepo, auditService, ledgerService,
+		time.Duration(cfg.UnattachedCartAlertMinutes)*time.Minute,
+		cfg.UnattachedCartRefundEnabled,
+		time.Duration(cfg.UnattachedCartRefundHours)*time.Hour,
+		logger,
+	)
+	jobHandler := jobs.NewJobHandler(ctx, recurrentRetryService, reconciliationService, orphanMobilePaymentService, cartChargeMonitorService, settlementService, subscriptionService, idempotency, otpStore, rateLimiter, logger)
 
+	var c *cron.Cron
 	if cfg.Debug != "1" {
-		c := cron.New(cron.WithSeconds(), cron.WithLocation(loc))
+		c = cron.New(cron.WithSeconds(), cron.WithLocation(loc))
 		if _, err := c.AddFunc("0 30 9 * * *", jobHandler.HandleRetryPendingRecurrentCharges); err != nil {
 			logger.Fatal("failed to schedule recurrent retry job", zap.Error(err))
 		}
+		if _, err := c.AddFunc("0 0 9 * * *", jobHandler.HandleChargeSubscriptions); err != nil {
+			logger.Fatal("failed to schedule subscriptions job", zap.Error(err))
+		}
+		if _, err := c.AddFunc("0 0 6 * * *", jobHandler.HandleReconcile); err != nil {
+			logger.Fatal("failed to schedule reconciliation job", zap.Error(err))
+		}
+		if _, err := c.AddFunc("0 0 10 * * *", jobHandler.HandleRefundOrphanMobilePayments); err != nil {
+			logger.Fatal("failed to schedule orphan mobile payments job", zap.Error(err))
+		}
+		if _, err := c.AddFunc("0 */15 * * * *", jobHandler.HandleMonitorUnattachedCartCharges); err != nil {
+			logger.Fatal("failed to schedule unattached cart charges job", zap.Error(err))
+		}
+		if _, err := c.AddFunc("0 30 0 * * *", jobHandler.HandleSettlePreviousDay); err != nil {
+			logger.Fatal("failed to schedule daily settlement job", zap.Error(err))
+		}
+		if _, err := c.AddFunc("0 0 3 * * *", jobHandler.HandlePurgeIdempotencyKeys); err != nil {
+			logger.Fatal("failed to schedule idempotency keys purge job", zap.Error(err))
+		}
+		if _, err := c.AddFunc("0 */10 * * * *", jobHandler.HandlePurgeOTPCodes); err != nil {
+			logger.Fatal("failed to schedule OTP codes purge job", zap.Error(err))
+		}
+		if _, err := c.AddFunc("0 5-59/10 * * * *", jobHandler.HandlePurgeRateLimitCounters); err != nil {
+			logger.Fatal("failed to schedule rate limit counters purge job", zap.Error(err))
+		}
 		c.Start()
 	}
 
 	// initialize routes
-	storeRoutes := routes.NewStoreRoute(storeHandler)
-	paymentRoute := routes.NewPaymentRoute(paymentHandler)
+	storeRoutes := routes.NewStoreRoute(storeHandler, authenticator, rateLimiter)
+	paymentRoute := routes.NewPaymentRoute(paymentHandler, idempotency, rateLimiter)
 	cartPaymentRoutes := routes.NewCartPaymentRoutes(
 		cartPaymentHandler,
 		middleware.NewCartQuoteRepository(cfg.CartQuoteSecret, logger),
+		idempotency,
+		rateLimiter,
 	)
+	manualOrderRoutes := routes.NewManualOrderRoutes(manualOrderHandler, authenticator)
+	auditRoutes := routes.NewAuditRoutes(auditHandler, authenticator)
+	orphanMobilePaymentRoutes := routes.NewOrphanMobilePaymentRoutes(orphanMobilePaymentHandler, authenticator)
+	exportRoutes := routes.NewExportRoutes(exportHandler, settlementHandler, authenticator)
+	ledgerRoutes := routes.NewLedgerRoutes(ledgerHandler, authenticator)
+	recurrentRetryRoutes := routes.NewRecurrentRetryRoutes(handlers.NewRecurrentRetryHandler(recurrentRetryService), authenticator)
+	subscriptionRoutes := routes.NewSubscriptionRoutes(handlers.NewSubscriptionHandler(subscriptionService), authenticator)
+	affiliationRoutes := routes.NewAffiliationRoutes(handlers.NewAffiliationHandler(affiliationService), authenticator)
 
 	// set routes
 	storeRoutes.SetRouter(router)
 	paymentRoute.SetRouter(router)
 	cartPaymentRoutes.SetRouter(router)
+	manualOrderRoutes.SetRouter(router)
+	auditRoutes.SetRouter(router)
+	orphanMobilePaymentRoutes.SetRouter(router)
+	exportRoutes.SetRouter(router)
+	ledgerRoutes.SetRouter(router)
+	recurrentRetryRoutes.SetRouter(router)
+	subscriptionRoutes.SetRouter(router)
+	affiliationRoutes.SetRouter(router)
 	webhookRoutes.SetRouter(router, cfg.ShopifyHMACSecret)
 
-	if err := router.Run(":" + cfg.Port); err != nil {
-		log.Fatalf("failed to run server: %v", err)
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: router}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		logger.Error("failed to run server", zap.Error(err))
+		stop()
+	case <-ctx.Done():
+	}
+
+	// Stop taking requests and jobs first, then wait for what is under way:
+	// requests, cron jobs, webhook jobs, and débitos and rejection emails
+	// still running after their request answered.
+	grace := time.Duration(cfg.ShutdownGraceSeconds) * time.Second
+	logger.Info("shutting down", zap.Duration("grace", grace))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("http server: requests still running at the end of the grace period", zap.Error(err))
+	}
+	if c != nil {
+		if err := waitFor(shutdownCtx, c.Stop().Done()); err != nil {
+			logger.Error("cron: jobs still running at the end of the grace period", zap.Error(err))
+		}
+	}
+	if err := waitFor(shutdownCtx, webhookWorkersDone); err != nil {
+		logger.Error("webhook: jobs still running at the end of the grace period", zap.Error(err))
+	}
+	if err := paymentService.Drain(shutdownCtx); err != nil {
+		logger.Error("payments: charges still settling at the end of the grace period", zap.Error(err))
+	}
+	if err := manualOrderService.Drain(shutdownCtx); err != nil {
+		logger.Error("manual orders: rejection emails still sending at the end of the grace period", zap.Error(err))
+	}
+	logger.Info("shutdown complete")
+}
+
+// waitFor waits until done is closed or ctx is done.
+func waitFor(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
@@ -3,9 +3,14 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 )
 
+// minIdempotencyLockSeconds leaves headroom over R4's 150s
+// direct-debit-account timeout (pkg/r4bank/client.go).
+const minIdempotencyLockSeconds = 180
+
 // Config holds the application configuration
 type Config struct {
 	Port  string
@@ -13,6 +18,15 @@ type Config struct {
 
 	CORSAllowedOrigins []string
 
+	// TrustedProxies are the proxy IPs or CIDRs whose X-Forwarded-For is
+	// believed when working out the caller's IP, comma-separated
+	// (TRUSTED_PROXIES). Empty trusts none: the IP is the peer's address.
+	TrustedProxies []string
+	// TrustedPlatform names a header the platform sets to the caller's IP
+	// and that callers can't forge, e.g. CF-Connecting-IP (TRUSTED_PLATFORM).
+	// When present it wins over TrustedProxies.
+	TrustedPlatform string
+
 	// DATABASE
 	DBHost     string
 	DBPort     string
@@ -50,6 +64,87 @@ type Config struct {
 
 	// Cart quote secret
 	CartQuoteSecret string
+
+	// OTPHashSecret keys the HMAC under which OTP codes are stored
+	// (OTP_HASH_SECRET)
+	OTPHashSecret string
+
+	// APIKeys authenticates the operational routes, as comma-separated
+	// "name:role:key" entries (roles: support, finance, admin)
+	APIKeys string
+
+	// IGTFRates overrides the IGTF rate per payment method, as
+	// "<paymentMethodId>:<rate>" pairs. Empty means Zelle and cash at 3%.
+	IGTFRates string
+
+	// RateLimits overrides the limit per public route group, as
+	// "<group>:<limit>/<window>" entries (RATE_LIMITS; groups otp, charge,
+	// lookup)
+	RateLimits string
+	// RateLimitStore is where counters live: "postgres", shared by every
+	// instance, or "memory" (RATE_LIMIT_STORE, default postgres)
+	RateLimitStore string
+
+	// OrphanMobilePaymentDays is how long a pago móvil may stay unmatched
+	// before it's reported as orphaned (ORPHAN_MOBILE_PAYMENT_DAYS, default 7)
+	OrphanMobilePaymentDays int
+	// OrphanRefundEnabled turns on the automatic refund of orphaned pago
+	// móvil rows (ORPHAN_REFUND_ENABLED=1)
+	OrphanRefundEnabled bool
+	// OrphanRefundMaxPerRun caps the bolívares refunded by one run
+	// (ORPHAN_REFUND_MAX_PER_RUN)
+	OrphanRefundMaxPerRun float64
+
+	// UnattachedCartAlertMinutes is how long a cart charge may wait for
+	// attach-order before support is alerted (UNATTACHED_CART_ALERT_MINUTES,
+	// default 30)
+	UnattachedCartAlertMinutes int
+	// UnattachedCartRefundEnabled turns on refunding cart charges still
+	// unattached after UnattachedCartRefundHours
+	// (UNATTACHED_CART_REFUND_ENABLED=1)
+	UnattachedCartRefundEnabled bool
+	// UnattachedCartRefundHours: UNATTACHED_CART_REFUND_HOURS, default 48
+	UnattachedCartRefundHours int
+
+	// IdempotencyLockSeconds is how long a request holds its Idempotency-Key
+	// before a crashed one is given up on (IDEMPOTENCY_LOCK_SECONDS, default
+	// 180). It must outlast the slowest R4 call, direct-debit-account at 150s,
+	// or a retry could take over the key of a request still charging.
+	IdempotencyLockSeconds int
+	// IdempotencyTTLHours is how long a finished request's response is
+	// replayed (IDEMPOTENCY_TTL_HOURS, default 24)
+	IdempotencyTTLHours int
+
+	// ChargeLockTimeoutSeconds is how long a charge waits for another one on
+	// the same order or cart before answering "payment in progress"
+	// (CHARGE_LOCK_TIMEOUT_SECONDS, default 10)
+	ChargeLockTimeoutSeconds int
+
+	// OTPMaxAttempts wrong codes lock the current OTP (OTP_MAX_ATTEMPTS,
+	// default 5)
+	OTPMaxAttempts int
+	// OTPResendCooldownSeconds is the least time between two OTP emails for
+	// one order, cart or customer (OTP_RESEND_COOLDOWN_SECONDS, default 60)
+	OTPResendCooldownSeconds int
+	// OTPDailySends caps OTP emails per order, cart or customer over 24 hours
+	// (OTP_DAILY_SENDS, default 5)
+	OTPDailySends int
+
+	// RecurrentRetryBackoffDays is the wait after each decline of a recurrent
+	// charge, as comma-separated days; the last repeats
+	// (RECURRENT_RETRY_BACKOFF_DAYS, default "1,2,4")
+	RecurrentRetryBackoffDays string
+	// RecurrentRetryMaxAttempts declines give up on a recurrent charge
+	// (RECURRENT_RETRY_MAX_ATTEMPTS, default 5)
+	RecurrentRetryMaxAttempts int
+	// RecurrentRetryMaxDays after the first decline, a recurrent charge is
+	// given up on (RECURRENT_RETRY_MAX_DAYS, default 14)
+	RecurrentRetryMaxDays int
+
+	// ShutdownGraceSeconds is how long a SIGTERM waits for requests, jobs and
+	// charges under way before the process exits (SHUTDOWN_GRACE_SECONDS,
+	// default 9: Cloud Run kills the container 10 seconds after SIGTERM)
+	ShutdownGraceSeconds int
 }
 
 // Load reads configuration from environment variables and returns a Config struct
@@ -60,6 +155,8 @@ func Load() (*Config, error) {
 		Port:               os.Getenv("PORT"),
 		Debug:              os.Getenv("DEBUG"),
 		CORSAllowedOrigins: corsOrigins,
+		TrustedProxies:     listEnv("TRUSTED_PROXIES"),
+		TrustedPlatform:    os.Getenv("TRUSTED_PLATFORM"),
 		// DATABASE
 		DBHost:     os.Getenv("DB_HOST"),
 		DBPort:     os.Getenv("DB_PORT"),
@@ -90,6 +187,62 @@ func Load() (*Config, error) {
 		RecurrentDirectDebitAppID: os.Getenv("RECURRENT_DIRECT_DEBIT_APP_ID"),
 
 		CartQuoteSecret: os.Getenv("CART_QUOTE_SECRET"),
+
+		OTPHashSecret: os.Getenv("OTP_HASH_SECRET"),
+
+		APIKeys: os.Getenv("API_KEYS"),
+
+		IGTFRates: os.Getenv("IGTF_RATES"),
+
+		RateLimits:     os.Getenv("RATE_LIMITS"),
+		RateLimitStore: os.Getenv("RATE_LIMIT_STORE"),
+
+		RecurrentRetryBackoffDays: os.Getenv("RECURRENT_RETRY_BACKOFF_DAYS"),
+
+		OrphanRefundEnabled: os.Getenv("ORPHAN_REFUND_ENABLED") == "1",
+
+		UnattachedCartRefundEnabled: os.Getenv("UNATTACHED_CART_REFUND_ENABLED") == "1",
+	}
+
+	var err error
+	if cfg.OrphanMobilePaymentDays, err = intEnv("ORPHAN_MOBILE_PAYMENT_DAYS", 7); err != nil {
+		return nil, err
+	}
+	if cfg.OrphanRefundMaxPerRun, err = floatEnv("ORPHAN_REFUND_MAX_PER_RUN", 0); err != nil {
+		return nil, err
+	}
+	if cfg.UnattachedCartAlertMinutes, err = intEnv("UNATTACHED_CART_ALERT_MINUTES", 30); err != nil {
+		return nil, err
+	}
+	if cfg.UnattachedCartRefundHours, err = intEnv("UNATTACHED_CART_REFUND_HOURS", 48); err != nil {
+		return nil, err
+	}
+	if cfg.IdempotencyLockSeconds, err = intEnv("IDEMPOTENCY_LOCK_SECONDS", minIdempotencyLockSeconds); err != nil {
+		return nil, err
+	}
+	if cfg.IdempotencyTTLHours, err = intEnv("IDEMPOTENCY_TTL_HOURS", 24); err != nil {
+		return nil, err
+	}
+	if cfg.ChargeLockTimeoutSeconds, err = intEnv("CHARGE_LOCK_TIMEOUT_SECONDS", 10); err != nil {
+		return nil, err
+	}
+	if cfg.OTPMaxAttempts, err = intEnv("OTP_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.OTPResendCooldownSeconds, err = intEnv("OTP_RESEND_COOLDOWN_SECONDS", 60); err != nil {
+		return nil, err
+	}
+	if cfg.OTPDailySends, err = intEnv("OTP_DAILY_SENDS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.RecurrentRetryMaxAttempts, err = intEnv("RECURRENT_RETRY_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.RecurrentRetryMaxDays, err = intEnv("RECURRENT_RETRY_MAX_DAYS", 14); err != nil {
+		return nil, err
+	}
+	if cfg.ShutdownGraceSeconds, err = intEnv("SHUTDOWN_GRACE_SECONDS", 9); err != nil {
+		return nil, err
 	}
 
 	if err := validate(cfg); err != nil {
@@ -169,5 +322,78 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("RecurrentDirectDebitAppID is not configured")
 	}
 
+	if cfg.OTPHashSecret == "" {
+		return fmt.Errorf("OTPHashSecret is not configured")
+	}
+	if cfg.OTPMaxAttempts < 1 {
+		return fmt.Errorf("OTPMaxAttempts must be at least 1")
+	}
+	if cfg.OTPDailySends < 1 {
+		return fmt.Errorf("OTPDailySends must be at least 1")
+	}
+	if cfg.OTPResendCooldownSeconds < 0 {
+		return fmt.Errorf("OTPResendCooldownSeconds must not be negative")
+	}
+
+	if cfg.OrphanMobilePaymentDays < 1 {
+		return fmt.Errorf("OrphanMobilePaymentDays must be at least 1")
+	}
+	if cfg.OrphanRefundEnabled && cfg.OrphanRefundMaxPerRun <= 0 {
+		return fmt.Errorf("OrphanRefundMaxPerRun is not configured")
+	}
+	if cfg.RecurrentRetryMaxAttempts < 1 {
+		return fmt.Errorf("RecurrentRetryMaxAttempts must be at least 1")
+	}
+	if cfg.RecurrentRetryMaxDays < 1 {
+		return fmt.Errorf("RecurrentRetryMaxDays must be at least 1")
+	}
+	if cfg.UnattachedCartAlertMinutes < 1 {
+		return fmt.Errorf("UnattachedCartAlertMinutes must be at least 1")
+	}
+	if cfg.UnattachedCartRefundHours*60 <= cfg.UnattachedCartAlertMinutes {
+		return fmt.Errorf("UnattachedCartRefundHours must be longer than UnattachedCartAlertMinutes")
+	}
+	if cfg.IdempotencyLockSeconds < minIdempotencyLockSeconds {
+		return fmt.Errorf("IdempotencyLockSeconds must be at least %d", minIdempotencyLockSeconds)
+	}
+
 	return nil
 }
+
+// listEnv reads a comma-separated environment variable, dropping empty
+// entries
+func listEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// intEnv reads an integer environment variable, returning def when unset
+func intEnv(key string, def int) (int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return value, nil
+}
+
+// floatEnv reads a decimal environment variable, returning def when unset
+func floatEnv(key string, def float64) (float64, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return value, nil
+}
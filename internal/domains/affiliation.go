@@ -0,0 +1,98 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"appa_payments/internal/models"
+)
+
+// Affiliation statuses. A customer has at most one affiliation requested or
+// active, their current one; refused and revoked ones are history. An active
+// affiliation is the account the direct_debit_account metafield holds.
+const (
+	// AffiliationRequested is an account not yet confirmed by a charge:
+	// support put it in place by hand, or R4 answered MD01, which also clears
+	// the metafield until the buyer affiliates again.
+	AffiliationRequested = "requested"
+	// AffiliationActive is an account R4 charged.
+	AffiliationActive = "active"
+	// AffiliationRefused is an account R4 won't charge: MD09 or AC01.
+	AffiliationRefused = "refused"
+	// AffiliationRevoked is an account support revoked, or one replaced by
+	// another.
+	AffiliationRevoked = "revoked"
+)
+
+var (
+	ErrAffiliationNotFound = errors.New("affiliation not found")
+	ErrCustomerNotFound    = errors.New("customer not found")
+)
+
+// affiliationStatuses is the status a charge's response code leaves an
+// affiliation in. Codes not listed, like insufficient funds, say nothing
+// about the affiliation.
+var affiliationStatuses = map[string]string{
+	ResponseCodeOK:                 AffiliationActive,
+	ResponseCodeAffiliationPending: AffiliationRequested,
+	ResponseCodeAffiliationRefused: AffiliationRefused,
+	ResponseCodeInvalidAccount:     AffiliationRefused,
+}
+
+// AffiliationStatusForCode is the status a charge answered with
+// responseCode leaves the account's affiliation in; ok is false when the
+// code doesn't change it.
+func AffiliationStatusForCode(responseCode string) (status string, ok bool) {
+	status, ok = affiliationStatuses[responseCode]
+	return status, ok
+}
+
+// MaskAccount keeps an account's bank code (first 4 digits) and last 4,
+// starring the rest. A short account keeps only its last 4.
+func MaskAccount(account string) string {
+	account = strings.TrimSpace(account)
+	switch {
+	case len(account) <= 4:
+		return account
+	case len(account) <= 8:
+		return strings.Repeat("*", len(account)-4) + account[len(account)-4:]
+	default:
+		return account[:4] + strings.Repeat("*", len(account)-8) + account[len(account)-4:]
+	}
+}
+
+// AccountBank is the bank code an account number starts with.
+func AccountBank(account string) string {
+	account = strings.TrimSpace(account)
+	if len(account) < 4 {
+		return ""
+	}
+	return account[:4]
+}
+
+// AffiliationCharge is what a domiciliación charge told about the account
+// it was made on.
+type AffiliationCharge struct {
+	CustomerID   string
+	Account      string
+	DNI          string
+	ResponseCode string
+	OrderID      string
+}
+
+// AffiliationService keeps the affiliations table, the history behind each
+// customer's direct_debit_account metafield.
+type AffiliationService interface {
+	// RecordCharge moves the account's affiliation to the status the charge
+	// leaves it in, starting one if the customer's current affiliation is
+	// for another account. Failures are logged, not returned: the charge
+	// has already happened.
+	RecordCharge(ctx context.Context, charge AffiliationCharge)
+	Get(ctx context.Context, customerID string) (*models.AffiliationResponse, error)
+	// Revoke clears the metafield and revokes the current affiliation.
+	Revoke(ctx context.Context, customerID string) (*models.AffiliationResponse, error)
+	// Replace writes another account to the metafield, requested until a
+	// charge confirms it, and revokes the current affiliation.
+	Replace(ctx context.Context, customerID string, req models.ReplaceAffiliationRequest) (*models.AffiliationResponse, error)
+}
@@ -0,0 +1,54 @@
+package domains
+
+import "testing"
+
+func TestMaskAccount(t *testing.T) {
+	cases := []struct {
+		name    string
+		account string
+		want    string
+	}{
+		{"20 digits keep bank and last 4", "01021234567890123456", "0102************3456"},
+		{"surrounding spaces are dropped", " 01021234567890123456 ", "0102************3456"},
+		{"short account keeps its last 4", "12345678", "****5678"},
+		{"4 digits or fewer are left alone", "1234", "1234"},
+		{"empty", "", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MaskAccount(tc.account); got != tc.want {
+				t.Fatalf("MaskAccount(%q) = %q, want %q", tc.account, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAccountBank(t *testing.T) {
+	if got := AccountBank("01021234567890123456"); got != "0102" {
+		t.Fatalf("AccountBank = %q, want 0102", got)
+	}
+	if got := AccountBank("010"); got != "" {
+		t.Fatalf("AccountBank of a short account = %q, want empty", got)
+	}
+}
+
+func TestAffiliationStatusForCode(t *testing.T) {
+	cases := []struct {
+		code   string
+		want   string
+		wantOK bool
+	}{
+		{ResponseCodeOK, AffiliationActive, true},
+		{ResponseCodeAffiliationPending, AffiliationRequested, true},
+		{ResponseCodeAffiliationRefused, AffiliationRefused, true},
+		{ResponseCodeInvalidAccount, AffiliationRefused, true},
+		{ResponseCodeInsufficientFunds, "", false},
+		{"", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := AffiliationStatusForCode(tc.code)
+		if got != tc.want || ok != tc.wantOK {
+			t.Fatalf("AffiliationStatusForCode(%q) = %q, %v; want %q, %v", tc.code, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package domains
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"appa_payments/internal/models"
+)
+
+// Audit actions. Subjects are named by AuditSubject*.
+const (
+	AuditActionMobilePaymentRefund     = "mobile_payment.refund"
+	AuditActionMobilePaymentDelete     = "mobile_payment.delete"
+	AuditActionDirectDebitAccountClear = "customer.direct_debit_account.clear"
+	AuditActionCustomerParentIDUpdate  = "customer.parent_id.update"
+	AuditActionManualOrderApprove      = "manual_order.approve"
+	AuditActionManualOrderReject       = "manual_order.reject"
+	AuditActionWebhookReplay           = "webhook.replay"
+	AuditActionRecurrentRetry          = "recurrent.retry"
+	AuditActionSubscriptionCreate      = "subscription.create"
+	AuditActionSubscriptionPause       = "subscription.pause"
+	AuditActionSubscriptionResume      = "subscription.resume"
+	AuditActionSubscriptionCancel      = "subscription.cancel"
+	AuditActionAffiliationRevoke       = "customer.affiliation.revoke"
+	AuditActionAffiliationReplace      = "customer.affiliation.replace"
+)
+
+const (
+	AuditSubjectOrder         = "order"
+	AuditSubjectCart          = "cart"
+	AuditSubjectCustomer      = "customer"
+	AuditSubjectMobilePayment = "mobile_payment"
+	AuditSubjectManualOrder   = "manual_order"
+	// AuditSubjectRecurrentPending is a pending recurrent charge, by order
+	// id, or "all" of them.
+	AuditSubjectRecurrentPending = "recurrent_pending_payment"
+	AuditSubjectSubscription     = "subscription"
+)
+
+// Actors recorded when the context carries no authenticated caller.
+const (
+	AuditActorAnonymous = "anonymous" // an unauthenticated HTTP request
+	AuditActorSystem    = "system"    // cron jobs, webhook workers
+)
+
+// AuditEvent is one thing that happened to a subject. Before and After are
+// stored as JSON; either may be nil.
+type AuditEvent struct {
+	Action      string
+	SubjectType string
+	SubjectID   string
+	Before      any
+	After       any
+}
+
+// AuditService keeps the append-only audit_events log.
+type AuditService interface {
+	// Record appends event, taking the actor and request id from ctx. Pass
+	// the caller's transaction as tx so the event commits or rolls back with
+	// the change it describes, or nil to write on its own. Failures are
+	// logged, not returned: the action has already happened.
+	Record(ctx context.Context, tx *gorm.DB, event AuditEvent)
+	List(ctx context.Context, req models.ListAuditEventsRequest) (*models.AuditEventPage, error)
+}
+
+// auditPIIFields are the snapshot fields, at any depth, that the audit log
+// keeps masked by MaskPII: the buyer's phone, document and account.
+var auditPIIFields = map[string]bool{
+	"phone":       true,
+	"senderPhone": true,
+	"dni":         true,
+	"account":     true,
+}
+
+// auditDroppedFields hold PII the log can't mask field by field, like the
+// cash change details a manual order keeps as raw JSON bytes.
+var auditDroppedFields = map[string]bool{
+	"returnData": true,
+}
+
+// MaskPII keeps the last 4 characters of value and stars the rest: enough to
+// tell two buyers apart, not to reach or impersonate one.
+func MaskPII(value string) string {
+	if len(value) <= 4 {
+		return strings.Repeat("*", len(value))
+	}
+	return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
+}
+
+// MaskAuditPII masks the PII fields of an audit snapshot, wherever they are
+// nested. raw that isn't a JSON object or array is returned as is.
+func MaskAuditPII(raw json.RawMessage) json.RawMessage {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return raw
+	}
+	switch v.(type) {
+	case map[string]any, []any:
+	default:
+		return raw
+	}
+
+	masked, err := json.Marshal(maskAuditValue(v))
+	if err != nil {
+		return raw
+	}
+	return masked
+}
+
+func maskAuditValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			switch {
+			case auditDroppedFields[key]:
+				delete(v, key)
+			case auditPIIFields[key]:
+				if str, ok := value.(string); ok {
+					v[key] = MaskPII(str)
+				}
+			default:
+				v[key] = maskAuditValue(value)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = maskAuditValue(v[i])
+		}
+	}
+	return v
+}
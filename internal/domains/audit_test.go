@@ -0,0 +1,50 @@
+package domains
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMaskPII(t *testing.T) {
+	cases := map[string]string{
+		"04141234567": "*******4567",
+		"V-12345678":  "******5678",
+		"1234":        "****",
+		"":            "",
+	}
+	for value, want := range cases {
+		if got := MaskPII(value); got != want {
+			t.Fatalf("MaskPII(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestMaskAuditPII(t *testing.T) {
+	raw := json.RawMessage(`{"id":7,"amount":125.5,"senderPhone":"04141234567","commercePhone":"04240000000",` +
+		`"returnData":"eyJwaG9uZSI6IjA0MTQxMjM0NTY3In0=","items":[{"dni":"12345678","account":"01021234567890123456"}]}`)
+
+	var got map[string]any
+	if err := json.Unmarshal(MaskAuditPII(raw), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["senderPhone"] != "*******4567" {
+		t.Fatalf("senderPhone = %v, want masked", got["senderPhone"])
+	}
+	if got["commercePhone"] != "04240000000" {
+		t.Fatalf("commercePhone = %v, want untouched", got["commercePhone"])
+	}
+	if _, ok := got["returnData"]; ok {
+		t.Fatal("returnData kept, want dropped")
+	}
+	item := got["items"].([]any)[0].(map[string]any)
+	if item["dni"] != "****5678" || item["account"] != "****************3456" {
+		t.Fatalf("nested item = %v, want dni and account masked", item)
+	}
+	if got["amount"] != 125.5 {
+		t.Fatalf("amount = %v, want 125.5", got["amount"])
+	}
+
+	if plain := MaskAuditPII(json.RawMessage(`"V-12345678"`)); string(plain) != `"V-12345678"` {
+		t.Fatalf("a bare string = %s, want it untouched", plain)
+	}
+}
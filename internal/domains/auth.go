@@ -0,0 +1,39 @@
+package domains
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Role is what an API key is allowed to do. RoleAdmin passes every check.
+type Role string
+
+const (
+	RoleSupport Role = "support"
+	RoleFinance Role = "finance"
+	RoleAdmin   Role = "admin"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleSupport, RoleFinance, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Authenticator guards operational routes with named, role-scoped API keys
+// sent as "Authorization: Bearer <key>".
+type Authenticator interface {
+	// Require lets a request through when its key has one of roles, or is
+	// an admin key.
+	Require(roles ...Role) gin.HandlerFunc
+}
+
+var (
+	ErrAuthNoKeys  = errors.New("no API keys configured")
+	ErrAuthMissing = errors.New("API key missing")
+	ErrAuthInvalid = errors.New("API key not recognized")
+)
@@ -0,0 +1,38 @@
+package domains
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrPaymentInProgress means another request is charging the same order,
+	// draft or cart and didn't finish within the lock timeout.
+	ErrPaymentInProgress = errors.New("payment in progress")
+	// ErrOrderAlreadyCharged means a recurrent order already has a successful
+	// domiciliación charge and must not be charged again.
+	ErrOrderAlreadyCharged = errors.New("order already charged")
+)
+
+// PaymentInProgressMessage answers a buyer whose charge collided with one
+// still running for the same order or cart.
+const PaymentInProgressMessage = "ya hay un pago en proceso para esta orden, intente de nuevo en unos minutos"
+
+// ChargeLocker serializes everything that moves money for one chargeable, so
+// the buyer, the webhook worker and the retry job can't charge it twice.
+type ChargeLocker interface {
+	// Lock waits up to the configured timeout for key and returns
+	// ErrPaymentInProgress if it is still held. unlock is safe to call more
+	// than once.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// OrderChargeLockKey keys the lock of an order or draft order.
+func OrderChargeLockKey(orderType, orderID string) string {
+	return "charge:" + orderType + ":" + orderID
+}
+
+// CartChargeLockKey keys the lock of a cart quote.
+func CartChargeLockKey(cartID string) string {
+	return "charge:cart:" + cartID
+}
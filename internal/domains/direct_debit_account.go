@@ -1,18 +1,28 @@
 package domains
 
-import "slices"
+import (
+	"errors"
+	"slices"
+)
 
 // Codes sent to the checkout, which maps them to what the buyer reads.
 const (
 	ResponseCodeOK                 = "OK"
 	ResponseCodeAffiliationExists  = "AAF01"
 	ResponseCodeInvalidOTP         = "OTP01"
+	ResponseCodeOTPLocked          = "OTP02"
+	ResponseCodeOTPResendTooSoon   = "OTP03"
 	ResponseCodeInsufficientFunds  = "ERR01"
 	ResponseCodeAffiliationPending = "ERR02"
 	ResponseCodeAffiliationRefused = "ERR03"
 	ResponseCodeInvalidAccount     = "ERR04"
 )
 
+// ErrChargeOutcomeUnknown is matched by the error of a domiciliación charge
+// whose call to R4 failed without an answer: R4 may have charged, and nothing
+// was recorded, so retrying it blindly risks charging twice.
+var ErrChargeOutcomeUnknown = errors.New("charge outcome unknown")
+
 // DirectDebitAccountRequest is the internal request used by the payment service
 // to process a direct debit account charge (first-time or recurring).
 type DirectDebitAccountRequest struct {
@@ -0,0 +1,34 @@
+package domains
+
+import (
+	"context"
+	"errors"
+
+	"appa_payments/internal/models"
+)
+
+// Rails a money movement can belong to in the transactions export.
+const (
+	RailDebitoInmediato = "debito_inmediato"
+	RailPagoMovil       = "pago_movil"
+	RailDomiciliacion   = "domiciliacion"
+	RailZelle           = "zelle"
+	RailEfectivo        = "efectivo"
+	RailPagoMovilManual = "pago_movil_manual"
+)
+
+// Export formats.
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+var ErrExportRange = errors.New("from must not be after to")
+
+// ExportService produces finance exports.
+type ExportService interface {
+	// StreamTransactions calls fn once per money movement in the request's
+	// range, oldest first, reading rows from the database as it goes. It
+	// stops at the first error fn returns.
+	StreamTransactions(ctx context.Context, req models.ExportTransactionsRequest, fn func(models.TransactionRow) error) error
+}
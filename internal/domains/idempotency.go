@@ -0,0 +1,25 @@
+package domains
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader names the request a client may repeat safely. CORS has
+// to allow it by name.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Idempotency key states.
+const (
+	IdempotencyStatusInProgress = "in_progress"
+	IdempotencyStatusCompleted  = "completed"
+)
+
+// Idempotency makes a charging route safe to repeat: the first request with a
+// key runs, later ones with the same key replay its response.
+type Idempotency interface {
+	Handler() gin.HandlerFunc
+	// PurgeExpired deletes keys past their expiry.
+	PurgeExpired(ctx context.Context)
+}
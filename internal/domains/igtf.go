@@ -0,0 +1,74 @@
+package domains
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IGTFRate is the Impuesto a las Grandes Transacciones Financieras charged on
+// payments made in foreign currency.
+const IGTFRate = 0.03
+
+// IGTFRates maps a payment method id to the IGTF rate it pays (0.03 = 3%).
+// Methods not in the map pay none.
+type IGTFRates map[int]float64
+
+// DefaultIGTFRates charges IGTF on the rails paid in dollars: Zelle and cash.
+func DefaultIGTFRates() IGTFRates {
+	return IGTFRates{
+		PaymentMethodZelle: IGTFRate,
+		PaymentMethodCash:  IGTFRate,
+	}
+}
+
+// ParseIGTFRates reads "<paymentMethodId>:<rate>" pairs separated by commas,
+// e.g. "1:0.03,2:0.03". An empty string yields DefaultIGTFRates.
+func ParseIGTFRates(raw string) (IGTFRates, error) {
+	if strings.TrimSpace(raw) == "" {
+		return DefaultIGTFRates(), nil
+	}
+
+	rates := IGTFRates{}
+	for pair := range strings.SplitSeq(raw, ",") {
+		id, rate, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid IGTF rate %q: want <paymentMethodId>:<rate>", pair)
+		}
+		methodID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IGTF payment method %q: %w", id, err)
+		}
+		value, err := strconv.ParseFloat(rate, 64)
+		if err != nil || value < 0 || value >= 1 {
+			return nil, fmt.Errorf("invalid IGTF rate %q for payment method %d", rate, methodID)
+		}
+		rates[methodID] = value
+	}
+	return rates, nil
+}
+
+// Rate returns the IGTF rate of a payment method, 0 when it pays none.
+func (r IGTFRates) Rate(paymentMethodID int) float64 {
+	return r[paymentMethodID]
+}
+
+// Amount is the IGTF owed on amountUSD paid with paymentMethodID, rounded to
+// cents.
+func (r IGTFRates) Amount(paymentMethodID int, amountUSD float64) float64 {
+	return math.Round(amountUSD*r.Rate(paymentMethodID)*100) / 100
+}
+
+// PaymentMethods lists the methods that pay IGTF, in id order.
+func (r IGTFRates) PaymentMethods() []int {
+	ids := make([]int, 0, len(r))
+	for id, rate := range r {
+		if rate > 0 {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
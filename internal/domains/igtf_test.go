@@ -0,0 +1,49 @@
+package domains
+
+import "testing"
+
+func TestParseIGTFRates(t *testing.T) {
+	rates, err := ParseIGTFRates("")
+	if err != nil {
+		t.Fatalf("ParseIGTFRates(\"\") error = %v", err)
+	}
+	if rates.Rate(PaymentMethodZelle) != IGTFRate || rates.Rate(PaymentMethodCash) != IGTFRate {
+		t.Fatalf("default rates = %v, want Zelle and cash at %v", rates, IGTFRate)
+	}
+	if rates.Rate(PaymentMethodMobilePayment) != 0 {
+		t.Fatalf("pago móvil rate = %v, want 0", rates.Rate(PaymentMethodMobilePayment))
+	}
+
+	rates, err = ParseIGTFRates("1:0.03, 2:0.02")
+	if err != nil {
+		t.Fatalf("ParseIGTFRates error = %v", err)
+	}
+	if rates.Rate(1) != 0.03 || rates.Rate(2) != 0.02 {
+		t.Fatalf("rates = %v, want 1:0.03 2:0.02", rates)
+	}
+
+	for _, raw := range []string{"1", "x:0.03", "1:abc", "1:-0.1", "1:1.5"} {
+		if _, err := ParseIGTFRates(raw); err == nil {
+			t.Fatalf("ParseIGTFRates(%q) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestIGTFAmount(t *testing.T) {
+	rates := DefaultIGTFRates()
+	cases := []struct {
+		method int
+		usd    float64
+		want   float64
+	}{
+		{PaymentMethodZelle, 100, 3},
+		{PaymentMethodCash, 33.33, 1},
+		{PaymentMethodCash, 49.99, 1.5},
+		{PaymentMethodMobilePayment, 100, 0},
+	}
+	for _, tc := range cases {
+		if got := rates.Amount(tc.method, tc.usd); got != tc.want {
+			t.Fatalf("Amount(%d, %v) = %v, want %v", tc.method, tc.usd, got, tc.want)
+		}
+	}
+}
@@ -2,10 +2,15 @@ package domains
 
 import (
 	"context"
+	"errors"
 
 	"appa_payments/internal/models"
 )
 
+// ErrOrderNotFound is returned for an order id Shopify doesn't have, e.g.
+// one deleted since it was recorded.
+var ErrOrderNotFound = errors.New("order not found")
+
 // StoreService defines methods for order persistence
 // Implement in infrastructure layer if needed
 type StoreService interface {
@@ -20,10 +25,15 @@ type PaymentService interface {
 	ValidateDirectDebit(ctx context.Context, req models.ValidateOTPRequest) error
 	ValidateMobilePayment(ctx context.Context, req models.ValidateMobilePaymentRequest) *models.MobilePaymentResponse
 	ValidateMobilePaymentManual(ctx context.Context, req models.ValidateMobilePaymentManualRequest) error
+	ValidateCash(ctx context.Context, req models.ValidateCash) error
+	ValidateZelle(ctx context.Context, req models.ValidateZelle) error
 	RequestDirectDebitAccountOTP(ctx context.Context, orderID string, typeOrder *models.OrderType) error
 	DirectDebitAccount(ctx context.Context, req models.DirectDebitAccountRequest) (*models.ProcessDirectDebitAccountResponse, error)
 	DirectDebitAccountWithOTP(ctx context.Context, req models.DirectDebitAccountWithOTPRequest) (*models.ProcessDirectDebitAccountResponse, error)
+	ChargeRecurring(ctx context.Context, orderID string, orderType models.OrderType) (*models.ProcessDirectDebitAccountResponse, error)
 	HasSuccessfulRecurrentCharge(ctx context.Context, orderID string) (bool, error)
+	FinalizeOrder(ctx context.Context, orderID string, orderType models.OrderType) (*models.FinalizedOrder, error)
+	GetPaymentStatus(ctx context.Context, orderID string, orderType models.OrderType) (*models.PaymentStatusResponse, error)
 }
 
 // CartPaymentService defines methods for cart payment processing
@@ -0,0 +1,70 @@
+package domains
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"appa_payments/internal/models"
+)
+
+// Ledger accounts. Every posting moves an amount between one money account
+// and LedgerAccountPayments, so each transaction's entries sum to zero.
+const (
+	// LedgerAccountR4 is the merchant account at R4: débito inmediato,
+	// domiciliación, pago móvil in, and every ChangePaid out.
+	LedgerAccountR4 = "r4"
+	// LedgerAccountManual holds Zelle, cash and manual pago móvil, settled
+	// outside R4 and counted once a reviewer approves them.
+	LedgerAccountManual = "manual"
+	// LedgerAccountPayments is what buyers have paid, per order, cart and
+	// customer. Payments are credits, so a paid order's balance is negative.
+	LedgerAccountPayments = "payments"
+)
+
+// Ledger posting kinds. Charges and approvals bring money in; refunds and
+// excess returns send it back.
+const (
+	LedgerKindCharge   = "charge"
+	LedgerKindApproval = "approval"
+	LedgerKindRefund   = "refund"
+	LedgerKindExcess   = "excess"
+)
+
+// ErrLedgerOrderNotFound is returned for an order balance Shopify doesn't
+// know the order of.
+var ErrLedgerOrderNotFound = errors.New("order not found")
+
+// LedgerPosting is one movement of money, written as two balancing entries.
+type LedgerPosting struct {
+	Kind    string // LedgerKind*
+	Account string // the money side: LedgerAccountR4 or LedgerAccountManual
+	// AmountVES is always positive; Kind decides the direction. AmountUSD is
+	// converted at today's cached BCV rate when zero, and left empty if the
+	// rate has not been fetched yet.
+	AmountVES  float64
+	AmountUSD  float64
+	Source     string // the table the movement is recorded in
+	SourceID   int
+	Reference  string
+	OrderID    string // numeric Shopify id, draft id until the draft completes
+	OrderName  string
+	CartID     string
+	CustomerID string // numeric Shopify customer id, when the rail knows it
+}
+
+// LedgerService keeps ledger_entries and answers balances from it.
+type LedgerService interface {
+	// Post writes posting on tx, which should be the transaction that writes
+	// the payment row itself, so neither lands without the other.
+	Post(ctx context.Context, tx *gorm.DB, posting LedgerPosting) error
+	// ReassignOrder moves every entry posted against a draft to the order
+	// the draft completed into.
+	ReassignOrder(ctx context.Context, tx *gorm.DB, draftID, orderID, orderName string) error
+	// AttachCartOrder points the entries of a cart's payment, by reference,
+	// at the order attach-order linked it to, and at its customer when given.
+	AttachCartOrder(ctx context.Context, tx *gorm.DB, cartID, reference, orderID, orderName, customerID string) error
+	OrderBalance(ctx context.Context, orderID string) (*models.OrderBalance, error)
+	CustomerBalance(ctx context.Context, customerID string) (*models.CustomerBalance, error)
+}
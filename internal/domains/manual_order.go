@@ -0,0 +1,51 @@
+package domains
+
+import (
+	"context"
+	"errors"
+
+	"appa_payments/internal/models"
+)
+
+// Manual orders (appa_manual_orders) hold a receipt a human still has to
+// check before the order is paid. Only PENDING rows can be reviewed.
+// APPROVING is an approval in flight: the row is claimed before Shopify is
+// settled, so it can't be approved twice. A row left APPROVING was settled
+// in Shopify, or may have been, and is for support to close by hand.
+const (
+	ManualOrderStatusPending   = "PENDING"
+	ManualOrderStatusApproving = "APPROVING"
+	ManualOrderStatusApproved  = "APPROVED"
+	ManualOrderStatusRejected  = "REJECTED"
+	ManualOrderStatusCanceled  = "CANCELED"
+)
+
+// Payment method ids (payment_methods) of the rails that go through manual
+// review.
+const (
+	PaymentMethodZelle         = 1
+	PaymentMethodCash          = 2
+	PaymentMethodMobilePayment = 4
+)
+
+// ManualOrderReasonChange is the reversal reason recorded when cash change
+// is sent back by pago móvil.
+const ManualOrderReasonChange = "CHANGE"
+
+var (
+	ErrCashAmountInvalid      = errors.New("el monto en efectivo debe ser mayor o igual al total de la orden más IGTF")
+	ErrCashReturnDataRequired = errors.New("indique los datos de pago móvil para recibir el vuelto")
+)
+
+var (
+	ErrManualOrderNotFound   = errors.New("manual order not found")
+	ErrManualOrderNotPending = errors.New("manual order is not pending review")
+)
+
+// ManualOrderService is the back-office side of manual payments: support
+// lists what is waiting and approves or rejects it.
+type ManualOrderService interface {
+	List(ctx context.Context, req models.ListManualOrdersRequest) (*models.ManualOrderPage, error)
+	Approve(ctx context.Context, id int, actor string) (*models.ManualOrderReviewResponse, error)
+	Reject(ctx context.Context, id int, actor string, req models.RejectManualOrderRequest) (*models.ManualOrderReviewResponse, error)
+}
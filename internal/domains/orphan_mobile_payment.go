@@ -0,0 +1,22 @@
+package domains
+
+import (
+	"context"
+
+	"appa_payments/internal/models"
+)
+
+// MobilePaymentReversalReasonOrphan marks the refund of a pago móvil that was
+// never matched to an order or cart.
+const MobilePaymentReversalReasonOrphan = "ORPHAN"
+
+// OrphanMobilePaymentService finds pago móvil rows nobody claimed and, when
+// enabled, sends the money back.
+type OrphanMobilePaymentService interface {
+	// Report lists rows unmatched for longer than req.Days (the configured
+	// age when zero), oldest first.
+	Report(ctx context.Context, req models.OrphanMobilePaymentsRequest) (*models.OrphanMobilePaymentReport, error)
+	// RefundOrphans refunds orphaned rows, oldest first, until the per-run
+	// cap. A no-op beyond logging while the refund flag is off.
+	RefundOrphans(ctx context.Context)
+}
@@ -0,0 +1,87 @@
+package domains
+
+import (
+	"context"
+	"time"
+)
+
+// OTPStore keeps the one-time codes mailed before a domiciliación charge.
+// Order and cart flows share one store, keyed with OrderOTPKey and
+// CartOTPKey, so the second step may land on any instance.
+type OTPStore interface {
+	// Issue stores code for key, replacing any earlier one, unless a code was
+	// sent too recently or too often for key or any of scopes (e.g.
+	// CustomerOTPScope); then it returns *OTPThrottledError.
+	Issue(ctx context.Context, key string, scopes []string, code string) error
+	// Validate checks code against key's current unexpired code and consumes
+	// it if it matches: a code is good once. After OTPLimits.MaxAttempts
+	// wrong guesses the code is locked until a new one is issued.
+	Validate(ctx context.Context, key, code string) (OTPVerdict, error)
+	// PurgeExpired deletes expired and consumed codes and old send records.
+	PurgeExpired(ctx context.Context)
+}
+
+// OTPVerdict is the outcome of OTPStore.Validate.
+type OTPVerdict int
+
+const (
+	OTPValid OTPVerdict = iota
+	// OTPInvalid is a wrong, expired or already used code.
+	OTPInvalid
+	// OTPLocked is a code that took too many wrong guesses.
+	OTPLocked
+)
+
+// OTPLimits bound guessing and mailing codes.
+type OTPLimits struct {
+	// MaxAttempts wrong codes lock the current one.
+	MaxAttempts int
+	// ResendCooldown is the least time between two sends to one scope.
+	ResendCooldown time.Duration
+	// DailySends caps sends to one scope over the last 24 hours.
+	DailySends int
+}
+
+// OTPSendWindow is the window OTPLimits.DailySends counts over.
+const OTPSendWindow = 24 * time.Hour
+
+// OTPThrottledError means no code may be sent yet.
+type OTPThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPThrottledError) Error() string {
+	return "ha solicitado demasiados códigos, intente de nuevo más tarde"
+}
+
+// OTPSendRetryAfter applies limits to the sends already made to one scope
+// within OTPSendWindow, oldest first. It returns how long until another send
+// is allowed, or zero if one is allowed now.
+func OTPSendRetryAfter(limits OTPLimits, sends []time.Time, now time.Time) time.Duration {
+	if len(sends) == 0 {
+		return 0
+	}
+	var wait time.Duration
+	if limits.DailySends > 0 && len(sends) >= limits.DailySends {
+		wait = sends[len(sends)-limits.DailySends].Add(OTPSendWindow).Sub(now)
+	}
+	if cooldown := sends[len(sends)-1].Add(limits.ResendCooldown).Sub(now); cooldown > wait {
+		wait = cooldown
+	}
+	return max(wait, 0)
+}
+
+// OrderOTPKey keys the code for an order or draft.
+func OrderOTPKey(orderID string) string {
+	return "order:" + orderID
+}
+
+// CartOTPKey keys the code for a cart quote.
+func CartOTPKey(cartID string) string {
+	return "cart:" + cartID
+}
+
+// CustomerOTPScope limits sends to one customer across orders and carts.
+func CustomerOTPScope(customerID string) string {
+	return "customer:" + customerID
+}
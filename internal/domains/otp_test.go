@@ -0,0 +1,33 @@
+package domains
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOTPSendRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	limits := OTPLimits{ResendCooldown: time.Minute, DailySends: 3}
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	cases := []struct {
+		name  string
+		sends []time.Time
+		want  time.Duration
+	}{
+		{"never sent", nil, 0},
+		{"cooldown over", []time.Time{ago(2 * time.Minute)}, 0},
+		{"within cooldown", []time.Time{ago(20 * time.Second)}, 40 * time.Second},
+		{"under the cap", []time.Time{ago(3 * time.Hour), ago(2 * time.Hour)}, 0},
+		{"cap reached", []time.Time{ago(23 * time.Hour), ago(2 * time.Hour), ago(time.Hour)}, time.Hour},
+		{"cap and cooldown, cap longer", []time.Time{ago(20 * time.Hour), ago(time.Hour), ago(30 * time.Second)}, 4 * time.Hour},
+		{"over the cap counts the newest sends", []time.Time{ago(23 * time.Hour), ago(22 * time.Hour), ago(10 * time.Hour), ago(time.Hour)}, 2 * time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := OTPSendRetryAfter(limits, tc.sends, now); got != tc.want {
+				t.Fatalf("OTPSendRetryAfter() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
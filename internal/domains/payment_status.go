@@ -0,0 +1,48 @@
+package domains
+
+// Overall payment states reported by GET /payments/status/:orderId.
+const (
+	PaymentStateUnpaid            = "unpaid"
+	PaymentStateProcessing        = "processing"
+	PaymentStatePaid              = "paid"
+	PaymentStatePartiallyRefunded = "partially_refunded"
+	PaymentStateNeedsAttention    = "needs_attention"
+)
+
+// PaymentStateFacts is what the overall state is computed from.
+type PaymentStateFacts struct {
+	// FinancialStatus is Shopify's displayFinancialStatus; empty for a draft.
+	FinancialStatus string
+	// Charges counts successful R4 charges and approved manual receipts.
+	Charges int
+	// InFlight is set while a débito is still pending at R4 or a manual
+	// receipt awaits review.
+	InFlight bool
+	// PendingRetry is set when a declined recurrent charge awaits the retry
+	// job.
+	PendingRetry bool
+	// FailedRefunds counts refunds R4 refused, never retried on their own.
+	FailedRefunds int
+}
+
+// PaymentState folds the facts into one state. Anything support has to act
+// on wins: a refund that didn't go out, money taken twice, or money taken on
+// an order Shopify doesn't show as paid. Otherwise Shopify's status decides,
+// and an unpaid order is processing while something is still under way.
+func PaymentState(f PaymentStateFacts) string {
+	paid := f.FinancialStatus == "PAID"
+	refunded := f.FinancialStatus == "PARTIALLY_REFUNDED" || f.FinancialStatus == "REFUNDED"
+
+	switch {
+	case f.FailedRefunds > 0, f.Charges > 1, f.Charges == 1 && !paid && !refunded:
+		return PaymentStateNeedsAttention
+	case refunded:
+		return PaymentStatePartiallyRefunded
+	case paid:
+		return PaymentStatePaid
+	case f.InFlight, f.PendingRetry:
+		return PaymentStateProcessing
+	default:
+		return PaymentStateUnpaid
+	}
+}
@@ -0,0 +1,31 @@
+package domains
+
+import "testing"
+
+func TestPaymentState(t *testing.T) {
+	cases := []struct {
+		name  string
+		facts PaymentStateFacts
+		want  string
+	}{
+		{"nothing yet", PaymentStateFacts{FinancialStatus: "PENDING"}, PaymentStateUnpaid},
+		{"draft, nothing yet", PaymentStateFacts{}, PaymentStateUnpaid},
+		{"receipt under review", PaymentStateFacts{FinancialStatus: "PENDING", InFlight: true}, PaymentStateProcessing},
+		{"recurrent retry pending", PaymentStateFacts{FinancialStatus: "PENDING", PendingRetry: true}, PaymentStateProcessing},
+		{"charged and paid", PaymentStateFacts{FinancialStatus: "PAID", Charges: 1}, PaymentStatePaid},
+		{"paid outside the rails", PaymentStateFacts{FinancialStatus: "PAID"}, PaymentStatePaid},
+		{"partially refunded", PaymentStateFacts{FinancialStatus: "PARTIALLY_REFUNDED", Charges: 1}, PaymentStatePartiallyRefunded},
+		{"refunded", PaymentStateFacts{FinancialStatus: "REFUNDED", Charges: 1}, PaymentStatePartiallyRefunded},
+		{"charged, not paid", PaymentStateFacts{FinancialStatus: "PENDING", Charges: 1}, PaymentStateNeedsAttention},
+		{"draft charged, not completed", PaymentStateFacts{Charges: 1}, PaymentStateNeedsAttention},
+		{"charged twice", PaymentStateFacts{FinancialStatus: "PAID", Charges: 2}, PaymentStateNeedsAttention},
+		{"refund failed", PaymentStateFacts{FinancialStatus: "PAID", Charges: 1, FailedRefunds: 1}, PaymentStateNeedsAttention},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := PaymentState(tc.facts); got != tc.want {
+				t.Fatalf("PaymentState(%+v) = %q, want %q", tc.facts, got, tc.want)
+			}
+		})
+	}
+}
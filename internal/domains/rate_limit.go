@@ -0,0 +1,107 @@
+package domains
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route groups a rate limit applies to.
+const (
+	// RateLimitGroupOTP covers the routes that send an OTP: the bank's, by
+	// SMS, or ours, by email.
+	RateLimitGroupOTP = "otp"
+	// RateLimitGroupCharge covers the routes that charge or register a
+	// payment.
+	RateLimitGroupCharge = "charge"
+	// RateLimitGroupLookup covers the read-only routes that look an order up.
+	RateLimitGroupLookup = "lookup"
+)
+
+// RateLimitKey is what a request is counted against.
+type RateLimitKey string
+
+const (
+	RateLimitByIP    RateLimitKey = "ip"
+	RateLimitByDNI   RateLimitKey = "dni"
+	RateLimitByPhone RateLimitKey = "phone"
+	// RateLimitByOrder counts against the order id, or the cart id on cart
+	// routes.
+	RateLimitByOrder RateLimitKey = "order"
+)
+
+// RateLimit allows Limit requests per Window.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimits maps a route group to its limit. Groups not in the map aren't
+// limited.
+type RateLimits map[string]RateLimit
+
+// DefaultRateLimits are strict on sending OTPs, looser on charging and
+// lookups.
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		RateLimitGroupOTP:    {Limit: 5, Window: 10 * time.Minute},
+		RateLimitGroupCharge: {Limit: 10, Window: 10 * time.Minute},
+		RateLimitGroupLookup: {Limit: 60, Window: time.Minute},
+	}
+}
+
+// ParseRateLimits reads "<group>:<limit>/<window>" entries separated by
+// commas, e.g. "otp:5/10m,lookup:60/1m", over DefaultRateLimits. A limit of 0
+// turns a group off. An empty string yields DefaultRateLimits.
+func ParseRateLimits(raw string) (RateLimits, error) {
+	limits := DefaultRateLimits()
+	if strings.TrimSpace(raw) == "" {
+		return limits, nil
+	}
+
+	for entry := range strings.SplitSeq(raw, ",") {
+		group, spec, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: want <group>:<limit>/<window>", entry)
+		}
+		if _, known := limits[group]; !known {
+			return nil, fmt.Errorf("unknown rate limit group %q", group)
+		}
+		count, window, ok := strings.Cut(spec, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: want <limit>/<window>", spec)
+		}
+		limit, err := strconv.Atoi(count)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid rate limit count %q for group %s", count, group)
+		}
+		duration, err := time.ParseDuration(window)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid rate limit window %q for group %s", window, group)
+		}
+		limits[group] = RateLimit{Limit: limit, Window: duration}
+	}
+	return limits, nil
+}
+
+// RateLimitStore counts requests in fixed windows.
+type RateLimitStore interface {
+	// Hit counts one request against key in the window of the given length
+	// containing now, returning the count so far and when that window ends.
+	Hit(ctx context.Context, key string, window time.Duration, now time.Time) (count int, resetAt time.Time, err error)
+	// PurgeExpired drops counters of windows that have ended.
+	PurgeExpired(ctx context.Context)
+}
+
+// RateLimiter guards public routes.
+type RateLimiter interface {
+	// Handler limits a route of group, counting each request against each
+	// of keys the request carries.
+	Handler(group string, keys ...RateLimitKey) gin.HandlerFunc
+	// PurgeExpired drops counters of windows that have ended.
+	PurgeExpired(ctx context.Context)
+}
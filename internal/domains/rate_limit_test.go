@@ -0,0 +1,28 @@
+package domains
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits("otp:3/1h, lookup:0/1m")
+	if err != nil {
+		t.Fatalf("ParseRateLimits() error = %v", err)
+	}
+	if got, want := limits[RateLimitGroupOTP], (RateLimit{Limit: 3, Window: time.Hour}); got != want {
+		t.Errorf("otp = %+v, want %+v", got, want)
+	}
+	if got := limits[RateLimitGroupLookup].Limit; got != 0 {
+		t.Errorf("lookup limit = %d, want 0", got)
+	}
+	if got, want := limits[RateLimitGroupCharge], DefaultRateLimits()[RateLimitGroupCharge]; got != want {
+		t.Errorf("charge = %+v, want default %+v", got, want)
+	}
+
+	for _, raw := range []string{"otp", "otp:5", "otp:x/1m", "otp:5/soon", "otp:5/0s", "otp:-1/1m", "admin:5/1m"} {
+		if _, err := ParseRateLimits(raw); err == nil {
+			t.Errorf("ParseRateLimits(%q) succeeded, want error", raw)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package domains
+
+// Discrepancy types found by the daily reconciliation between the R4 tables
+// and Shopify.
+const (
+	// DiscrepancyChargedNotPaid: R4 took the money but the order isn't paid
+	// in Shopify — usually markOrderAsPaid failed after the charge.
+	DiscrepancyChargedNotPaid = "CHARGED_NOT_PAID"
+	// DiscrepancyPaidWithoutRecord: the order was marked paid through the
+	// manual gateway with no successful R4 row or approved manual order.
+	DiscrepancyPaidWithoutRecord = "PAID_WITHOUT_RECORD"
+	// DiscrepancyDraftNotCompleted: a draft was charged but never completed
+	// into an order.
+	DiscrepancyDraftNotCompleted = "DRAFT_NOT_COMPLETED"
+	// DiscrepancyOrderNotFound: an R4 row points at an order Shopify doesn't
+	// have.
+	DiscrepancyOrderNotFound = "ORDER_NOT_FOUND"
+	// DiscrepancyDuplicateCharge: more than one successful R4 row for the
+	// same order.
+	DiscrepancyDuplicateCharge = "DUPLICATE_CHARGE"
+)
+
+// SettledFinancialStatus reports whether a Shopify displayFinancialStatus
+// means the money was accounted for: paid, or paid and later refunded.
+func SettledFinancialStatus(status string) bool {
+	switch status {
+	case "PAID", "PARTIALLY_REFUNDED", "REFUNDED":
+		return true
+	}
+	return false
+}
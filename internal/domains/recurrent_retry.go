@@ -0,0 +1,118 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"appa_payments/internal/models"
+)
+
+// ErrRecurrentPendingNotFound is returned when retrying an order that has no
+// pending recurrent charge.
+var ErrRecurrentPendingNotFound = errors.New("no pending recurrent charge for this order")
+
+// Why the retries of a recurrent charge were given up on.
+const (
+	RecurrentGiveUpMaxAttempts        = "max_attempts"
+	RecurrentGiveUpMaxDays            = "max_days"
+	RecurrentGiveUpAffiliationRefused = "affiliation_refused"
+	RecurrentGiveUpInvalidAccount     = "invalid_account"
+	// RecurrentGiveUpOrderNotFound: the Shopify order no longer exists, so
+	// there is nothing left to charge.
+	RecurrentGiveUpOrderNotFound = "order_not_found"
+	// RecurrentGiveUpOutcomeUnknown: R4 failed without telling whether it
+	// charged, so retrying could charge twice until support checks R4.
+	RecurrentGiveUpOutcomeUnknown = "charge_outcome_unknown"
+)
+
+// RecurrentGiveUpTag is added to the Shopify order when its recurrent charge
+// is given up on.
+const RecurrentGiveUpTag = "domiciliacion-fallida"
+
+// recurrentFinalDeclines are the declines no retry can turn around: the bank
+// refused the affiliation (MD09) or the account doesn't exist (AC01).
+// Insufficient funds (AM04) and an affiliation still pending (MD01) may clear
+// by a later day.
+var recurrentFinalDeclines = map[string]string{
+	ResponseCodeAffiliationRefused: RecurrentGiveUpAffiliationRefused,
+	ResponseCodeInvalidAccount:     RecurrentGiveUpInvalidAccount,
+}
+
+// RecurrentRetryPolicy decides when a declined recurrent charge is tried
+// again, and when it is given up on.
+type RecurrentRetryPolicy struct {
+	// BackoffDays is how many days to wait after the first, second, ...
+	// decline; the last entry repeats.
+	BackoffDays []int
+	// MaxAttempts declines, the first included, end the retries.
+	MaxAttempts int
+	// MaxDays after the first decline, no retry is scheduled.
+	MaxDays int
+}
+
+// DefaultRecurrentRetryPolicy retries after 1, 2 and then every 4 days, up to
+// 5 declines within 14 days.
+func DefaultRecurrentRetryPolicy() RecurrentRetryPolicy {
+	return RecurrentRetryPolicy{BackoffDays: []int{1, 2, 4}, MaxAttempts: 5, MaxDays: 14}
+}
+
+// ParseRecurrentRetryBackoff reads comma-separated day counts, e.g. "1,2,4".
+// An empty string yields the default schedule.
+func ParseRecurrentRetryBackoff(raw string) ([]int, error) {
+	if strings.TrimSpace(raw) == "" {
+		return DefaultRecurrentRetryPolicy().BackoffDays, nil
+	}
+
+	var days []int
+	for entry := range strings.SplitSeq(raw, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(entry))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid recurrent retry backoff %q: want whole days, at least 1", entry)
+		}
+		days = append(days, n)
+	}
+	return days, nil
+}
+
+// Next decides what follows the attempts-th decline, with response code
+// code, of a charge first declined at firstDeclinedAt: the day of the next
+// try, or why to give up. Days are counted in now's location; a retry is due
+// from midnight of its day, so the daily job picks it up whatever its hour.
+func (p RecurrentRetryPolicy) Next(code string, attempts int, firstDeclinedAt, now time.Time) (retryAt time.Time, giveUp string) {
+	if reason, ok := recurrentFinalDeclines[code]; ok {
+		return time.Time{}, reason
+	}
+	if attempts >= p.MaxAttempts {
+		return time.Time{}, RecurrentGiveUpMaxAttempts
+	}
+
+	wait := 1
+	if len(p.BackoffDays) > 0 {
+		wait = p.BackoffDays[min(max(attempts, 1), len(p.BackoffDays))-1]
+	}
+	y, m, d := now.Date()
+	retryAt = time.Date(y, m, d+wait, 0, 0, 0, 0, now.Location())
+
+	fy, fm, fd := firstDeclinedAt.In(now.Location()).Date()
+	if retryAt.After(time.Date(fy, fm, fd+p.MaxDays, 0, 0, 0, 0, now.Location())) {
+		return time.Time{}, RecurrentGiveUpMaxDays
+	}
+	return retryAt, ""
+}
+
+// RecurrentRetrier retries declined recurrent charges on demand, besides the
+// daily job.
+type RecurrentRetrier interface {
+	// RecordDecline starts the retries of an order whose recurrent charge
+	// was just declined with response code code. An order already being
+	// retried is left as is.
+	RecordDecline(ctx context.Context, orderID, orderName, code string) error
+	// Retry retries the pending charge of req.OrderID, or every pending
+	// charge due when it is empty. A dry run charges and deletes nothing and
+	// reports what would happen.
+	Retry(ctx context.Context, req models.RecurrentRetryRequest) (*models.RecurrentRetryReport, error)
+}
@@ -0,0 +1,56 @@
+package domains
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrentRetryPolicyNext(t *testing.T) {
+	caracas := time.FixedZone("VET", -4*60*60)
+	policy := RecurrentRetryPolicy{BackoffDays: []int{1, 2, 4}, MaxAttempts: 5, MaxDays: 14}
+	first := time.Date(2026, 3, 10, 9, 30, 0, 0, caracas)
+	day := func(d int) time.Time { return time.Date(2026, 3, 10+d, 0, 0, 0, 0, caracas) }
+
+	cases := []struct {
+		name        string
+		code        string
+		attempts    int
+		now         time.Time
+		wantRetryAt time.Time
+		wantGiveUp  string
+	}{
+		{"first decline waits a day", ResponseCodeInsufficientFunds, 1, first, day(1), ""},
+		{"second decline waits two", ResponseCodeInsufficientFunds, 2, first.AddDate(0, 0, 1), day(3), ""},
+		{"last backoff repeats", ResponseCodeInsufficientFunds, 4, first.AddDate(0, 0, 7), day(11), ""},
+		{"affiliation pending is retried", ResponseCodeAffiliationPending, 1, first, day(1), ""},
+		{"due from midnight whatever the hour", ResponseCodeInsufficientFunds, 1, first.Add(15 * time.Hour), day(2), ""},
+		{"max attempts", ResponseCodeInsufficientFunds, 5, first.AddDate(0, 0, 11), time.Time{}, RecurrentGiveUpMaxAttempts},
+		{"past max days", ResponseCodeInsufficientFunds, 3, first.AddDate(0, 0, 12), time.Time{}, RecurrentGiveUpMaxDays},
+		{"on the last day", ResponseCodeInsufficientFunds, 3, first.AddDate(0, 0, 10), day(14), ""},
+		{"affiliation refused gives up at once", ResponseCodeAffiliationRefused, 1, first, time.Time{}, RecurrentGiveUpAffiliationRefused},
+		{"invalid account gives up at once", ResponseCodeInvalidAccount, 1, first, time.Time{}, RecurrentGiveUpInvalidAccount},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			retryAt, giveUp := policy.Next(tc.code, tc.attempts, first, tc.now)
+			if !retryAt.Equal(tc.wantRetryAt) || giveUp != tc.wantGiveUp {
+				t.Fatalf("Next() = (%s, %q), want (%s, %q)", retryAt, giveUp, tc.wantRetryAt, tc.wantGiveUp)
+			}
+		})
+	}
+}
+
+func TestParseRecurrentRetryBackoff(t *testing.T) {
+	days, err := ParseRecurrentRetryBackoff(" 1, 3 ,7")
+	if err != nil || len(days) != 3 || days[0] != 1 || days[1] != 3 || days[2] != 7 {
+		t.Fatalf("ParseRecurrentRetryBackoff() = %v, %v", days, err)
+	}
+	if days, err := ParseRecurrentRetryBackoff(""); err != nil || len(days) != 3 {
+		t.Fatalf("empty: ParseRecurrentRetryBackoff() = %v, %v", days, err)
+	}
+	for _, raw := range []string{"1,x", "0", "1,,2"} {
+		if _, err := ParseRecurrentRetryBackoff(raw); err == nil {
+			t.Errorf("ParseRecurrentRetryBackoff(%q): want error", raw)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package domains
+
+import (
+	"context"
+	"time"
+
+	"appa_payments/internal/models"
+)
+
+// SettlementService keeps daily_settlements, the per-rail summary finance
+// matches against the R4 merchant statement.
+type SettlementService interface {
+	// Settle (re)computes every rail's row for the Caracas day of day.
+	Settle(ctx context.Context, day time.Time) error
+	// SettlePreviousDay settles yesterday. Meant for the daily cron job.
+	SettlePreviousDay(ctx context.Context)
+	List(ctx context.Context, req models.ListSettlementsRequest) (*models.SettlementReport, error)
+}
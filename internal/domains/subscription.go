@@ -0,0 +1,114 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"appa_payments/internal/models"
+)
+
+// Subscription statuses. Only active subscriptions are charged; a cancelled
+// one can't be resumed.
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPaused    = "paused"
+	SubscriptionStatusCancelled = "cancelled"
+)
+
+// Why a subscription was paused: by support, or by the scheduler once the
+// retry policy gave up on a period's charge (a RecurrentGiveUp* reason), or
+// once R4 failed without telling whether it charged.
+const (
+	SubscriptionPauseManual         = "manual"
+	SubscriptionPauseOutcomeUnknown = "charge_outcome_unknown"
+)
+
+// Subscription interval units.
+const (
+	SubscriptionIntervalDay   = "day"
+	SubscriptionIntervalWeek  = "week"
+	SubscriptionIntervalMonth = "month"
+)
+
+// SubscriptionTag is added to every draft order the scheduler creates.
+const SubscriptionTag = "suscripcion"
+
+// SubscriptionLease is how long the scheduler holds a subscription it is
+// charging. Past it, another run may claim the subscription again.
+const SubscriptionLease = 10 * time.Minute
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrSubscriptionStatus   = errors.New("subscription can't change to that status")
+	ErrSubscriptionInterval = errors.New("invalid subscription interval")
+	// ErrSubscriptionNoAffiliation refuses a subscription for a customer
+	// with no affiliated account to charge, or no customer at all.
+	ErrSubscriptionNoAffiliation = errors.New("customer not found or has no affiliated account")
+)
+
+// SubscriptionInterval is how often a subscription is charged: every Count
+// Units.
+type SubscriptionInterval struct {
+	Unit  string
+	Count int
+}
+
+// Validate reports an interval the scheduler can't compute.
+func (i SubscriptionInterval) Validate() error {
+	switch i.Unit {
+	case SubscriptionIntervalDay, SubscriptionIntervalWeek, SubscriptionIntervalMonth:
+	default:
+		return fmt.Errorf("%w: unknown unit %q", ErrSubscriptionInterval, i.Unit)
+	}
+	if i.Count < 1 {
+		return fmt.Errorf("%w: count must be at least 1", ErrSubscriptionInterval)
+	}
+	return nil
+}
+
+// ChargeAt is when period n (0 for the first charge) falls, counted from
+// start so the schedule doesn't drift. A monthly charge on a day the month
+// doesn't have falls on its last day: started Jan 31, Feb 28 then Mar 31.
+func (i SubscriptionInterval) ChargeAt(start time.Time, n int) time.Time {
+	switch i.Unit {
+	case SubscriptionIntervalDay:
+		return start.AddDate(0, 0, n*i.Count)
+	case SubscriptionIntervalWeek:
+		return start.AddDate(0, 0, 7*n*i.Count)
+	}
+
+	year, month, day := start.Date()
+	firstOfMonth := time.Date(year, month+time.Month(n*i.Count), 1,
+		start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return firstOfMonth.AddDate(0, 0, min(day, lastDay)-1)
+}
+
+// NextPeriod is the first period after n that falls after now, and when: a
+// period missed while paused or retrying is skipped, not charged late.
+func (i SubscriptionInterval) NextPeriod(start time.Time, n int, now time.Time) (int, time.Time) {
+	n++
+	at := i.ChargeAt(start, n)
+	for !at.After(now) {
+		n++
+		at = i.ChargeAt(start, n)
+	}
+	return n, at
+}
+
+// SubscriptionService keeps the subscriptions this service charges on its
+// own: support creates and manages them, ChargeDue bills what is due.
+type SubscriptionService interface {
+	Create(ctx context.Context, req models.CreateSubscriptionRequest) (*models.SubscriptionResponse, error)
+	Get(ctx context.Context, id int) (*models.SubscriptionResponse, error)
+	List(ctx context.Context, req models.ListSubscriptionsRequest) (*models.SubscriptionPage, error)
+	Pause(ctx context.Context, id int) (*models.SubscriptionResponse, error)
+	Resume(ctx context.Context, id int) (*models.SubscriptionResponse, error)
+	Cancel(ctx context.Context, id int) (*models.SubscriptionResponse, error)
+	// ChargeDue creates, charges and completes a draft order for every
+	// active subscription whose charge is due, until none is left or ctx is
+	// cancelled.
+	ChargeDue(ctx context.Context)
+}
@@ -0,0 +1,76 @@
+package domains
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionIntervalChargeAt(t *testing.T) {
+	caracas := time.FixedZone("VET", -4*60*60)
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 0, 0, 0, caracas)
+	}
+
+	cases := []struct {
+		name     string
+		interval SubscriptionInterval
+		start    time.Time
+		n        int
+		want     time.Time
+	}{
+		{"first period is the start", SubscriptionInterval{SubscriptionIntervalMonth, 1}, at(2026, 1, 15), 0, at(2026, 1, 15)},
+		{"every 3 days", SubscriptionInterval{SubscriptionIntervalDay, 3}, at(2026, 1, 30), 1, at(2026, 2, 2)},
+		{"every 2 weeks", SubscriptionInterval{SubscriptionIntervalWeek, 2}, at(2026, 1, 1), 2, at(2026, 1, 29)},
+		{"monthly", SubscriptionInterval{SubscriptionIntervalMonth, 1}, at(2026, 1, 15), 13, at(2027, 2, 15)},
+		{"month too short falls on its last day", SubscriptionInterval{SubscriptionIntervalMonth, 1}, at(2026, 1, 31), 1, at(2026, 2, 28)},
+		{"and doesn't drift after it", SubscriptionInterval{SubscriptionIntervalMonth, 1}, at(2026, 1, 31), 2, at(2026, 3, 31)},
+		{"leap year", SubscriptionInterval{SubscriptionIntervalMonth, 1}, at(2028, 1, 30), 1, at(2028, 2, 29)},
+		{"quarterly", SubscriptionInterval{SubscriptionIntervalMonth, 3}, at(2026, 11, 30), 1, at(2027, 2, 28)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.interval.ChargeAt(tc.start, tc.n); !got.Equal(tc.want) {
+				t.Fatalf("ChargeAt(%s, %d) = %s, want %s", tc.start, tc.n, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionIntervalNextPeriod(t *testing.T) {
+	caracas := time.FixedZone("VET", -4*60*60)
+	monthly := SubscriptionInterval{SubscriptionIntervalMonth, 1}
+	start := time.Date(2026, 1, 10, 9, 0, 0, 0, caracas)
+
+	cases := []struct {
+		name   string
+		n      int
+		now    time.Time
+		wantN  int
+		wantAt time.Time
+	}{
+		{"charged on time", 0, start.Add(time.Minute), 1, time.Date(2026, 2, 10, 9, 0, 0, 0, caracas)},
+		{"charged after retries", 0, start.AddDate(0, 0, 12), 1, time.Date(2026, 2, 10, 9, 0, 0, 0, caracas)},
+		{"missed periods are skipped", 1, time.Date(2026, 5, 20, 9, 0, 0, 0, caracas), 5, time.Date(2026, 6, 10, 9, 0, 0, 0, caracas)},
+		{"a period falling now is skipped", 0, time.Date(2026, 2, 10, 9, 0, 0, 0, caracas), 2, time.Date(2026, 3, 10, 9, 0, 0, 0, caracas)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, at := monthly.NextPeriod(start, tc.n, tc.now)
+			if n != tc.wantN || !at.Equal(tc.wantAt) {
+				t.Fatalf("NextPeriod() = (%d, %s), want (%d, %s)", n, at, tc.wantN, tc.wantAt)
+			}
+		})
+	}
+}
+
+func TestSubscriptionIntervalValidate(t *testing.T) {
+	for _, interval := range []SubscriptionInterval{{"year", 1}, {SubscriptionIntervalDay, 0}} {
+		if err := interval.Validate(); !errors.Is(err, ErrSubscriptionInterval) {
+			t.Errorf("Validate(%+v) = %v, want ErrSubscriptionInterval", interval, err)
+		}
+	}
+	if err := (SubscriptionInterval{SubscriptionIntervalWeek, 2}).Validate(); err != nil {
+		t.Errorf("Validate(every 2 weeks) = %v", err)
+	}
+}
@@ -0,0 +1,5 @@
+package domains
+
+// MobilePaymentReversalReasonUnattached marks the refund of a cart charge no
+// order was ever attached to.
+const MobilePaymentReversalReasonUnattached = "UNATTACHED"
@@ -1,7 +1,65 @@
 package domains
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"appa_payments/internal/models"
+)
 
 type WebhookService interface {
 	OrdersCreated(ctx context.Context, orderId string) error
 }
+
+// WebhookTopicOrdersCreated is the topic of Shopify's orders/create webhook.
+const WebhookTopicOrdersCreated = "orders/create"
+
+// Webhook job statuses. A job goes pending -> running -> done, back to
+// pending when it fails with attempts left, or to dead when it has none.
+const (
+	WebhookJobPending = "pending"
+	WebhookJobRunning = "running"
+	WebhookJobDone    = "done"
+	WebhookJobDead    = "dead"
+)
+
+const (
+	// WebhookJobMaxAttempts failures send a job to dead.
+	WebhookJobMaxAttempts = 8
+	// WebhookJobLease is how long a running job stays claimed. A worker that
+	// died mid-job leaves it running; past the lease another one takes it.
+	// Longer than any R4 call.
+	WebhookJobLease = 10 * time.Minute
+
+	webhookJobFirstRetry = time.Minute
+	webhookJobMaxRetry   = time.Hour
+)
+
+// WebhookJobRetryDelay is how long a job that has failed attempts times waits
+// before the next try: a minute, doubling up to an hour.
+func WebhookJobRetryDelay(attempts int) time.Duration {
+	delay := webhookJobFirstRetry
+	for i := 1; i < attempts && delay < webhookJobMaxRetry; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookJobMaxRetry)
+}
+
+// ErrWebhookJobRunning is returned when replaying a job a worker holds.
+var ErrWebhookJobRunning = errors.New("webhook job is running")
+
+// WebhookQueue keeps webhook deliveries in the webhook_jobs table until a
+// worker has processed them.
+type WebhookQueue interface {
+	// Enqueue stores a job for topic and order. A job already queued for the
+	// same pair is left as is, so Shopify's redeliveries don't duplicate it.
+	Enqueue(ctx context.Context, topic, orderID string) error
+	// Replay queues topic and order to run now, as a new job or by resetting
+	// the existing one, whatever its status, unless it is running.
+	Replay(ctx context.Context, topic, orderID string) (*models.WebhookJobResponse, error)
+	// Run claims and processes jobs until ctx is cancelled, then waits for
+	// the jobs in hand to finish.
+	Run(ctx context.Context)
+	List(ctx context.Context, req models.ListWebhookJobsRequest) (*models.WebhookJobPage, error)
+}
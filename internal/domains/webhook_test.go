@@ -0,0 +1,27 @@
+package domains
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookJobRetryDelay(t *testing.T) {
+	cases := []struct {
+		name     string
+		attempts int
+		want     time.Duration
+	}{
+		{"first failure", 1, time.Minute},
+		{"doubles", 2, 2 * time.Minute},
+		{"doubles again", 3, 4 * time.Minute},
+		{"capped at an hour", 7, time.Hour},
+		{"stays capped", 100, time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := WebhookJobRetryDelay(tc.attempts); got != tc.want {
+				t.Fatalf("WebhookJobRetryDelay(%d) = %s, want %s", tc.attempts, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+)
+
+// AffiliationHandler serves the back-office management of a customer's
+// direct debit affiliation.
+type AffiliationHandler struct {
+	Service domains.AffiliationService
+}
+
+// NewAffiliationHandler creates a new AffiliationHandler
+func NewAffiliationHandler(service domains.AffiliationService) *AffiliationHandler {
+	return &AffiliationHandler{Service: service}
+}
+
+// affiliationErrorStatus maps affiliation errors to 404; anything else is
+// 500.
+func affiliationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domains.ErrCustomerNotFound), errors.Is(err, domains.ErrAffiliationNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleGet answers the customer's affiliations against its metafield.
+func (h *AffiliationHandler) HandleGet(c *gin.Context) {
+	resp, err := h.Service.Get(c.Request.Context(), c.Param("customerId"))
+	if err != nil {
+		c.JSON(affiliationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleRevoke clears the customer's affiliated account.
+func (h *AffiliationHandler) HandleRevoke(c *gin.Context) {
+	resp, err := h.Service.Revoke(c.Request.Context(), c.Param("customerId"))
+	if err != nil {
+		c.JSON(affiliationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleReplace puts another account in place of the customer's affiliated
+// one.
+func (h *AffiliationHandler) HandleReplace(c *gin.Context) {
+	var req models.ReplaceAffiliationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.Service.Replace(c.Request.Context(), c.Param("customerId"), req)
+	if err != nil {
+		c.JSON(affiliationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+)
+
+// AuditHandler serves the audit log to support and compliance.
+type AuditHandler struct {
+	Service domains.AuditService
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(service domains.AuditService) *AuditHandler {
+	return &AuditHandler{Service: service}
+}
+
+// HandleList lists audit events, newest first.
+func (h *AuditHandler) HandleList(c *gin.Context) {
+	var req models.ListAuditEventsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.List(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -65,7 +65,7 @@ func (h *CartPaymentHandler) HandlerValidateDirectDebit(c *gin.Context) {
 
 	result, err := h.Service.ValidateDirectDebit(c.Request.Context(), middleware.CartQuoteFrom(c), validateRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(chargeErrorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -82,7 +82,7 @@ func (h *CartPaymentHandler) HandlerValidateMobilePayment(c *gin.Context) {
 
 	result, err := h.Service.ValidateMobilePayment(c.Request.Context(), middleware.CartQuoteFrom(c), validateRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(chargeErrorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -99,7 +99,7 @@ func (h *CartPaymentHandler) HandlerDirectDebitAccount(c *gin.Context) {
 
 	result, err := h.Service.DirectDebitAccount(c.Request.Context(), middleware.CartQuoteFrom(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(chargeErrorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -116,6 +116,9 @@ func (h *CartPaymentHandler) HandlerRequestDirectDebitAccountOTP(c *gin.Context)
 	}
 
 	if err := h.Service.RequestDirectDebitAccountOTP(c.Request.Context(), middleware.CartQuoteFrom(c), req); err != nil {
+		if otpThrottled(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -134,7 +137,7 @@ func (h *CartPaymentHandler) HandlerValidateDirectDebitAccountOTP(c *gin.Context
 
 	result, err := h.Service.ValidateDirectDebitAccountOTP(c.Request.Context(), middleware.CartQuoteFrom(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(chargeErrorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/xlsx"
+)
+
+// exportFlushEvery is how many rows are buffered before they're pushed to
+// the client.
+const exportFlushEvery = 500
+
+// ExportHandler serves finance exports.
+type ExportHandler struct {
+	Service domains.ExportService
+}
+
+// NewExportHandler creates a new ExportHandler
+func NewExportHandler(service domains.ExportService) *ExportHandler {
+	return &ExportHandler{Service: service}
+}
+
+// HandleTransactions streams every money movement in the range as CSV
+// (default) or XLSX. Errors found before the first row answer JSON as usual;
+// after that the status is already sent and the file is cut short.
+func (h *ExportHandler) HandleTransactions(c *gin.Context) {
+	var req models.ExportTransactionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Format == "" {
+		req.Format = domains.ExportFormatCSV
+	}
+
+	var writer transactionWriter
+	started := false
+	err := h.Service.StreamTransactions(c.Request.Context(), req, func(row models.TransactionRow) error {
+		if !started {
+			started = true
+			var err error
+			if writer, err = newTransactionWriter(c, req); err != nil {
+				return err
+			}
+		}
+		return writer.Write(row)
+	})
+	if err == nil && !started {
+		writer, err = newTransactionWriter(c, req)
+	}
+
+	switch {
+	case err == nil:
+		if err := writer.Close(); err != nil {
+			_ = c.Error(err)
+		}
+	case !c.Writer.Written() && errors.Is(err, domains.ErrExportRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case !c.Writer.Written():
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+type transactionWriter interface {
+	Write(row models.TransactionRow) error
+	Close() error
+}
+
+// newTransactionWriter sends the download headers and the column row.
+func newTransactionWriter(c *gin.Context, req models.ExportTransactionsRequest) (transactionWriter, error) {
+	filename := fmt.Sprintf("transacciones_%s_%s.%s", req.From, req.To, req.Format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	if req.Format == domains.ExportFormatXLSX {
+		c.Header("Content-Type", xlsx.ContentType)
+		w, err := xlsx.NewWriter(c.Writer, "Transacciones")
+		if err != nil {
+			return nil, err
+		}
+		header := make([]any, len(models.TransactionColumns))
+		for i, column := range models.TransactionColumns {
+			header[i] = column
+		}
+		if err := w.WriteRow(header...); err != nil {
+			return nil, err
+		}
+		return &xlsxTransactionWriter{w: w, flush: c.Writer}, nil
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(models.TransactionColumns); err != nil {
+		return nil, err
+	}
+	return &csvTransactionWriter{w: w, flush: c.Writer}, nil
+}
+
+type csvTransactionWriter struct {
+	w     *csv.Writer
+	flush http.Flusher
+	rows  int
+}
+
+func (t *csvTransactionWriter) Write(row models.TransactionRow) error {
+	if err := t.w.Write([]string{
+		row.Date.Format(time.RFC3339),
+		row.Rail,
+		row.Movement,
+		row.Reference,
+		formatAmount(row.AmountVES),
+		formatAmount(row.BCVRate),
+		formatAmount(row.AmountUSD),
+		row.OrderID,
+		row.OrderName,
+		row.CartID,
+		row.Customer,
+		row.Status,
+		row.Detail,
+	}); err != nil {
+		return err
+	}
+	t.rows++
+	if t.rows%exportFlushEvery == 0 {
+		t.w.Flush()
+		t.flush.Flush()
+		return t.w.Error()
+	}
+	return nil
+}
+
+func (t *csvTransactionWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+type xlsxTransactionWriter struct {
+	w     *xlsx.Writer
+	flush http.Flusher
+	rows  int
+}
+
+func (t *xlsxTransactionWriter) Write(row models.TransactionRow) error {
+	if err := t.w.WriteRow(
+		row.Date.Format(time.RFC3339),
+		row.Rail,
+		row.Movement,
+		row.Reference,
+		amountCell(row.AmountVES),
+		amountCell(row.BCVRate),
+		amountCell(row.AmountUSD),
+		row.OrderID,
+		row.OrderName,
+		row.CartID,
+		row.Customer,
+		row.Status,
+		row.Detail,
+	); err != nil {
+		return err
+	}
+	t.rows++
+	if t.rows%exportFlushEvery == 0 {
+		if err := t.w.Flush(); err != nil {
+			return err
+		}
+		t.flush.Flush()
+	}
+	return nil
+}
+
+func (t *xlsxTransactionWriter) Close() error {
+	return t.w.Close()
+}
+
+func formatAmount(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// amountCell leaves the cell empty rather than writing a zero.
+func amountCell(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
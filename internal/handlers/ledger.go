@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+)
+
+// LedgerHandler answers balances from the payments ledger.
+type LedgerHandler struct {
+	Service domains.LedgerService
+}
+
+// NewLedgerHandler creates a new LedgerHandler
+func NewLedgerHandler(service domains.LedgerService) *LedgerHandler {
+	return &LedgerHandler{Service: service}
+}
+
+// HandleOrderBalance returns an order's entries and whether they cover its
+// current Shopify total.
+func (h *LedgerHandler) HandleOrderBalance(c *gin.Context) {
+	balance, err := h.Service.OrderBalance(c.Request.Context(), c.Param("orderId"))
+	if err != nil {
+		if errors.Is(err, domains.ErrLedgerOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// HandleCustomerBalance returns what a customer has paid, per order.
+func (h *LedgerHandler) HandleCustomerBalance(c *gin.Context) {
+	balance, err := h.Service.CustomerBalance(c.Request.Context(), c.Param("customerId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
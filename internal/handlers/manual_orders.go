@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/middleware"
+)
+
+// ManualOrderHandler serves the back-office review of manual payments.
+type ManualOrderHandler struct {
+	Service domains.ManualOrderService
+}
+
+// NewManualOrderHandler creates a new ManualOrderHandler
+func NewManualOrderHandler(service domains.ManualOrderService) *ManualOrderHandler {
+	return &ManualOrderHandler{Service: service}
+}
+
+// manualOrderErrorStatus maps review errors to 404/409; anything else is 500.
+func manualOrderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domains.ErrManualOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domains.ErrManualOrderNotPending):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleList lists manual orders, the PENDING queue by default.
+func (h *ManualOrderHandler) HandleList(c *gin.Context) {
+	var req models.ListManualOrdersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.List(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// HandleApprove approves a pending manual order and settles its Shopify order.
+func (h *ManualOrderHandler) HandleApprove(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	resp, err := h.Service.Approve(c.Request.Context(), id, middleware.ActorFrom(c))
+	if err != nil {
+		c.JSON(manualOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleReject rejects a pending manual order and notifies the buyer.
+func (h *ManualOrderHandler) HandleReject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var req models.RejectManualOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.Service.Reject(c.Request.Context(), id, middleware.ActorFrom(c), req)
+	if err != nil {
+		c.JSON(manualOrderErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
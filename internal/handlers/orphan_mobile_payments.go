@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+)
+
+// OrphanMobilePaymentHandler serves the orphaned pago móvil report.
+type OrphanMobilePaymentHandler struct {
+	Service domains.OrphanMobilePaymentService
+}
+
+// NewOrphanMobilePaymentHandler creates a new OrphanMobilePaymentHandler
+func NewOrphanMobilePaymentHandler(service domains.OrphanMobilePaymentService) *OrphanMobilePaymentHandler {
+	return &OrphanMobilePaymentHandler{Service: service}
+}
+
+// HandleReport lists pago móvil rows never matched to an order or cart.
+func (h *OrphanMobilePaymentHandler) HandleReport(c *gin.Context) {
+	var req models.OrphanMobilePaymentsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.Service.Report(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,6 +16,8 @@ import (
 	"appa_payments/internal/domains"
 	"appa_payments/internal/models"
 	"appa_payments/pkg/bcv"
+	"appa_payments/pkg/middleware"
+	"appa_payments/pkg/receipt"
 )
 
 // PaymentHandler handles payment-related HTTP requests
@@ -47,7 +54,7 @@ func (p *PaymentHandler) HandlerGenerateOTP(c *gin.Context) {
 		return
 	}
 
-	err := p.Service.GenerateOTP(context.Background(), otpRequest)
+	err := p.Service.GenerateOTP(context.WithoutCancel(c.Request.Context()), otpRequest)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -64,9 +71,9 @@ func (p *PaymentHandler) HandlerValidateDirectDebit(c *gin.Context) {
 		return
 	}
 
-	err := p.Service.ValidateDirectDebit(context.Background(), validateRequest)
+	err := p.Service.ValidateDirectDebit(context.WithoutCancel(c.Request.Context()), validateRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(chargeErrorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -81,7 +88,11 @@ func (p *PaymentHandler) HandleValidateMobilePayment(c *gin.Context) {
 		return
 	}
 
-	resp := p.Service.ValidateMobilePayment(context.Background(), mobilePaymentRequest)
+	resp := p.Service.ValidateMobilePayment(context.WithoutCancel(c.Request.Context()), mobilePaymentRequest)
+	if resp.Message == domains.PaymentInProgressMessage {
+		c.JSON(http.StatusConflict, resp)
+		return
+	}
 
 	c.JSON(http.StatusOK, resp)
 }
@@ -103,6 +114,9 @@ func (p *PaymentHandler) HandleRequestDirectDebitAccountOTP(c *gin.Context) {
 	}
 
 	if err := p.Service.RequestDirectDebitAccountOTP(c.Request.Context(), orderID, typeOrder); err != nil {
+		if otpThrottled(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -110,6 +124,30 @@ func (p *PaymentHandler) HandleRequestDirectDebitAccountOTP(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "OTP enviado"})
 }
 
+// HandlePaymentStatus returns every attempt to pay an order, its refunds,
+// any pending recurrent retry and the overall state.
+func (p *PaymentHandler) HandlePaymentStatus(c *gin.Context) {
+	orderID := c.Param("orderId")
+	if orderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid orderId"})
+		return
+	}
+
+	var typeOrder *models.OrderType
+	if raw := c.Query("typeOrder"); raw != "" {
+		t := models.OrderType(raw)
+		typeOrder = &t
+	}
+
+	status, err := p.Service.GetPaymentStatus(c.Request.Context(), orderID, models.OrderTypeOrDefault(typeOrder))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
 // HandleDirectDebitAccount handles direct debit account charges (first-time enrollment).
 // Responds with success, an internal error code (ERR0X), or HTTP 500 on infra failure.
 func (p *PaymentHandler) HandleDirectDebitAccount(c *gin.Context) {
@@ -119,9 +157,9 @@ func (p *PaymentHandler) HandleDirectDebitAccount(c *gin.Context) {
 		return
 	}
 
-	resp, err := p.Service.DirectDebitAccount(context.Background(), req)
+	resp, err := p.Service.DirectDebitAccount(context.WithoutCancel(c.Request.Context()), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(chargeErrorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -137,46 +175,56 @@ func (p *PaymentHandler) HandleDirectDebitAccountWithOTP(c *gin.Context) {
 		return
 	}
 
-	resp, err := p.Service.DirectDebitAccountWithOTP(context.Background(), req)
+	resp, err := p.Service.DirectDebitAccountWithOTP(context.WithoutCancel(c.Request.Context()), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(chargeErrorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
-// HandleValidateMobilePaymentManual handles mobile payment validation
-func (p *PaymentHandler) HandleValidateMobilePaymentManual(c *gin.Context) {
-	orderName := c.PostForm("orderName")
+// manualPaymentForm reads the multipart fields every manual-review rail
+// shares. On failure it has already answered 400.
+func manualPaymentForm(c *gin.Context) (orderID, orderName string, file *multipart.FileHeader, typeOrder *models.OrderType, ok bool) {
+	orderName = c.PostForm("orderName")
 	if orderName == "" {
 		fmt.Println("Invalid orderName")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid orderName"})
-		return
+		return "", "", nil, nil, false
 	}
 
-	orderID := c.PostForm("orderId")
+	orderID = c.PostForm("orderId")
 	if orderID == "" {
 		fmt.Println("Invalid orderId")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid orderId"})
-		return
+		return "", "", nil, nil, false
 	}
 
 	file, err := c.FormFile("billImageFile")
 	if err != nil {
 		fmt.Printf("Error retrieving billImageFile: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid billImageFile"})
-		return
+		return "", "", nil, nil, false
 	}
 
-	var typeOrder *models.OrderType
 	if raw := c.PostForm("typeOrder"); raw != "" {
 		t := models.OrderType(raw)
 		typeOrder = &t
 	}
 
-	err = p.Service.ValidateMobilePaymentManual(
-		context.Background(),
+	return orderID, orderName, file, typeOrder, true
+}
+
+// HandleValidateMobilePaymentManual handles mobile payment validation
+func (p *PaymentHandler) HandleValidateMobilePaymentManual(c *gin.Context) {
+	orderID, orderName, file, typeOrder, ok := manualPaymentForm(c)
+	if !ok {
+		return
+	}
+
+	err := p.Service.ValidateMobilePaymentManual(
+		context.WithoutCancel(c.Request.Context()),
 		models.ValidateMobilePaymentManualRequest{
 			OrderName:     orderName,
 			OrderID:       orderID,
@@ -184,9 +232,124 @@ func (p *PaymentHandler) HandleValidateMobilePaymentManual(c *gin.Context) {
 			TypeOrder:     typeOrder,
 		})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(manualPaymentErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Zelle payment validated successfully"})
 }
+
+// HandleValidateZelle registers a Zelle receipt for review
+func (p *PaymentHandler) HandleValidateZelle(c *gin.Context) {
+	orderID, orderName, file, typeOrder, ok := manualPaymentForm(c)
+	if !ok {
+		return
+	}
+
+	err := p.Service.ValidateZelle(
+		context.WithoutCancel(c.Request.Context()),
+		models.ValidateZelle{
+			OrderName:     orderName,
+			OrderID:       orderID,
+			BillImageFile: file,
+			TypeOrder:     typeOrder,
+		})
+	if err != nil {
+		c.JSON(manualPaymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Zelle payment validated successfully"})
+}
+
+// HandleValidateCash registers a cash receipt for review. Besides the shared
+// fields it takes `amount`, `requiresChange` and, when change is due,
+// `returnData` as a JSON object (bank, phone, dni, dniType).
+func (p *PaymentHandler) HandleValidateCash(c *gin.Context) {
+	orderID, orderName, file, typeOrder, ok := manualPaymentForm(c)
+	if !ok {
+		return
+	}
+
+	amount, err := strconv.ParseFloat(c.PostForm("amount"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amount"})
+		return
+	}
+
+	var requiresChange bool
+	if raw := c.PostForm("requiresChange"); raw != "" {
+		if requiresChange, err = strconv.ParseBool(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid requiresChange"})
+			return
+		}
+	}
+
+	var returnData *models.CashReturnData
+	if raw := c.PostForm("returnData"); raw != "" {
+		returnData = &models.CashReturnData{}
+		if err := json.Unmarshal([]byte(raw), returnData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid returnData"})
+			return
+		}
+	}
+
+	err = p.Service.ValidateCash(
+		context.WithoutCancel(c.Request.Context()),
+		models.ValidateCash{
+			Amount:         amount,
+			RequiresChange: requiresChange,
+			BillImageFile:  file,
+			OrderID:        orderID,
+			OrderName:      orderName,
+			ReturnData:     returnData,
+			TypeOrder:      typeOrder,
+		})
+	if err != nil {
+		c.JSON(manualPaymentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cash payment registered successfully"})
+}
+
+// otpThrottled answers 429 with Retry-After and code OTP03 when err is an OTP
+// resend limit, reporting whether it did.
+func otpThrottled(c *gin.Context, err error) bool {
+	var throttled *domains.OTPThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "code": domains.ResponseCodeOTPResendTooSoon})
+	return true
+}
+
+// chargeErrorStatus answers 409 when another charge for the same order or
+// cart is still running, or a recurrent order was already charged. A charge
+// whose outcome R4 didn't answer is still a 500, but its Idempotency-Key is
+// kept so a retry replays it instead of charging again.
+func chargeErrorStatus(c *gin.Context, err error) int {
+	if errors.Is(err, domains.ErrPaymentInProgress) || errors.Is(err, domains.ErrOrderAlreadyCharged) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, domains.ErrChargeOutcomeUnknown) {
+		middleware.KeepIdempotencyKey(c)
+	}
+	return http.StatusInternalServerError
+}
+
+// manualPaymentErrorStatus is 400 for a receipt pkg/receipt refused (type,
+// size, unreadable image) or cash details that don't add up, and 500 for
+// anything else.
+func manualPaymentErrorStatus(err error) int {
+	for _, target := range []error{
+		receipt.ErrEmpty, receipt.ErrTooLarge, receipt.ErrTooManyPixels, receipt.ErrUnsupportedType, receipt.ErrUnreadable,
+		domains.ErrCashAmountInvalid, domains.ErrCashReturnDataRequired,
+	} {
+		if errors.Is(err, target) {
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+)
+
+// RecurrentRetryHandler lets support run the recurrent retry on demand.
+type RecurrentRetryHandler struct {
+	Service domains.RecurrentRetrier
+}
+
+// NewRecurrentRetryHandler creates a new RecurrentRetryHandler
+func NewRecurrentRetryHandler(service domains.RecurrentRetrier) *RecurrentRetryHandler {
+	return &RecurrentRetryHandler{Service: service}
+}
+
+// HandleRetry retries one pending recurrent charge, or all of them, and
+// reports each outcome. Charges take up to a few minutes each, so a run over
+// a large backlog answers slowly; a dry run only reads.
+func (h *RecurrentRetryHandler) HandleRetry(c *gin.Context) {
+	var req models.RecurrentRetryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.Service.Retry(context.WithoutCancel(c.Request.Context()), req)
+	if errors.Is(err, domains.ErrRecurrentPendingNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+)
+
+// SettlementHandler serves the daily settlement report to finance.
+type SettlementHandler struct {
+	Service domains.SettlementService
+}
+
+// NewSettlementHandler creates a new SettlementHandler
+func NewSettlementHandler(service domains.SettlementService) *SettlementHandler {
+	return &SettlementHandler{Service: service}
+}
+
+// HandleList lists stored settlements by day and rail.
+func (h *SettlementHandler) HandleList(c *gin.Context) {
+	var req models.ListSettlementsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.Service.List(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -28,6 +29,10 @@ func (s *StoreHandler) GetOrderByID(c *gin.Context) {
 	}
 
 	order, err := s.Service.GetOrderByID(c.Request.Context(), id)
+	if errors.Is(err, domains.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
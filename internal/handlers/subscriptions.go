@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+)
+
+// SubscriptionHandler serves the back-office management of subscriptions.
+type SubscriptionHandler struct {
+	Service domains.SubscriptionService
+}
+
+// NewSubscriptionHandler creates a new SubscriptionHandler
+func NewSubscriptionHandler(service domains.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{Service: service}
+}
+
+// subscriptionErrorStatus maps subscription errors to 404/409/422; anything
+// else is 500.
+func subscriptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domains.ErrSubscriptionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domains.ErrSubscriptionStatus):
+		return http.StatusConflict
+	case errors.Is(err, domains.ErrSubscriptionNoAffiliation), errors.Is(err, domains.ErrSubscriptionInterval):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleCreate starts a subscription for a customer with an affiliated
+// account.
+func (h *SubscriptionHandler) HandleCreate(c *gin.Context) {
+	var req models.CreateSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.Service.Create(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// HandleList lists subscriptions, newest first.
+func (h *SubscriptionHandler) HandleList(c *gin.Context) {
+	var req models.ListSubscriptionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Service.List(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// HandleGet answers one subscription.
+func (h *SubscriptionHandler) HandleGet(c *gin.Context) {
+	h.handleOne(c, h.Service.Get)
+}
+
+// HandlePause stops charging an active subscription.
+func (h *SubscriptionHandler) HandlePause(c *gin.Context) {
+	h.handleOne(c, h.Service.Pause)
+}
+
+// HandleResume charges a paused subscription again.
+func (h *SubscriptionHandler) HandleResume(c *gin.Context) {
+	h.handleOne(c, h.Service.Resume)
+}
+
+// HandleCancel ends a subscription for good.
+func (h *SubscriptionHandler) HandleCancel(c *gin.Context) {
+	h.handleOne(c, h.Service.Cancel)
+}
+
+func (h *SubscriptionHandler) handleOne(
+	c *gin.Context, action func(ctx context.Context, id int) (*models.SubscriptionResponse, error),
+) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	resp, err := action(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(subscriptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
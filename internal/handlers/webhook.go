@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,56 +12,25 @@ import (
 	"go.uber.org/zap"
 )
 
-const (
-	webhookJobBuffer = 32
-	webhookWorkers   = 4
-)
-
 type WebhookHandler struct {
 	IsRecurrentAppID string
-	WebhookService   domains.WebhookService
-	jobQueue         chan webhookJob
+	Queue            domains.WebhookQueue
 	logger           *zap.Logger
 }
 
-type webhookJob struct {
-	OrderID int
-}
-
-// NewWebhookHandler builds the handler and starts the background worker pool.
-// Workers run for the lifetime of the process.
-func NewWebhookHandler(isRecurrentAppID string, webhookService domains.WebhookService, logger *zap.Logger) *WebhookHandler {
-	h := &WebhookHandler{
+// NewWebhookHandler builds the handler. Jobs are processed by the queue's
+// workers, started separately with Run.
+func NewWebhookHandler(isRecurrentAppID string, queue domains.WebhookQueue, logger *zap.Logger) *WebhookHandler {
+	return &WebhookHandler{
 		IsRecurrentAppID: isRecurrentAppID,
-		WebhookService:   webhookService,
-		jobQueue:         make(chan webhookJob, webhookJobBuffer),
+		Queue:            queue,
 		logger:           logger,
 	}
-	for i := range webhookWorkers {
-		go h.worker(i)
-	}
-	return h
-}
-
-func (h *WebhookHandler) worker(id int) {
-	defer func() {
-		if r := recover(); r != nil {
-			h.logger.Error("webhook worker panicked", zap.Int("workerID", id), zap.Any("panic", r))
-		}
-	}()
-	for job := range h.jobQueue {
-		orderID := strconv.Itoa(job.OrderID)
-		if err := h.WebhookService.OrdersCreated(context.Background(), orderID); err != nil {
-			h.logger.Error("webhook: OrdersCreated returned error",
-				zap.Int("workerID", id),
-				zap.String("orderID", orderID),
-				zap.Error(err))
-		}
-	}
 }
 
-// HandleOrdersCreated binds the Shopify orders/create payload, enqueues a job
-// for asynchronous processing, and always returns 200 so Shopify does not retry.
+// HandleOrdersCreated binds the Shopify orders/create payload and stores a job
+// for asynchronous processing, answering 200 once it is stored. If it can't be
+// stored the answer is 500, so Shopify delivers it again.
 // HMAC validation is performed upstream by the middleware on the route.
 func (h *WebhookHandler) HandleOrdersCreated(c *gin.Context) {
 	var payload models.Webhook
@@ -77,7 +46,52 @@ func (h *WebhookHandler) HandleOrdersCreated(c *gin.Context) {
 		return
 	}
 
-	h.jobQueue <- webhookJob{OrderID: payload.ID}
+	orderID := strconv.Itoa(payload.ID)
+	if err := h.Queue.Enqueue(c.Request.Context(), domains.WebhookTopicOrdersCreated, orderID); err != nil {
+		h.logger.Error("webhook: failed to enqueue job", zap.String("orderID", orderID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not enqueue"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "accepted"})
 }
+
+// HandleReplayOrdersCreated queues an orders/create job for the order to run
+// now, as if Shopify had delivered it again; the worker's dedup check still
+// applies. It answers 202 with the job, or 409 while the order's job runs.
+func (h *WebhookHandler) HandleReplayOrdersCreated(c *gin.Context) {
+	orderID := c.Param("orderId")
+	if _, err := strconv.ParseInt(orderID, 10, 64); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid orderId"})
+		return
+	}
+
+	resp, err := h.Queue.Replay(c.Request.Context(), domains.WebhookTopicOrdersCreated, orderID)
+	if errors.Is(err, domains.ErrWebhookJobRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// HandleListJobs lists webhook jobs, newest first.
+func (h *WebhookHandler) HandleListJobs(c *gin.Context) {
+	var req models.ListWebhookJobsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.Queue.List(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -5,21 +5,51 @@ import (
 
 	"go.uber.org/zap"
 
+	"appa_payments/internal/domains"
 	"appa_payments/internal/services"
 )
 
-// JobHandler wraps scheduled background jobs for cron registration.
+// JobHandler wraps scheduled background jobs for cron registration. Jobs run
+// on ctx: once it is cancelled, the ones that work through a list stop
+// picking up items and finish the one in hand.
 type JobHandler struct {
+	ctx                   context.Context
 	recurrentRetryService *services.RecurrentRetryService
+	reconciliationService *services.ReconciliationService
+	orphanMobilePayments  domains.OrphanMobilePaymentService
+	cartChargeMonitor     *services.CartChargeMonitorService
+	settlementService     domains.SettlementService
+	subscriptions         domains.SubscriptionService
+	idempotency           domains.Idempotency
+	otpStore              domains.OTPStore
+	rateLimiter           domains.RateLimiter
 	logger                *zap.Logger
 }
 
 func NewJobHandler(
+	ctx context.Context,
 	recurrentRetryService *services.RecurrentRetryService,
+	reconciliationService *services.ReconciliationService,
+	orphanMobilePayments domains.OrphanMobilePaymentService,
+	cartChargeMonitor *services.CartChargeMonitorService,
+	settlementService domains.SettlementService,
+	subscriptions domains.SubscriptionService,
+	idempotency domains.Idempotency,
+	otpStore domains.OTPStore,
+	rateLimiter domains.RateLimiter,
 	logger *zap.Logger,
 ) *JobHandler {
 	return &JobHandler{
+		ctx:                   ctx,
 		recurrentRetryService: recurrentRetryService,
+		reconciliationService: reconciliationService,
+		orphanMobilePayments:  orphanMobilePayments,
+		cartChargeMonitor:     cartChargeMonitor,
+		settlementService:     settlementService,
+		subscriptions:         subscriptions,
+		idempotency:           idempotency,
+		otpStore:              otpStore,
+		rateLimiter:           rateLimiter,
 		logger:                logger,
 	}
 }
@@ -28,6 +58,59 @@ func NewJobHandler(
 // direct-debit charges. Signature matches robfig/cron/v3's AddFunc (func()).
 func (h *JobHandler) HandleRetryPendingRecurrentCharges() {
 	h.logger.Info("jobs: starting recurrent pending charges retry")
-	h.recurrentRetryService.RetryPendingCharges(context.Background())
+	h.recurrentRetryService.RetryPendingCharges(h.ctx)
 	h.logger.Info("jobs: finished recurrent pending charges retry")
 }
+
+// HandleChargeSubscriptions charges the subscriptions that are due.
+func (h *JobHandler) HandleChargeSubscriptions() {
+	h.logger.Info("jobs: starting subscriptions charge")
+	h.subscriptions.ChargeDue(h.ctx)
+	h.logger.Info("jobs: finished subscriptions charge")
+}
+
+// HandleReconcile runs the daily reconciliation of R4 records against
+// Shopify order status.
+func (h *JobHandler) HandleReconcile() {
+	h.logger.Info("jobs: starting R4/Shopify reconciliation")
+	h.reconciliationService.Reconcile(h.ctx)
+	h.logger.Info("jobs: finished R4/Shopify reconciliation")
+}
+
+// HandleRefundOrphanMobilePayments reports, and when enabled refunds, pago
+// móvil rows never matched to an order or cart.
+func (h *JobHandler) HandleRefundOrphanMobilePayments() {
+	h.logger.Info("jobs: starting orphan mobile payments refund")
+	h.orphanMobilePayments.RefundOrphans(h.ctx)
+	h.logger.Info("jobs: finished orphan mobile payments refund")
+}
+
+// HandleMonitorUnattachedCartCharges alerts on, and when enabled refunds,
+// cart charges attach-order never linked to an order.
+func (h *JobHandler) HandleMonitorUnattachedCartCharges() {
+	h.logger.Debug("jobs: starting unattached cart charges monitor")
+	h.cartChargeMonitor.Monitor(h.ctx)
+	h.logger.Debug("jobs: finished unattached cart charges monitor")
+}
+
+// HandleSettlePreviousDay stores yesterday's per-rail settlement.
+func (h *JobHandler) HandleSettlePreviousDay() {
+	h.logger.Info("jobs: starting daily settlement")
+	h.settlementService.SettlePreviousDay(h.ctx)
+	h.logger.Info("jobs: finished daily settlement")
+}
+
+// HandlePurgeIdempotencyKeys deletes Idempotency-Key rows past their expiry.
+func (h *JobHandler) HandlePurgeIdempotencyKeys() {
+	h.idempotency.PurgeExpired(h.ctx)
+}
+
+// HandlePurgeOTPCodes deletes expired and used OTP codes.
+func (h *JobHandler) HandlePurgeOTPCodes() {
+	h.otpStore.PurgeExpired(h.ctx)
+}
+
+// HandlePurgeRateLimitCounters deletes rate limit counters of ended windows.
+func (h *JobHandler) HandlePurgeRateLimitCounters() {
+	h.rateLimiter.PurgeExpired(h.ctx)
+}
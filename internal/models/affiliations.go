@@ -0,0 +1,32 @@
+package models
+
+import (
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// ReplaceAffiliationRequest is PUT /admin/customers/:customerId/affiliation:
+// the account and DNI to charge from now on.
+type ReplaceAffiliationRequest struct {
+	Account string `json:"account" binding:"required,numeric,len=20"`
+	DNI     string `json:"dni"     binding:"required"`
+}
+
+// AffiliationMetafield is the customer's direct_debit_account metafield as
+// Shopify has it, account masked.
+type AffiliationMetafield struct {
+	AccountMasked string `json:"accountMasked"`
+	Bank          string `json:"bank"`
+	DNI           string `json:"dni"`
+}
+
+// AffiliationResponse is a customer's affiliations, newest first, with the
+// current one (requested or active) apart. InSync is false when Shopify's
+// metafield isn't the current affiliation's account, or there is a
+// metafield and no current affiliation.
+type AffiliationResponse struct {
+	CustomerID string                 `json:"customerId"`
+	Current    *dbModels.Affiliation  `json:"current"`
+	History    []dbModels.Affiliation `json:"history"`
+	Metafield  *AffiliationMetafield  `json:"metafield"`
+	InSync     bool                   `json:"inSync"`
+}
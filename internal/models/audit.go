@@ -0,0 +1,26 @@
+package models
+
+import (
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// ListAuditEventsRequest filters GET /admin/audit-events. Every filter is
+// optional; dates are Caracas days, inclusive.
+type ListAuditEventsRequest struct {
+	Actor       string `form:"actor"`
+	Action      string `form:"action"`
+	SubjectType string `form:"subjectType"`
+	SubjectID   string `form:"subjectId"`
+	RequestID   string `form:"requestId"`
+	From        string `form:"from"     binding:"omitempty,datetime=2006-01-02"`
+	To          string `form:"to"       binding:"omitempty,datetime=2006-01-02"`
+	Page        int    `form:"page"     binding:"omitempty,min=1"`
+	PageSize    int    `form:"pageSize" binding:"omitempty,min=1,max=100"`
+}
+
+type AuditEventPage struct {
+	Items    []dbModels.AuditEvent `json:"items"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"pageSize"`
+	Total    int64                 `json:"total"`
+}
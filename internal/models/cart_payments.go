@@ -63,10 +63,14 @@ type CartMobilePaymentResult struct {
 	Message   string `json:"message"`
 }
 
+// CartDirectDebitAccountRequest affiliates and charges a new account.
+// ClientID is the buyer's Shopify customer, whose affiliation history the
+// charge is recorded under.
 type CartDirectDebitAccountRequest struct {
-	DNI     string `json:"dni"     binding:"required"`
-	Account string `json:"account" binding:"required,min=20,max=20"`
-	Name    string `json:"name"`
+	ClientID string `json:"clientId" binding:"required"`
+	DNI      string `json:"dni"      binding:"required"`
+	Account  string `json:"account"  binding:"required,min=20,max=20"`
+	Name     string `json:"name"`
 }
 
 type CartDirectDebitAccountResult struct {
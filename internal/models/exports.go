@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ExportTransactionsRequest filters GET /admin/exports/transactions. Dates are
+// Caracas days, inclusive.
+type ExportTransactionsRequest struct {
+	From   string `form:"from"   binding:"required,datetime=2006-01-02"`
+	To     string `form:"to"     binding:"required,datetime=2006-01-02"`
+	Rail   string `form:"rail"   binding:"omitempty,oneof=debito_inmediato pago_movil domiciliacion zelle efectivo pago_movil_manual"`
+	Format string `form:"format" binding:"omitempty,oneof=csv xlsx"`
+}
+
+// TransactionRow is one money movement, whatever table it came from. Refunds
+// are negative. Amounts the source table doesn't carry are converted at that
+// day's BCV rate, and left empty when no rate was recorded for the day.
+type TransactionRow struct {
+	Date      time.Time
+	Rail      string
+	Movement  string
+	Reference string
+	AmountVES *float64
+	BCVRate   *float64
+	AmountUSD *float64
+	OrderID   string
+	OrderName string
+	CartID    string
+	Customer  string
+	Status    string
+	Detail    string
+}
+
+// TransactionColumns names TransactionRow's fields, in export order.
+var TransactionColumns = []string{
+	"date", "rail", "movement", "reference", "amount_ves", "bcv_rate", "amount_usd",
+	"order_id", "order_name", "cart_id", "customer", "status", "detail",
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// OrderBalance answers "is this order fully paid?" from the ledger. Paid
+// amounts are net of refunds and excess returned.
+type OrderBalance struct {
+	OrderID   string                 `json:"orderId"`
+	OrderName string                 `json:"orderName"`
+	TotalUSD  float64                `json:"totalUsd"`
+	PaidVES   float64                `json:"paidVes"`
+	PaidUSD   float64                `json:"paidUsd"`
+	DueUSD    float64                `json:"dueUsd"`
+	FullyPaid bool                   `json:"fullyPaid"`
+	Entries   []dbModels.LedgerEntry `json:"entries"`
+}
+
+type CustomerBalance struct {
+	CustomerID string                 `json:"customerId"`
+	PaidVES    float64                `json:"paidVes"`
+	PaidUSD    float64                `json:"paidUsd"`
+	Orders     []CustomerOrderBalance `json:"orders"`
+}
+
+// CustomerOrderBalance is what a customer paid towards one order, or one
+// cart that never became an order (OrderID empty).
+type CustomerOrderBalance struct {
+	OrderID   string  `json:"orderId,omitempty"`
+	OrderName string  `json:"orderName,omitempty"`
+	CartID    string  `json:"cartId,omitempty"`
+	PaidVES   float64 `json:"paidVes"`
+	PaidUSD   float64 `json:"paidUsd"`
+}
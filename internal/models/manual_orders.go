@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// ListManualOrdersRequest filters GET /admin/manual-orders. Status defaults
+// to PENDING, the review queue.
+type ListManualOrdersRequest struct {
+	Status          string `form:"status"`
+	PaymentMethodID int    `form:"paymentMethodId"`
+	OrderName       string `form:"orderName"`
+	From            string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To              string `form:"to"   binding:"omitempty,datetime=2006-01-02"`
+	DuplicatesOnly  bool   `form:"duplicatesOnly"`
+	Page            int    `form:"page"     binding:"omitempty,min=1"`
+	PageSize        int    `form:"pageSize" binding:"omitempty,min=1,max=100"`
+}
+
+type ManualOrderPage struct {
+	Items    []dbModels.ManualOrder `json:"items"`
+	Page     int                    `json:"page"`
+	PageSize int                    `json:"pageSize"`
+	Total    int64                  `json:"total"`
+}
+
+type RejectManualOrderRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ManualOrderReviewResponse is the reviewed row plus, on approval, the order
+// it settled — a different id from the row's when a draft was completed.
+type ManualOrderReviewResponse struct {
+	ManualOrder     dbModels.ManualOrder `json:"manualOrder"`
+	OrderID         string               `json:"orderId,omitempty"`
+	OrderName       string               `json:"orderName,omitempty"`
+	FinancialStatus string               `json:"financialStatus,omitempty"`
+	ReviewedAt      time.Time            `json:"reviewedAt"`
+	Change          *CashChange          `json:"change,omitempty"`
+}
+
+// CashChange is the vuelto sent by pago móvil when a cash order paid with
+// more than its total is approved.
+type CashChange struct {
+	AmountUSD float64 `json:"amountUsd"`
+	AmountVES float64 `json:"amountVes"`
+	Sent      bool    `json:"sent"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// FinalizedOrder is what settling an order in Shopify leaves behind. Empty
+// fields mean a complete order, which keeps the id it was settled under.
+type FinalizedOrder struct {
+	OrderID         string `json:"orderId,omitempty"`
+	OrderName       string `json:"orderName,omitempty"`
+	StatusPageURL   string `json:"statusPageUrl,omitempty"`
+	FinancialStatus string `json:"financialStatus,omitempty"`
+}
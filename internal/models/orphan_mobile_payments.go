@@ -0,0 +1,26 @@
+package models
+
+import (
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// OrphanMobilePaymentsRequest filters GET /admin/orphan-mobile-payments.
+type OrphanMobilePaymentsRequest struct {
+	Days            int  `form:"days" binding:"omitempty,min=1"`
+	IncludeRefunded bool `form:"includeRefunded"`
+}
+
+// OrphanMobilePayment is an unmatched pago móvil row plus the error of its
+// last failed automatic refund and the sender's DNI, when known.
+type OrphanMobilePayment struct {
+	dbModels.R4AppaMobilePayment
+	RefundError string `json:"refundError,omitempty"`
+	SenderDNI   string `json:"senderDni,omitempty"`
+}
+
+type OrphanMobilePaymentReport struct {
+	Days int `json:"days"`
+	// PendingAmount sums the rows not refunded yet, in bolívares.
+	PendingAmount float64               `json:"pendingAmount"`
+	Items         []OrphanMobilePayment `json:"items"`
+}
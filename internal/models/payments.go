@@ -2,6 +2,9 @@ package models
 
 import (
 	"mime/multipart"
+	"time"
+
+	dbModels "appa_payments/pkg/db/models"
 )
 
 type BCVTasaUSDResponse struct {
@@ -52,7 +55,10 @@ type ValidateOTPRequest struct {
 	TypeOrder *OrderType `json:"typeOrder,omitempty"`
 }
 
-// ValidateCash para pagos en efectivo
+// ValidateCash para pagos en efectivo. Amount is the USD handed over; when it
+// exceeds the order total and RequiresChange is set, the difference is
+// returned in bolívares by pago móvil to ReturnData once the receipt is
+// approved.
 type ValidateCash struct {
 	Amount         float64               `json:"amount"`
 	RequiresChange bool                  `json:"requiresChange"`
@@ -60,6 +66,7 @@ type ValidateCash struct {
 	OrderID        string                `json:"orderId"`
 	OrderName      string                `json:"orderName"`
 	ReturnData     *CashReturnData       `json:"returnData,omitempty"`
+	TypeOrder      *OrderType            `json:"typeOrder,omitempty"`
 }
 
 // CashReturnData representa los datos necesarios para la devolución en efectivo
@@ -70,10 +77,16 @@ type CashReturnData struct {
 	DNIType string `json:"dniType"`
 }
 
+// Complete reports whether every pago móvil field the change needs is set.
+func (d *CashReturnData) Complete() bool {
+	return d != nil && d.Bank != "" && d.Phone != "" && d.DNI != "" && d.DNIType != ""
+}
+
 type ValidateZelle struct {
 	BillImageFile *multipart.FileHeader `json:"billImageFile"`
 	OrderID       string                `json:"orderId"`
 	OrderName     string                `json:"orderName"`
+	TypeOrder     *OrderType            `json:"typeOrder,omitempty"`
 }
 
 type ValidateMobilePaymentRequest struct {
@@ -133,3 +146,32 @@ type DirectDebitAccount struct {
 	Account string `json:"account"`
 	DNI     string `json:"dni"`
 }
+
+// PaymentStatusResponse is everything known about paying one order or
+// draft, answered by GET /payments/status/:orderId.
+type PaymentStatusResponse struct {
+	OrderID   string    `json:"orderId"`
+	OrderName string    `json:"orderName"`
+	OrderType OrderType `json:"orderType"`
+	AmountUSD string    `json:"amountUsd"`
+	// FinancialStatus is Shopify's; empty for a draft.
+	FinancialStatus string `json:"financialStatus,omitempty"`
+	// State is one of domains.PaymentState*.
+	State        string                                 `json:"state"`
+	Attempts     []PaymentAttempt                       `json:"attempts"`
+	Refunds      []dbModels.R4AppaMobilePaymentReversal `json:"refunds"`
+	PendingRetry *dbModels.RecurrentPendingPayment      `json:"pendingRetry,omitempty"`
+}
+
+// PaymentAttempt is one charge on any rail. Code is the R4 code, or the
+// review status for a manual receipt.
+type PaymentAttempt struct {
+	Rail       string     `json:"rail"`
+	Reference  string     `json:"reference,omitempty"`
+	Code       string     `json:"code,omitempty"`
+	Success    bool       `json:"success"`
+	AmountVES  *float64   `json:"amountVes,omitempty"`
+	AmountUSD  *float64   `json:"amountUsd,omitempty"`
+	RefundedAt *time.Time `json:"refundedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,38 @@
+package models
+
+// What the recurrent retry did, or would do in a dry run, with one pending
+// charge.
+const (
+	RecurrentRetryCharged        = "charged"
+	RecurrentRetryDeclined       = "declined"
+	RecurrentRetryGaveUp         = "gave_up"
+	RecurrentRetryAlreadyCharged = "already_charged"
+	RecurrentRetryNotPending     = "not_pending"
+	RecurrentRetryError          = "error"
+	RecurrentRetryWouldCharge    = "would_charge"
+)
+
+// RecurrentRetryRequest is the body of POST /admin/recurrent/retry. An empty
+// OrderID retries every pending charge.
+type RecurrentRetryRequest struct {
+	OrderID string `json:"orderId"`
+	DryRun  bool   `json:"dryRun"`
+}
+
+// RecurrentRetryResult is the outcome for one pending charge. Code is R4's
+// decline, mapped; FinancialStatus is Shopify's when the order was no longer
+// pending.
+type RecurrentRetryResult struct {
+	OrderID         string `json:"orderId"`
+	OrderName       string `json:"orderName"`
+	Outcome         string `json:"outcome"`
+	Code            string `json:"code,omitempty"`
+	GiveUpReason    string `json:"giveUpReason,omitempty"`
+	FinancialStatus string `json:"financialStatus,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+type RecurrentRetryReport struct {
+	DryRun  bool                   `json:"dryRun"`
+	Results []RecurrentRetryResult `json:"results"`
+}
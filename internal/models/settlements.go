@@ -0,0 +1,19 @@
+package models
+
+import (
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// ListSettlementsRequest filters GET /admin/settlements. Dates are Caracas
+// days, inclusive.
+type ListSettlementsRequest struct {
+	From string `form:"from" binding:"required,datetime=2006-01-02"`
+	To   string `form:"to"   binding:"required,datetime=2006-01-02"`
+	Rail string `form:"rail" binding:"omitempty,oneof=debito_inmediato pago_movil domiciliacion zelle efectivo pago_movil_manual"`
+}
+
+type SettlementReport struct {
+	From  string                     `json:"from"`
+	To    string                     `json:"to"`
+	Items []dbModels.DailySettlement `json:"items"`
+}
@@ -10,6 +10,7 @@ type OrderResponse struct {
 	DisplayFulfillmentStatus           string              `json:"displayFulfillmentStatus"`
 	TotalPriceSetUSD                   OrderPrice          `json:"totalPriceSetUSD"`
 	TotalPriceSetVES                   OrderPrice          `json:"totalPriceSetVES"`
+	IGTF                               []IGTF              `json:"igtf,omitempty"`
 	LineItems                          []LineItem          `json:"lineItems"`
 	Customer                           Customer            `json:"customer"`
 	DebitDirect                        *DebitDirect        `json:"debitDirect,omitempty"`
@@ -30,6 +31,15 @@ type OrderPrice struct {
 	CurrencyCode string `json:"currencyCode"`
 }
 
+// IGTF is the foreign-currency tax a payment method adds on top of the order
+// total, and the total the buyer pays with it. Amounts are in USD.
+type IGTF struct {
+	PaymentMethodID int        `json:"paymentMethodId"`
+	Rate            float64    `json:"rate"`
+	Amount          OrderPrice `json:"amount"`
+	Total           OrderPrice `json:"total"`
+}
+
 // LineItem represents an item in an order
 type LineItem struct {
 	Name     string `json:"name"`
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// SubscriptionLineItem is a product variant, by numeric id or GID, and how
+// many of it every period's order carries.
+type SubscriptionLineItem struct {
+	VariantID string `json:"variantId" binding:"required"`
+	Quantity  int    `json:"quantity"  binding:"required,min=1"`
+}
+
+// CreateSubscriptionRequest is POST /admin/subscriptions. The first charge
+// is at StartsAt, or at the next scheduler run when it's omitted.
+type CreateSubscriptionRequest struct {
+	CustomerID    string                 `json:"customerId"    binding:"required"`
+	LineItems     []SubscriptionLineItem `json:"lineItems"     binding:"required,min=1,dive"`
+	IntervalUnit  string                 `json:"intervalUnit"  binding:"required,oneof=day week month"`
+	IntervalCount int                    `json:"intervalCount" binding:"required,min=1"`
+	StartsAt      *time.Time             `json:"startsAt"`
+}
+
+// ListSubscriptionsRequest filters GET /admin/subscriptions. Every filter is
+// optional.
+type ListSubscriptionsRequest struct {
+	Status     string `form:"status"     binding:"omitempty,oneof=active paused cancelled"`
+	CustomerID string `form:"customerId"`
+	Page       int    `form:"page"       binding:"omitempty,min=1"`
+	PageSize   int    `form:"pageSize"   binding:"omitempty,min=1,max=100"`
+}
+
+type SubscriptionPage struct {
+	Items    []dbModels.Subscription `json:"items"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"pageSize"`
+	Total    int64                   `json:"total"`
+}
+
+// SubscriptionResponse answers every /admin/subscriptions route that acts on
+// one subscription.
+type SubscriptionResponse struct {
+	Subscription dbModels.Subscription `json:"subscription"`
+}
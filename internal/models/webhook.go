@@ -1,5 +1,9 @@
 package models
 
+import (
+	dbModels "appa_payments/pkg/db/models"
+)
+
 // Webhook is the minimal Shopify orders/create payload shape used by the
 // webhook handler. Only the order ID is consumed: the handler enqueues a job
 // that re-fetches the full order from Shopify before processing it.
@@ -7,3 +11,25 @@ type Webhook struct {
 	ID    int `json:"id"`
 	AppID int `json:"app_id"`
 }
+
+// ListWebhookJobsRequest filters GET /admin/webhooks/jobs. Every filter is
+// optional.
+type ListWebhookJobsRequest struct {
+	Status   string `form:"status"   binding:"omitempty,oneof=pending running done dead"`
+	Topic    string `form:"topic"`
+	OrderID  string `form:"orderId"`
+	Page     int    `form:"page"     binding:"omitempty,min=1"`
+	PageSize int    `form:"pageSize" binding:"omitempty,min=1,max=100"`
+}
+
+type WebhookJobPage struct {
+	Items    []dbModels.WebhookJob `json:"items"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"pageSize"`
+	Total    int64                 `json:"total"`
+}
+
+// WebhookJobResponse answers POST /admin/webhooks/orders-created/:orderId/replay.
+type WebhookJobResponse struct {
+	Job dbModels.WebhookJob `json:"job"`
+}
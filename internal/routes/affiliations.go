@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// AffiliationRoutes defines the back-office routes for direct debit
+// affiliations
+type AffiliationRoutes struct {
+	Handler *handlers.AffiliationHandler
+	Auth    domains.Authenticator
+}
+
+// NewAffiliationRoutes creates a new instance of AffiliationRoutes
+func NewAffiliationRoutes(handler *handlers.AffiliationHandler, auth domains.Authenticator) *AffiliationRoutes {
+	return &AffiliationRoutes{Handler: handler, Auth: auth}
+}
+
+// SetRouter sets up the affiliation routes for support.
+func (r *AffiliationRoutes) SetRouter(router *gin.Engine) {
+	adminRouter := router.Group("/admin/customers/:customerId/affiliation")
+	{
+		adminRouter.GET("", r.Auth.Require(domains.RoleSupport), r.Handler.HandleGet)
+		adminRouter.PUT("", r.Auth.Require(domains.RoleSupport), r.Handler.HandleReplace)
+		adminRouter.POST("/revoke", r.Auth.Require(domains.RoleSupport), r.Handler.HandleRevoke)
+	}
+}
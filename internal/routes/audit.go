@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// AuditRoutes defines the audit log query route
+type AuditRoutes struct {
+	Handler *handlers.AuditHandler
+	Auth    domains.Authenticator
+}
+
+// NewAuditRoutes creates a new instance of AuditRoutes
+func NewAuditRoutes(handler *handlers.AuditHandler, auth domains.Authenticator) *AuditRoutes {
+	return &AuditRoutes{Handler: handler, Auth: auth}
+}
+
+// SetRouter sets up the audit log route for support and finance.
+func (a *AuditRoutes) SetRouter(router *gin.Engine) {
+	router.GET("/admin/audit-events", a.Auth.Require(domains.RoleSupport, domains.RoleFinance), a.Handler.HandleList)
+}
@@ -8,28 +8,45 @@ import (
 )
 
 type CartPaymentRoutes struct {
-	Handler   *handlers.CartPaymentHandler
-	CartQuote domains.CartQuoteRepository
+	Handler     *handlers.CartPaymentHandler
+	CartQuote   domains.CartQuoteRepository
+	Idempotency domains.Idempotency
+	RateLimiter domains.RateLimiter
 }
 
 // NewCartPaymentRoutes creates a new instance of CartPaymentRoutes
 func NewCartPaymentRoutes(
 	handler *handlers.CartPaymentHandler,
 	cartQuote domains.CartQuoteRepository,
+	idempotency domains.Idempotency,
+	rateLimiter domains.RateLimiter,
 ) *CartPaymentRoutes {
-	return &CartPaymentRoutes{Handler: handler, CartQuote: cartQuote}
+	return &CartPaymentRoutes{Handler: handler, CartQuote: cartQuote, Idempotency: idempotency, RateLimiter: rateLimiter}
 }
 
-// SetRouter sets up the cart payment-related routes.
+// SetRouter sets up the cart payment-related routes. The browser-facing ones
+// are rate limited, counting the cart id as the order; the ones that move
+// money honor Idempotency-Key.
 func (c *CartPaymentRoutes) SetRouter(router *gin.Engine) {
+	idempotent := c.Idempotency.Handler()
+	limit := c.RateLimiter.Handler
+	const (
+		ip    = domains.RateLimitByIP
+		dni   = domains.RateLimitByDNI
+		phone = domains.RateLimitByPhone
+		cart  = domains.RateLimitByOrder
+	)
+	otp := domains.RateLimitGroupOTP
+	charge := domains.RateLimitGroupCharge
+
 	cartRouter := router.Group("/cart-payments", c.CartQuote.Handler())
 	{
-		cartRouter.POST("/generate-otp", c.Handler.HandlerGenerateOTP)
-		cartRouter.POST("/validate-direct-debit", c.Handler.HandlerValidateDirectDebit)
-		cartRouter.POST("/validate-mobile-payment", c.Handler.HandlerValidateMobilePayment)
+		cartRouter.POST("/generate-otp", limit(otp, ip, dni, phone, cart), c.Handler.HandlerGenerateOTP)
+		cartRouter.POST("/validate-direct-debit", limit(charge, ip, dni, phone, cart), idempotent, c.Handler.HandlerValidateDirectDebit)
+		cartRouter.POST("/validate-mobile-payment", limit(charge, ip, dni, phone, cart), idempotent, c.Handler.HandlerValidateMobilePayment)
 		cartRouter.POST("/attach-order", c.Handler.HandlerAttachOrder)
-		cartRouter.POST("/direct-debit-account", c.Handler.HandlerDirectDebitAccount)
-		cartRouter.POST("/direct-debit-account/request-otp", c.Handler.HandlerRequestDirectDebitAccountOTP)
-		cartRouter.POST("/direct-debit-account/otp", c.Handler.HandlerValidateDirectDebitAccountOTP)
+		cartRouter.POST("/direct-debit-account", limit(charge, ip, dni, cart), idempotent, c.Handler.HandlerDirectDebitAccount)
+		cartRouter.POST("/direct-debit-account/request-otp", limit(otp, ip, cart), c.Handler.HandlerRequestDirectDebitAccountOTP)
+		cartRouter.POST("/direct-debit-account/otp", limit(charge, ip, cart), idempotent, c.Handler.HandlerValidateDirectDebitAccountOTP)
 	}
 }
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// ExportRoutes defines the finance export and settlement routes
+type ExportRoutes struct {
+	Handler           *handlers.ExportHandler
+	SettlementHandler *handlers.SettlementHandler
+	Auth              domains.Authenticator
+}
+
+// NewExportRoutes creates a new instance of ExportRoutes
+func NewExportRoutes(
+	handler *handlers.ExportHandler,
+	settlementHandler *handlers.SettlementHandler,
+	auth domains.Authenticator,
+) *ExportRoutes {
+	return &ExportRoutes{Handler: handler, SettlementHandler: settlementHandler, Auth: auth}
+}
+
+// SetRouter sets up the export and settlement routes for finance.
+func (e *ExportRoutes) SetRouter(router *gin.Engine) {
+	router.GET("/admin/exports/transactions", e.Auth.Require(domains.RoleFinance), e.Handler.HandleTransactions)
+	router.GET("/admin/settlements", e.Auth.Require(domains.RoleFinance), e.SettlementHandler.HandleList)
+}
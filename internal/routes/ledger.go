@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// LedgerRoutes defines the ledger balance routes
+type LedgerRoutes struct {
+	Handler *handlers.LedgerHandler
+	Auth    domains.Authenticator
+}
+
+// NewLedgerRoutes creates a new instance of LedgerRoutes
+func NewLedgerRoutes(handler *handlers.LedgerHandler, auth domains.Authenticator) *LedgerRoutes {
+	return &LedgerRoutes{Handler: handler, Auth: auth}
+}
+
+// SetRouter sets up the order and customer balances for support and finance.
+func (l *LedgerRoutes) SetRouter(router *gin.Engine) {
+	router.GET("/admin/ledger/orders/:orderId", l.Auth.Require(domains.RoleSupport, domains.RoleFinance), l.Handler.HandleOrderBalance)
+	router.GET("/admin/ledger/customers/:customerId", l.Auth.Require(domains.RoleSupport, domains.RoleFinance), l.Handler.HandleCustomerBalance)
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// ManualOrderRoutes defines the back-office routes for manual payments
+type ManualOrderRoutes struct {
+	Handler *handlers.ManualOrderHandler
+	Auth    domains.Authenticator
+}
+
+// NewManualOrderRoutes creates a new instance of ManualOrderRoutes
+func NewManualOrderRoutes(handler *handlers.ManualOrderHandler, auth domains.Authenticator) *ManualOrderRoutes {
+	return &ManualOrderRoutes{Handler: handler, Auth: auth}
+}
+
+// SetRouter sets up the manual order review routes. Support and finance can
+// see the queue; only finance settles it.
+func (m *ManualOrderRoutes) SetRouter(router *gin.Engine) {
+	adminRouter := router.Group("/admin/manual-orders")
+	{
+		adminRouter.GET("", m.Auth.Require(domains.RoleSupport, domains.RoleFinance), m.Handler.HandleList)
+		adminRouter.POST("/:id/approve", m.Auth.Require(domains.RoleFinance), m.Handler.HandleApprove)
+		adminRouter.POST("/:id/reject", m.Auth.Require(domains.RoleFinance), m.Handler.HandleReject)
+	}
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// OrphanMobilePaymentRoutes defines the orphaned pago móvil report route
+type OrphanMobilePaymentRoutes struct {
+	Handler *handlers.OrphanMobilePaymentHandler
+	Auth    domains.Authenticator
+}
+
+// NewOrphanMobilePaymentRoutes creates a new instance of OrphanMobilePaymentRoutes
+func NewOrphanMobilePaymentRoutes(handler *handlers.OrphanMobilePaymentHandler, auth domains.Authenticator) *OrphanMobilePaymentRoutes {
+	return &OrphanMobilePaymentRoutes{Handler: handler, Auth: auth}
+}
+
+// SetRouter sets up the orphaned pago móvil report for support and finance.
+func (o *OrphanMobilePaymentRoutes) SetRouter(router *gin.Engine) {
+	router.GET("/admin/orphan-mobile-payments", o.Auth.Require(domains.RoleSupport, domains.RoleFinance), o.Handler.HandleReport)
+}
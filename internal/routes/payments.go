@@ -3,27 +3,50 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 
+	"appa_payments/internal/domains"
 	"appa_payments/internal/handlers"
 )
 
 // PaymentRoutes struct to hold payment-related routes
 type PaymentRoute struct {
-	Handler *handlers.PaymentHandler
+	Handler     *handlers.PaymentHandler
+	Idempotency domains.Idempotency
+	RateLimiter domains.RateLimiter
 }
 
 // NewPaymentRoutes creates a new instance of PaymentRoutes
-func NewPaymentRoute(handler *handlers.PaymentHandler) *PaymentRoute {
-	return &PaymentRoute{Handler: handler}
+func NewPaymentRoute(
+	handler *handlers.PaymentHandler,
+	idempotency domains.Idempotency,
+	rateLimiter domains.RateLimiter,
+) *PaymentRoute {
+	return &PaymentRoute{Handler: handler, Idempotency: idempotency, RateLimiter: rateLimiter}
 }
 
-// SetRouter sets up the payment-related routes
+// SetRouter sets up the payment-related routes. Every one is rate limited;
+// the ones that move money honor Idempotency-Key.
 func (p *PaymentRoute) SetRouter(router gin.IRoutes) {
-	router.GET("/payments/bcv-tasa", p.Handler.GetBCVTasa)
-	router.POST("/payments/generate-otp", p.Handler.HandlerGenerateOTP)
-	router.POST("/payments/validate-direct-debit", p.Handler.HandlerValidateDirectDebit)
-	router.POST("/payments/validate-mobile-payment", p.Handler.HandleValidateMobilePayment)
-	router.POST("/payments/validate-mobile-payment-manual", p.Handler.HandleValidateMobilePaymentManual)
-	router.POST("/payments/direct-debit-account", p.Handler.HandleDirectDebitAccount)
-	router.GET("/payments/direct-debit-account/otp/:orderId", p.Handler.HandleRequestDirectDebitAccountOTP)
-	router.POST("/payments/direct-debit-account/otp", p.Handler.HandleDirectDebitAccountWithOTP)
+	idempotent := p.Idempotency.Handler()
+	limit := p.RateLimiter.Handler
+	const (
+		ip    = domains.RateLimitByIP
+		dni   = domains.RateLimitByDNI
+		phone = domains.RateLimitByPhone
+		order = domains.RateLimitByOrder
+	)
+	lookup := domains.RateLimitGroupLookup
+	otp := domains.RateLimitGroupOTP
+	charge := domains.RateLimitGroupCharge
+
+	router.GET("/payments/bcv-tasa", limit(lookup, ip), p.Handler.GetBCVTasa)
+	router.GET("/payments/status/:orderId", limit(lookup, ip, order), p.Handler.HandlePaymentStatus)
+	router.POST("/payments/generate-otp", limit(otp, ip, dni, phone, order), p.Handler.HandlerGenerateOTP)
+	router.POST("/payments/validate-direct-debit", limit(charge, ip, dni, phone, order), idempotent, p.Handler.HandlerValidateDirectDebit)
+	router.POST("/payments/validate-mobile-payment", limit(charge, ip, dni, phone, order), idempotent, p.Handler.HandleValidateMobilePayment)
+	router.POST("/payments/validate-mobile-payment-manual", limit(charge, ip, order), p.Handler.HandleValidateMobilePaymentManual)
+	router.POST("/payments/validate-cash", limit(charge, ip, order), p.Handler.HandleValidateCash)
+	router.POST("/payments/validate-zelle", limit(charge, ip, order), p.Handler.HandleValidateZelle)
+	router.POST("/payments/direct-debit-account", limit(charge, ip, dni, order), idempotent, p.Handler.HandleDirectDebitAccount)
+	router.GET("/payments/direct-debit-account/otp/:orderId", limit(otp, ip, order), p.Handler.HandleRequestDirectDebitAccountOTP)
+	router.POST("/payments/direct-debit-account/otp", limit(charge, ip, order), idempotent, p.Handler.HandleDirectDebitAccountWithOTP)
 }
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// RecurrentRetryRoutes defines the on-demand recurrent retry route
+type RecurrentRetryRoutes struct {
+	Handler *handlers.RecurrentRetryHandler
+	Auth    domains.Authenticator
+}
+
+// NewRecurrentRetryRoutes creates a new instance of RecurrentRetryRoutes
+func NewRecurrentRetryRoutes(handler *handlers.RecurrentRetryHandler, auth domains.Authenticator) *RecurrentRetryRoutes {
+	return &RecurrentRetryRoutes{Handler: handler, Auth: auth}
+}
+
+// SetRouter sets up the recurrent retry route for support.
+func (r *RecurrentRetryRoutes) SetRouter(router *gin.Engine) {
+	router.POST("/admin/recurrent/retry", r.Auth.Require(domains.RoleSupport), r.Handler.HandleRetry)
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"appa_payments/internal/domains"
 	"appa_payments/internal/handlers"
 
 	"github.com/gin-gonic/gin"
@@ -8,17 +9,22 @@ import (
 
 // StoreRoute defines the routes for the store
 type StoreRoute struct {
-	Handler *handlers.StoreHandler
+	Handler     *handlers.StoreHandler
+	Auth        domains.Authenticator
+	RateLimiter domains.RateLimiter
 }
 
 // NewStoreRoute creates a new StoreRoute
-func NewStoreRoute(handler *handlers.StoreHandler) *StoreRoute {
-	return &StoreRoute{Handler: handler}
+func NewStoreRoute(handler *handlers.StoreHandler, auth domains.Authenticator, rateLimiter domains.RateLimiter) *StoreRoute {
+	return &StoreRoute{Handler: handler, Auth: auth, RateLimiter: rateLimiter}
 }
 
-// SetRouter sets up the routes for the store
+// SetRouter sets up the routes for the store. The public order lookups are
+// rate limited by IP; rewriting a customer's DNI needs a support key.
 func (s *StoreRoute) SetRouter(router *gin.Engine) {
-	router.GET("/orders/:id", s.Handler.GetOrderByID)
-	router.GET("/orders/confirmation/:name", s.Handler.GetOrderByName)
-	router.PUT("/customers/parent", s.Handler.HandleUpdateCustomerParentID)
+	lookup := s.RateLimiter.Handler(domains.RateLimitGroupLookup, domains.RateLimitByIP)
+
+	router.GET("/orders/:id", lookup, s.Handler.GetOrderByID)
+	router.GET("/orders/confirmation/:name", lookup, s.Handler.GetOrderByName)
+	router.PUT("/customers/parent", s.Auth.Require(domains.RoleSupport), s.Handler.HandleUpdateCustomerParentID)
 }
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/handlers"
+)
+
+// SubscriptionRoutes defines the back-office routes for subscriptions
+type SubscriptionRoutes struct {
+	Handler *handlers.SubscriptionHandler
+	Auth    domains.Authenticator
+}
+
+// NewSubscriptionRoutes creates a new instance of SubscriptionRoutes
+func NewSubscriptionRoutes(handler *handlers.SubscriptionHandler, auth domains.Authenticator) *SubscriptionRoutes {
+	return &SubscriptionRoutes{Handler: handler, Auth: auth}
+}
+
+// SetRouter sets up the subscription routes for support.
+func (r *SubscriptionRoutes) SetRouter(router *gin.Engine) {
+	adminRouter := router.Group("/admin/subscriptions")
+	{
+		adminRouter.POST("", r.Auth.Require(domains.RoleSupport), r.Handler.HandleCreate)
+		adminRouter.GET("", r.Auth.Require(domains.RoleSupport), r.Handler.HandleList)
+		adminRouter.GET("/:id", r.Auth.Require(domains.RoleSupport), r.Handler.HandleGet)
+		adminRouter.POST("/:id/pause", r.Auth.Require(domains.RoleSupport), r.Handler.HandlePause)
+		adminRouter.POST("/:id/resume", r.Auth.Require(domains.RoleSupport), r.Handler.HandleResume)
+		adminRouter.POST("/:id/cancel", r.Auth.Require(domains.RoleSupport), r.Handler.HandleCancel)
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"appa_payments/internal/domains"
 	"appa_payments/internal/handlers"
 	"appa_payments/pkg/middleware"
 
@@ -10,20 +11,26 @@ import (
 // WebhookRoutes defines the routes for the webhook service
 type WebhookRoutes struct {
 	handler *handlers.WebhookHandler
+	auth    domains.Authenticator
 }
 
 // NewWebhookRoutes creates a new instance of WebhookRoutes
 func NewWebhookRoutes(
 	handler *handlers.WebhookHandler,
+	auth domains.Authenticator,
 ) *WebhookRoutes {
 	return &WebhookRoutes{
 		handler: handler,
+		auth:    auth,
 	}
 }
 
 const shopifyHMACHeader = "X-Shopify-Hmac-Sha256"
 
-// SetRouter sets up the routes for the webhook service
+// SetRouter sets up the routes for the webhook service, and the job list and
+// replay for support.
 func (r *WebhookRoutes) SetRouter(router *gin.Engine, secretKey string) {
 	router.POST("/webhook/order/created", middleware.ValidateHMAC(secretKey, shopifyHMACHeader), r.handler.HandleOrdersCreated)
+	router.GET("/admin/webhooks/jobs", r.auth.Require(domains.RoleSupport), r.handler.HandleListJobs)
+	router.POST("/admin/webhooks/orders-created/:orderId/replay", r.auth.Require(domains.RoleSupport), r.handler.HandleReplayOrdersCreated)
 }
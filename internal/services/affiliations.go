@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/shopify"
+)
+
+var currentAffiliationStatuses = []string{domains.AffiliationRequested, domains.AffiliationActive}
+
+type affiliationService struct {
+	db          *gorm.DB
+	shopifyRepo shopify.Repository
+	audit       domains.AuditService
+	logger      *zap.Logger
+}
+
+// NewAffiliationService keeps the affiliations table in step with the
+// charges made and with the direct_debit_account metafield.
+func NewAffiliationService(db *gorm.DB, shopifyRepo shopify.Repository, audit domains.AuditService, logger *zap.Logger) domains.AffiliationService {
+	return &affiliationService{db: db, shopifyRepo: shopifyRepo, audit: audit, logger: logger}
+}
+
+// setAffiliationStatus moves item to status, stamping when.
+func setAffiliationStatus(item *dbModels.Affiliation, status string, now time.Time) {
+	item.Status = status
+	switch status {
+	case domains.AffiliationRequested:
+		item.RequestedAt = &now
+	case domains.AffiliationActive:
+		item.ActivatedAt = &now
+	case domains.AffiliationRefused:
+		item.RefusedAt = &now
+	case domains.AffiliationRevoked:
+		item.RevokedAt = &now
+	}
+}
+
+// lockCurrentAffiliation loads customerID's requested or active affiliation FOR UPDATE
+// inside tx; ID is 0 when there is none.
+func lockCurrentAffiliation(tx *gorm.DB, customerID string) (dbModels.Affiliation, error) {
+	var current dbModels.Affiliation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("customer_id = ? AND status IN ?", customerID, currentAffiliationStatuses).
+		Limit(1).Find(&current).Error
+	return current, err
+}
+
+func (s *affiliationService) RecordCharge(ctx context.Context, charge domains.AffiliationCharge) {
+	status, ok := domains.AffiliationStatusForCode(charge.ResponseCode)
+	if !ok || charge.Account == "" {
+		return
+	}
+	customerID := stripCustomerGIDPrefix(charge.CustomerID)
+	logger := s.logger.With(zap.String("customerID", customerID), zap.String("code", charge.ResponseCode))
+
+	var err error
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	current, err := lockCurrentAffiliation(tx, customerID)
+	if err != nil {
+		logger.Error("affiliations: failed to load current affiliation", zap.Error(err))
+		return
+	}
+
+	now := time.Now()
+	masked := domains.MaskAccount(charge.Account)
+	if current.ID != 0 && current.AccountMasked == masked && current.DNI == charge.DNI {
+		if current.Status != status {
+			setAffiliationStatus(&current, status, now)
+		}
+		current.LastCode = charge.ResponseCode
+		if charge.OrderID != "" {
+			current.OrderID = stripOrderGIDPrefix(charge.OrderID)
+		}
+		if err = tx.Save(&current).Error; err != nil {
+			logger.Error("affiliations: failed to update affiliation", zap.Error(err), zap.Int("affiliationID", current.ID))
+		}
+		return
+	}
+
+	// Another account was charged: the current affiliation is superseded.
+	if current.ID != 0 {
+		setAffiliationStatus(&current, domains.AffiliationRevoked, now)
+		if err = tx.Save(&current).Error; err != nil {
+			logger.Error("affiliations: failed to revoke superseded affiliation", zap.Error(err), zap.Int("affiliationID", current.ID))
+			return
+		}
+	}
+	item := dbModels.Affiliation{
+		CustomerID:    customerID,
+		AccountMasked: masked,
+		Bank:          domains.AccountBank(charge.Account),
+		DNI:           charge.DNI,
+		LastCode:      charge.ResponseCode,
+		OrderID:       stripOrderGIDPrefix(charge.OrderID),
+	}
+	setAffiliationStatus(&item, status, now)
+	if err = tx.Create(&item).Error; err != nil {
+		logger.Error("affiliations: failed to record affiliation", zap.Error(err))
+	}
+}
+
+func (s *affiliationService) Get(ctx context.Context, customerID string) (*models.AffiliationResponse, error) {
+	customer, err := s.customer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.response(ctx, customerID, affiliationMetafield(customer.DirectDebitAccount))
+}
+
+// Revoke clears the metafield first: if Shopify refuses, nothing changes. A
+// metafield with no affiliation recorded, as one written before the table
+// existed, is recorded revoked.
+func (s *affiliationService) Revoke(ctx context.Context, customerID string) (*models.AffiliationResponse, error) {
+	customer, err := s.customer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.revoke(ctx, customer); err != nil {
+		return nil, err
+	}
+	return s.response(ctx, customer.ID, nil)
+}
+
+func (s *affiliationService) revoke(ctx context.Context, customer *shopify.Customer) (err error) {
+	customerID := stripCustomerGIDPrefix(customer.ID)
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	current, err := lockCurrentAffiliation(tx, customerID)
+	if err != nil {
+		return err
+	}
+	var account shopify.DebitDirectAccountJson
+	hasMetafield := customer.HasDirectDebitAccount() && json.Unmarshal(customer.DirectDebitAccount.JsonValue, &account) == nil
+	if current.ID == 0 && !hasMetafield {
+		err = domains.ErrAffiliationNotFound
+		return err
+	}
+
+	if customer.HasDirectDebitAccount() {
+		if err = s.shopifyRepo.DeleteCustomerDebitDirectAccount(ctx, customer.ID); err != nil {
+			s.logger.Error("affiliations: failed to clear direct debit account", zap.Error(err), zap.String("customerID", customerID))
+			return err
+		}
+	}
+
+	var before any
+	item := current
+	if current.ID != 0 {
+		before = current
+	} else {
+		item = dbModels.Affiliation{
+			CustomerID:    customerID,
+			AccountMasked: domains.MaskAccount(account.Account),
+			Bank:          domains.AccountBank(account.Account),
+			DNI:           account.DNI,
+		}
+	}
+	setAffiliationStatus(&item, domains.AffiliationRevoked, time.Now())
+	if err = tx.Save(&item).Error; err != nil {
+		s.logger.Error("affiliations: failed to revoke affiliation", zap.Error(err), zap.String("customerID", customerID))
+		return err
+	}
+	s.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionAffiliationRevoke,
+		SubjectType: domains.AuditSubjectCustomer,
+		SubjectID:   customerID,
+		Before:      before,
+		After:       item,
+	})
+	return nil
+}
+
+// Replace writes the metafield first: if Shopify refuses, nothing changes.
+// The new account is requested until a charge on it goes through.
+func (s *affiliationService) Replace(
+	ctx context.Context, customerID string, req models.ReplaceAffiliationRequest,
+) (*models.AffiliationResponse, error) {
+	customer, err := s.customer(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.replace(ctx, customer, shopify.DebitDirectAccountJson{
+		Account: req.Account,
+		DNI:     strings.ToUpper(strings.TrimSpace(req.DNI)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.response(ctx, customer.ID, &models.AffiliationMetafield{
+		AccountMasked: item.AccountMasked,
+		Bank:          item.Bank,
+		DNI:           item.DNI,
+	})
+}
+
+func (s *affiliationService) replace(
+	ctx context.Context, customer *shopify.Customer, account shopify.DebitDirectAccountJson,
+) (item *dbModels.Affiliation, err error) {
+	customerID := stripCustomerGIDPrefix(customer.ID)
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	current, err := lockCurrentAffiliation(tx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.shopifyRepo.SetCustomerDebitDirectAccount(ctx, customer.ID, account); err != nil {
+		s.logger.Error("affiliations: failed to set direct debit account", zap.Error(err), zap.String("customerID", customerID))
+		return nil, err
+	}
+
+	now := time.Now()
+	var before any
+	if current.ID != 0 {
+		before = current
+		setAffiliationStatus(&current, domains.AffiliationRevoked, now)
+		if err = tx.Save(&current).Error; err != nil {
+			s.logger.Error("affiliations: failed to revoke replaced affiliation", zap.Error(err), zap.String("customerID", customerID))
+			return nil, err
+		}
+	}
+	item = &dbModels.Affiliation{
+		CustomerID:    customerID,
+		AccountMasked: domains.MaskAccount(account.Account),
+		Bank:          domains.AccountBank(account.Account),
+		DNI:           account.DNI,
+	}
+	setAffiliationStatus(item, domains.AffiliationRequested, now)
+	if err = tx.Create(item).Error; err != nil {
+		s.logger.Error("affiliations: failed to record replacement affiliation", zap.Error(err), zap.String("customerID", customerID))
+		return nil, err
+	}
+	s.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionAffiliationReplace,
+		SubjectType: domains.AuditSubjectCustomer,
+		SubjectID:   customerID,
+		Before:      before,
+		After:       item,
+	})
+	return item, nil
+}
+
+func (s *affiliationService) customer(ctx context.Context, customerID string) (*shopify.Customer, error) {
+	customer, err := s.shopifyRepo.GetCustomerByID(ctx, customerID)
+	if err != nil {
+		s.logger.Error("affiliations: failed to get customer", zap.Error(err), zap.String("customerID", customerID))
+		return nil, err
+	}
+	if customer == nil {
+		return nil, domains.ErrCustomerNotFound
+	}
+	return customer, nil
+}
+
+// response lists customerID's affiliations against metafield, what Shopify
+// holds.
+func (s *affiliationService) response(
+	ctx context.Context, customerID string, metafield *models.AffiliationMetafield,
+) (*models.AffiliationResponse, error) {
+	customerID = stripCustomerGIDPrefix(customerID)
+	resp := &models.AffiliationResponse{CustomerID: customerID, Metafield: metafield}
+	if err := s.db.WithContext(ctx).
+		Where("customer_id = ?", customerID).
+		Order("id DESC").
+		Find(&resp.History).Error; err != nil {
+		s.logger.Error("affiliations: failed to list affiliations", zap.Error(err), zap.String("customerID", customerID))
+		return nil, err
+	}
+
+	for i := range resp.History {
+		if resp.History[i].Status == domains.AffiliationRequested || resp.History[i].Status == domains.AffiliationActive {
+			resp.Current = &resp.History[i]
+			break
+		}
+	}
+	switch {
+	case resp.Current == nil:
+		resp.InSync = metafield == nil
+	case metafield == nil:
+		// MD01 clears the metafield and leaves the affiliation requested.
+		resp.InSync = resp.Current.Status == domains.AffiliationRequested
+	default:
+		resp.InSync = resp.Current.AccountMasked == metafield.AccountMasked && resp.Current.DNI == metafield.DNI
+	}
+	return resp, nil
+}
+
+// affiliationMetafield masks the direct_debit_account metafield; nil when
+// the customer has none, or it doesn't parse.
+func affiliationMetafield(metafield *shopify.Metafield) *models.AffiliationMetafield {
+	if metafield == nil || metafield.JsonValue == nil {
+		return nil
+	}
+	var account shopify.DebitDirectAccountJson
+	if err := json.Unmarshal(metafield.JsonValue, &account); err != nil {
+		return nil
+	}
+	return &models.AffiliationMetafield{
+		AccountMasked: domains.MaskAccount(account.Account),
+		Bank:          domains.AccountBank(account.Account),
+		DNI:           account.DNI,
+	}
+}
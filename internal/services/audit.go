@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/requestctx"
+)
+
+const auditEventsDefaultPageSize = 50
+
+type auditService struct {
+	db       *gorm.DB
+	location *time.Location
+	logger   *zap.Logger
+}
+
+func NewAuditService(db *gorm.DB, location *time.Location, logger *zap.Logger) domains.AuditService {
+	return &auditService{db: db, location: location, logger: logger}
+}
+
+// auditActor is who ctx says is acting: the API key's name, or anonymous for
+// an unauthenticated request, or system when there is no request at all.
+func auditActor(ctx context.Context) string {
+	if actor := requestctx.Actor(ctx); actor != "" {
+		return actor
+	}
+	if requestctx.RequestID(ctx) != "" {
+		return domains.AuditActorAnonymous
+	}
+	return domains.AuditActorSystem
+}
+
+// auditJSON is v as stored in the log, with its PII masked.
+func auditJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return domains.MaskAuditPII(raw)
+}
+
+func (s *auditService) Record(ctx context.Context, tx *gorm.DB, event domains.AuditEvent) {
+	if tx == nil {
+		tx = s.db
+	}
+
+	record := dbModels.AuditEvent{
+		Actor:       auditActor(ctx),
+		Action:      event.Action,
+		SubjectType: event.SubjectType,
+		SubjectID:   event.SubjectID,
+		Before:      auditJSON(event.Before),
+		After:       auditJSON(event.After),
+		RequestID:   requestctx.RequestID(ctx),
+	}
+	if err := tx.WithContext(context.WithoutCancel(ctx)).Create(&record).Error; err != nil {
+		s.logger.Error("failed to record audit event", zap.Error(err), zap.Any("event", record))
+	}
+}
+
+// List pages through the audit log, newest first.
+func (s *auditService) List(ctx context.Context, req models.ListAuditEventsRequest) (*models.AuditEventPage, error) {
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = auditEventsDefaultPageSize
+	}
+
+	query := s.db.WithContext(ctx).Model(&dbModels.AuditEvent{})
+	if req.Actor != "" {
+		query = query.Where("actor = ?", req.Actor)
+	}
+	if req.Action != "" {
+		query = query.Where("action = ?", req.Action)
+	}
+	if req.SubjectType != "" {
+		query = query.Where("subject_type = ?", req.SubjectType)
+	}
+	if req.SubjectID != "" {
+		query = query.Where("subject_id = ?", req.SubjectID)
+	}
+	if req.RequestID != "" {
+		query = query.Where("request_id = ?", req.RequestID)
+	}
+	if req.From != "" {
+		from, _ := time.ParseInLocation("2006-01-02", req.From, s.location)
+		query = query.Where("created_at >= ?", from)
+	}
+	if req.To != "" {
+		to, _ := time.ParseInLocation("2006-01-02", req.To, s.location)
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	page := &models.AuditEventPage{Page: req.Page, PageSize: req.PageSize}
+	if err := query.Count(&page.Total).Error; err != nil {
+		s.logger.Error("failed to count audit events", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	page.Items = make([]dbModels.AuditEvent, 0, req.PageSize)
+	if err := query.Order("id DESC").
+		Offset((req.Page - 1) * req.PageSize).
+		Limit(req.PageSize).
+		Find(&page.Items).Error; err != nil {
+		s.logger.Error("failed to list audit events", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	return page, nil
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"appa_payments/internal/domains"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/mailgun"
+	"appa_payments/pkg/r4bank"
+)
+
+// unattachedCartChargesQuery lists every successful cart-path charge made
+// before @before that attach-order never linked to an order. A pago móvil's
+// refundable amount leaves out the excess already returned at match time.
+const unattachedCartChargesQuery = `
+SELECT 'r4_appa_debits_direct' AS source, id AS charge_id, cart_id, reference, amount, amount AS refundable,
+       issuing_bank AS bank, sender_phone AS phone, dni, created_at AS charged_at
+FROM r4_appa_debits_direct
+WHERE success AND COALESCE(cart_id, '') <> '' AND COALESCE(order_id, '') = '' AND refunded_at IS NULL AND created_at < @before
+UNION ALL
+SELECT 'r4_appa_mobile_payments', p.id, p.cart_id, p.reference, p.amount,
+       p.amount - COALESCE((
+           SELECT SUM(r.reversal_amount) FROM r4_appa_mobile_payments_reversals r
+           WHERE r.reference = p.reference AND r.success
+       ), 0),
+       p.issuing_bank, p.sender_phone, '', p.updated_at
+FROM r4_appa_mobile_payments p
+WHERE COALESCE(p.cart_id, '') <> '' AND p.order_id IS NULL AND p.refunded_at IS NULL AND p.updated_at < @before
+UNION ALL
+SELECT 'r4_appa_debits_direct_account', id, cart_id, reference, amount, 0, '', '', dni, created_at
+FROM r4_appa_debits_direct_account
+WHERE success AND COALESCE(cart_id, '') <> '' AND COALESCE(order_id, '') = '' AND created_at < @before
+ORDER BY charged_at`
+
+type unattachedCartCharge struct {
+	Source     string
+	ChargeID   int
+	CartID     string
+	Reference  string
+	Amount     float64
+	Refundable float64
+	Bank       string
+	Phone      string
+	DNI        string
+	ChargedAt  time.Time
+}
+
+func (c unattachedCartCharge) key() string {
+	return fmt.Sprintf("%s/%d", c.Source, c.ChargeID)
+}
+
+// CartChargeMonitorService watches for cart charges attach-order never
+// reached: the buyer paid, but no Shopify order carries the money.
+type CartChargeMonitorService struct {
+	db            *gorm.DB
+	r4Repo        r4bank.R4Repository
+	mailgunRepo   mailgun.Repository
+	audit         domains.AuditService
+	ledger        domains.LedgerService
+	alertAfter    time.Duration
+	refundEnabled bool
+	refundAfter   time.Duration
+	logger        *zap.Logger
+}
+
+func NewCartChargeMonitorService(
+	db *gorm.DB,
+	r4Repo r4bank.R4Repository,
+	mailgunRepo mailgun.Repository,
+	audit domains.AuditService,
+	ledger domains.LedgerService,
+	alertAfter time.Duration,
+	refundEnabled bool,
+	refundAfter time.Duration,
+	logger *zap.Logger,
+) *CartChargeMonitorService {
+	return &CartChargeMonitorService{
+		db:            db,
+		r4Repo:        r4Repo,
+		mailgunRepo:   mailgunRepo,
+		audit:         audit,
+		ledger:        ledger,
+		alertAfter:    alertAfter,
+		refundEnabled: refundEnabled,
+		refundAfter:   refundAfter,
+		logger:        logger,
+	}
+}
+
+// Monitor tracks charges unattached for longer than alertAfter in
+// unattached_cart_charges, marks the ones attached since as resolved, and,
+// when enabled, refunds those still unattached after refundAfter. Support
+// gets one email per run with anything new. Meant to be invoked by the cron
+// job (internal/jobs).
+func (s *CartChargeMonitorService) Monitor(ctx context.Context) {
+	now := time.Now()
+
+	var charges []unattachedCartCharge
+	if err := s.db.WithContext(ctx).
+		Raw(unattachedCartChargesQuery, map[string]any{"before": now.Add(-s.alertAfter)}).
+		Scan(&charges).Error; err != nil {
+		s.logger.Error("cart charge monitor: failed to list unattached charges", zap.Error(err))
+		return
+	}
+
+	var open []dbModels.UnattachedCartCharge
+	if err := s.db.WithContext(ctx).
+		Where("resolved_at IS NULL AND refunded_at IS NULL").
+		Find(&open).Error; err != nil {
+		s.logger.Error("cart charge monitor: failed to load tracked charges", zap.Error(err))
+		return
+	}
+
+	current := make(map[string]unattachedCartCharge, len(charges))
+	for _, charge := range charges {
+		current[charge.key()] = charge
+	}
+	tracked := make(map[string]dbModels.UnattachedCartCharge, len(open))
+	for _, row := range open {
+		key := fmt.Sprintf("%s/%d", row.Source, row.ChargeID)
+		if _, ok := current[key]; !ok {
+			s.resolve(ctx, row, now)
+			continue
+		}
+		tracked[key] = row
+	}
+
+	var found []dbModels.UnattachedCartCharge
+	for _, charge := range charges {
+		if _, ok := tracked[charge.key()]; ok {
+			continue
+		}
+		found = append(found, dbModels.UnattachedCartCharge{
+			Source:    charge.Source,
+			ChargeID:  charge.ChargeID,
+			CartID:    charge.CartID,
+			Reference: charge.Reference,
+			Amount:    charge.Amount,
+			ChargedAt: charge.ChargedAt,
+		})
+	}
+	if len(found) > 0 {
+		if err := s.db.WithContext(ctx).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&found).Error; err != nil {
+			s.logger.Error("cart charge monitor: failed to track charges", zap.Error(err), zap.Int("count", len(found)))
+		}
+		s.logger.Warn("cart charge monitor: unattached cart charges found", zap.Int("count", len(found)))
+	}
+
+	var refunds []dbModels.UnattachedCartCharge
+	if s.refundEnabled {
+		for _, row := range tracked {
+			charge := current[fmt.Sprintf("%s/%d", row.Source, row.ChargeID)]
+			if row.RefundError != "" || charge.ChargedAt.After(now.Add(-s.refundAfter)) || !refundableCartCharge(charge) {
+				continue
+			}
+			// Stopping between refunds: one under way is always finished.
+			if ctx.Err() != nil {
+				s.logger.Info("cart charge monitor: stopping, remaining refunds left for the next run")
+				break
+			}
+			if s.refund(context.WithoutCancel(ctx), &row, charge) {
+				refunds = append(refunds, row)
+			}
+		}
+	}
+
+	s.sendAlert(context.WithoutCancel(ctx), found, refunds)
+}
+
+// refundableCartCharge: ChangePaid pays out to a phone, which domiciliación
+// rows don't have.
+func refundableCartCharge(charge unattachedCartCharge) bool {
+	return charge.Phone != "" && charge.Refundable > 0
+}
+
+// resolve marks a tracked charge attach-order reached after all.
+func (s *CartChargeMonitorService) resolve(ctx context.Context, row dbModels.UnattachedCartCharge, now time.Time) {
+	if err := s.db.WithContext(ctx).
+		Model(&row).
+		Update("resolved_at", now).Error; err != nil {
+		s.logger.Error("cart charge monitor: failed to resolve charge", zap.Error(err), zap.Int("id", row.ID))
+	}
+}
+
+// refund claims the charge by setting its refunded_at, so attach-order can no
+// longer link it, and sends the money back. It reports whether a refund was
+// attempted; false when the charge was attached in the meantime. A failed
+// transfer is not retried. Only a transfer R4 declined releases the charge;
+// after a timeout or any other error the money may have gone out, so the
+// charge stays blocked and the tracked row keeps both refunded_at and
+// refund_error until support checks it against R4.
+func (s *CartChargeMonitorService) refund(
+	ctx context.Context, row *dbModels.UnattachedCartCharge, charge unattachedCartCharge,
+) bool {
+	now := time.Now()
+	claim := s.db.WithContext(ctx).Table(charge.Source).Where("id = ? AND refunded_at IS NULL", charge.ChargeID)
+	if charge.Source == (dbModels.R4AppaMobilePayment{}).TableName() {
+		claim = claim.Where("order_id IS NULL")
+	} else {
+		claim = claim.Where("COALESCE(order_id, '') = ''")
+	}
+	result := claim.Update("refunded_at", now)
+	if result.Error != nil {
+		s.logger.Error("cart charge monitor: failed to claim charge", zap.Error(result.Error), zap.Int("id", row.ID))
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	err := s.r4Repo.ChangePaid(ctx, r4bank.ChangePaidRequest{
+		Bank:    charge.Bank,
+		Amount:  charge.Refundable,
+		Phone:   charge.Phone,
+		DNI:     charge.DNI,
+		Concept: fmt.Sprintf("Reintegro (%s)", charge.Reference),
+	})
+
+	record := dbModels.R4AppaMobilePaymentReversal{
+		Reference:      charge.Reference,
+		OrderName:      charge.CartID,
+		OrderAmount:    charge.Amount,
+		ReversalAmount: charge.Refundable,
+		Reason:         domains.MobilePaymentReversalReasonUnattached,
+		Success:        err == nil,
+	}
+	updates := map[string]any{"refunded_at": now}
+	row.RefundedAt = &now
+	if err != nil && !r4bank.Declined(err) {
+		s.logger.Error("cart charge monitor: refund outcome unknown, charge left blocked", zap.Error(err), zap.String("source", charge.Source), zap.Int("chargeId", charge.ChargeID))
+		record.ErrorDetail = err.Error()
+		updates["refund_error"] = err.Error()
+		row.RefundError = err.Error()
+	} else if err != nil {
+		s.logger.Error("cart charge monitor: failed to refund", zap.Error(err), zap.String("source", charge.Source), zap.Int("chargeId", charge.ChargeID))
+		record.ErrorDetail = err.Error()
+		updates = map[string]any{"refund_error": err.Error()}
+		row.RefundedAt, row.RefundError = nil, err.Error()
+		if err := s.db.WithContext(ctx).
+			Table(charge.Source).
+			Where("id = ?", charge.ChargeID).
+			Update("refunded_at", nil).Error; err != nil {
+			s.logger.Error("cart charge monitor: failed to release charge", zap.Error(err), zap.Int("id", row.ID))
+		}
+	}
+
+	if err := s.createReversal(ctx, &record, charge); err != nil {
+		s.logger.Error("cart charge monitor: failed to register reversal", zap.Error(err), zap.Any("record", record))
+	}
+	if err := s.db.WithContext(ctx).Model(row).Updates(updates).Error; err != nil {
+		s.logger.Error("cart charge monitor: failed to update tracked charge", zap.Error(err), zap.Int("id", row.ID))
+	}
+
+	s.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionMobilePaymentRefund,
+		SubjectType: domains.AuditSubjectCart,
+		SubjectID:   charge.CartID,
+		Before:      charge,
+		After:       record,
+	})
+
+	return true
+}
+
+// createReversal writes the reversal record and, when the money went back,
+// posts the refund against the cart the charge was posted to.
+func (s *CartChargeMonitorService) createReversal(
+	ctx context.Context, record *dbModels.R4AppaMobilePaymentReversal, charge unattachedCartCharge,
+) (err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(record).Error; err != nil || !record.Success {
+		return err
+	}
+	return s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:      domains.LedgerKindRefund,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: record.ReversalAmount,
+		Source:    record.TableName(),
+		SourceID:  record.ID,
+		Reference: charge.Reference,
+		CartID:    charge.CartID,
+	})
+}
+
+func (s *CartChargeMonitorService) sendAlert(
+	ctx context.Context, found, refunds []dbModels.UnattachedCartCharge,
+) {
+	if len(found) == 0 && len(refunds) == 0 {
+		return
+	}
+
+	var body strings.Builder
+	if len(found) > 0 {
+		fmt.Fprintf(&body, "Cobros de carrito sin orden asociada después de %s:\n\n", s.alertAfter)
+		for _, row := range found {
+			fmt.Fprintf(&body, "%s #%d  carrito %s  ref %s  Bs.S %.2f  %s\n",
+				row.Source, row.ChargeID, row.CartID, row.Reference, row.Amount, row.ChargedAt.Format(time.RFC3339))
+		}
+	}
+	if len(refunds) > 0 {
+		if body.Len() > 0 {
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&body, "Reintegros automáticos después de %s:\n\n", s.refundAfter)
+		for _, row := range refunds {
+			status := "reintegrado"
+			switch {
+			case row.RefundError != "" && row.RefundedAt != nil:
+				status = "resultado desconocido, verificar con R4: " + row.RefundError
+			case row.RefundError != "":
+				status = "falló: " + row.RefundError
+			}
+			fmt.Fprintf(&body, "%s #%d  carrito %s  ref %s  %s\n", row.Source, row.ChargeID, row.CartID, row.Reference, status)
+		}
+	}
+
+	if err := s.mailgunRepo.SendSupportEmail(ctx, mailgun.SupportEmailRequest{
+		Subject: fmt.Sprintf("Cobros de carrito sin orden: %d nuevos, %d reintegros", len(found), len(refunds)),
+		Body:    body.String(),
+	}); err != nil {
+		s.logger.Error("cart charge monitor: failed to send alert email", zap.Error(err))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"appa_payments/internal/domains"
 	"appa_payments/internal/models"
 	"appa_payments/pkg/bcv"
+	"appa_payments/pkg/db"
 	dbModels "appa_payments/pkg/db/models"
 	"appa_payments/pkg/mailgun"
 	"appa_payments/pkg/r4bank"
@@ -21,14 +23,18 @@ import (
 )
 
 type cartPaymentService struct {
-	shopifyRepo shopify.Repository
-	r4Repo      r4bank.R4Repository
-	bcvClient   bcv.Client
-	db          *gorm.DB
-	logger      *zap.Logger
-	location    *time.Location
-	mailgunRepo mailgun.Repository
-	otpCache    *otpCache
+	shopifyRepo  shopify.Repository
+	r4Repo       r4bank.R4Repository
+	bcvClient    bcv.Client
+	db           *gorm.DB
+	logger       *zap.Logger
+	location     *time.Location
+	mailgunRepo  mailgun.Repository
+	audit        domains.AuditService
+	ledger       domains.LedgerService
+	chargeLock   domains.ChargeLocker
+	otpStore     domains.OTPStore
+	affiliations domains.AffiliationService
 }
 
 const (
@@ -44,20 +50,41 @@ func NewCartPaymentService(
 	db *gorm.DB,
 	location *time.Location,
 	mailgunRepo mailgun.Repository,
+	audit domains.AuditService,
+	ledger domains.LedgerService,
+	chargeLock domains.ChargeLocker,
+	otpStore domains.OTPStore,
+	affiliations domains.AffiliationService,
 	logger *zap.Logger,
 ) *cartPaymentService {
 	return &cartPaymentService{
-		shopifyRepo: shopifyRepo,
-		r4Repo:      r4Repo,
-		bcvClient:   bcvClient,
-		db:          db,
-		location:    location,
-		mailgunRepo: mailgunRepo,
-		logger:      logger,
-		otpCache:    newOTPCache(),
+		shopifyRepo:  shopifyRepo,
+		r4Repo:       r4Repo,
+		bcvClient:    bcvClient,
+		db:           db,
+		location:     location,
+		mailgunRepo:  mailgunRepo,
+		audit:        audit,
+		ledger:       ledger,
+		chargeLock:   chargeLock,
+		logger:       logger,
+		otpStore:     otpStore,
+		affiliations: affiliations,
 	}
 }
 
+// lockCharge takes the charge lock of a cart quote; see domains.ChargeLocker.
+// Anything but a timeout comes back as generic, the error the caller would
+// otherwise answer with.
+func (s *cartPaymentService) lockCharge(ctx context.Context, cartID, generic string) (func(), error) {
+	unlock, err := s.chargeLock.Lock(ctx, domains.CartChargeLockKey(cartID))
+	if err != nil && !errors.Is(err, domains.ErrPaymentInProgress) {
+		s.logger.Error("failed to take charge lock", zap.Error(err), zap.String("cartId", cartID))
+		return nil, errors.New(generic)
+	}
+	return unlock, err
+}
+
 // parseCartIDAndKey splits a "gid://shopify/Cart/<id>?key=<key>" cart quote
 // id into its plain id and key, for use in refund concepts/reversal records.
 func (s *cartPaymentService) parseCartIDAndKey(cartQuoteID string) (string, string, error) {
@@ -120,9 +147,26 @@ func (s *cartPaymentService) awaitOperation(
 }
 
 func (s *cartPaymentService) registerDebitDirectPayment(ctx context.Context, req dbModels.R4AppaDebitDirect) {
-	if err := s.db.WithContext(ctx).Create(&req).Error; err != nil {
+	var err error
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(&req).Error; err != nil {
 		s.logger.Error("failed to register cart debit direct payment", zap.Error(err))
-	}
+		return
+	}
+	if req.Code != domains.R4CodeApproved {
+		return
+	}
+	err = s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:      domains.LedgerKindCharge,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: req.Amount,
+		Source:    req.TableName(),
+		SourceID:  req.ID,
+		Reference: req.Reference,
+		CartID:    req.CartID,
+	})
 }
 
 // ValidateDirectDebit validates the débito inmediato charge for a cart.
@@ -131,6 +175,12 @@ func (s *cartPaymentService) ValidateDirectDebit(
 	quote models.CartQuote,
 	req models.CartValidateOTPRequest,
 ) (*models.CartDirectDebitResult, error) {
+	unlock, err := s.lockCharge(ctx, quote.CartID, _debitImmediateGenericError)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	amount, err := s.amountVES(ctx, quote)
 	if err != nil {
 		s.logger.Error(err.Error())
@@ -148,7 +198,10 @@ func (s *cartPaymentService) ValidateDirectDebit(
 	})
 	if err != nil {
 		s.logger.Error(err.Error())
-		return nil, errors.New(_debitImmediateGenericError)
+		if r4bank.Declined(err) {
+			return nil, errors.New(_debitImmediateGenericError)
+		}
+		return nil, chargeOutcomeUnknownError{}
 	}
 
 	code, reference, success := s.awaitOperation(r4Resp)
@@ -176,9 +229,13 @@ func (s *cartPaymentService) ValidateDirectDebit(
 }
 
 // AttachOrder backfills the Shopify order id/name a cart-keyed charge became,
-// once create-order-from-cart has minted it. Never called by the browser.
-func (s *cartPaymentService) AttachOrder(ctx context.Context, cartID string, req models.CartAttachOrderRequest) error {
-	query := s.db.WithContext(ctx)
+// once create-order-from-cart has minted it, on the row and its ledger
+// entries. Never called by the browser. Charges already refunded as
+// unattached can't be attached any more.
+func (s *cartPaymentService) AttachOrder(ctx context.Context, cartID string, req models.CartAttachOrderRequest) (err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+	query := tx
 
 	values := map[string]any{
 		"order_id":   req.OrderID,
@@ -187,9 +244,9 @@ func (s *cartPaymentService) AttachOrder(ctx context.Context, cartID string, req
 
 	switch req.PaymentMethod {
 	case cartPaymentMethodDirectDebit:
-		query = query.Model(&dbModels.R4AppaDebitDirect{})
+		query = query.Model(&dbModels.R4AppaDebitDirect{}).Where("refunded_at IS NULL")
 	case cartPaymentMethodMobilePayment:
-		query = query.Model(&dbModels.R4AppaMobilePayment{})
+		query = query.Model(&dbModels.R4AppaMobilePayment{}).Where("refunded_at IS NULL")
 	case cartPaymentMethodDirectDebitAccount:
 		query = query.Model(&dbModels.R4DebitDirectAccount{})
 		values["store_client_id"] = strings.ReplaceAll(req.ClientID, shopify.CustomerKindID, "")
@@ -207,6 +264,12 @@ func (s *cartPaymentService) AttachOrder(ctx context.Context, cartID string, req
 		return errors.New("failed to attach order to payment")
 	}
 
+	customerID := strings.ReplaceAll(req.ClientID, shopify.CustomerKindID, "")
+	if err = s.ledger.AttachCartOrder(ctx, tx, cartID, req.Reference, req.OrderID, req.OrderName, customerID); err != nil {
+		s.logger.Error("failed to attach order to cart ledger entries", zap.Error(err), zap.String("cartId", cartID))
+		return errors.New("failed to attach order to payment")
+	}
+
 	return nil
 }
 
@@ -214,7 +277,7 @@ func (s *cartPaymentService) getCartMobilePaymentFilters(
 	query *gorm.DB,
 	req models.CartValidateMobilePaymentRequest,
 ) *gorm.DB {
-	query = query.Where("order_id IS NULL AND cart_id IS NULL")
+	query = query.Where(mobilePaymentUnclaimed)
 
 	if req.Bank != "" {
 		query = query.Where("issuing_bank = ?", req.Bank)
@@ -235,9 +298,10 @@ func (s *cartPaymentService) getCartMobilePaymentFilters(
 }
 
 func (s *cartPaymentService) registerMobilePaymentReversal(
-	cartID string, amount, reversalAmount float64, reason string, refundErr error,
+	ctx context.Context, item dbModels.R4AppaMobilePayment, cartID string, amount, reversalAmount float64, reason string, refundErr error,
 ) {
 	record := dbModels.R4AppaMobilePaymentReversal{
+		Reference:      item.Reference,
 		OrderName:      cartID,
 		OrderAmount:    amount,
 		ReversalAmount: reversalAmount,
@@ -247,9 +311,100 @@ func (s *cartPaymentService) registerMobilePaymentReversal(
 	if refundErr != nil {
 		record.ErrorDetail = refundErr.Error()
 	}
-	if err := s.db.Create(&record).Error; err != nil {
+	if err := s.createMobilePaymentReversal(ctx, &record, item); err != nil {
 		s.logger.Error("failed to register cart mobile payment reversal", zap.Error(err), zap.Any("record", record))
 	}
+
+	s.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionMobilePaymentRefund,
+		SubjectType: domains.AuditSubjectCart,
+		SubjectID:   cartID,
+		Before:      item,
+		After:       record,
+	})
+}
+
+// createMobilePaymentReversal writes record and, when the money went back,
+// its ledger posting: an excess against the cart, or a refund of a payment
+// that never applied.
+func (s *cartPaymentService) createMobilePaymentReversal(
+	ctx context.Context, record *dbModels.R4AppaMobilePaymentReversal, item dbModels.R4AppaMobilePayment,
+) (err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(record).Error; err != nil || !record.Success {
+		return err
+	}
+	posting := domains.LedgerPosting{
+		Kind:      domains.LedgerKindRefund,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: record.ReversalAmount,
+		Source:    record.TableName(),
+		SourceID:  record.ID,
+		Reference: item.Reference,
+	}
+	if record.Reason == "GREATER" {
+		posting.Kind = domains.LedgerKindExcess
+		posting.CartID = item.CartID
+	}
+	return s.ledger.Post(ctx, tx, posting)
+}
+
+// saveMobilePayment claims item for cartID and posts the charge with it.
+// errMobilePaymentClaimed means another request got to it first.
+func (s *cartPaymentService) saveMobilePayment(ctx context.Context, item *dbModels.R4AppaMobilePayment, cartID string) (err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = claimMobilePayment(tx, item, map[string]any{"cart_id": cartID}); err != nil {
+		return err
+	}
+	item.CartID = cartID
+	return s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:      domains.LedgerKindCharge,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: item.Amount,
+		Source:    item.TableName(),
+		SourceID:  item.ID,
+		Reference: item.Reference,
+		CartID:    item.CartID,
+	})
+}
+
+// deleteUnderpaidMobilePayment drops an underpaid payment so it can't match
+// again. The money still came in, so it's posted without a cart; the refund
+// nets it out. errMobilePaymentClaimed means another request got to it first
+// and it must not be refunded.
+func (s *cartPaymentService) deleteUnderpaidMobilePayment(ctx context.Context, item dbModels.R4AppaMobilePayment) (err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	result := tx.Where(mobilePaymentUnclaimed).Delete(&dbModels.R4AppaMobilePayment{}, item.ID)
+	if err = result.Error; err != nil {
+		return err
+	}
+	if result.RowsAffected == 0 {
+		err = errMobilePaymentClaimed
+		return err
+	}
+	if err = s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:      domains.LedgerKindCharge,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: item.Amount,
+		Source:    item.TableName(),
+		SourceID:  item.ID,
+		Reference: item.Reference,
+	}); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionMobilePaymentDelete,
+		SubjectType: domains.AuditSubjectMobilePayment,
+		SubjectID:   strconv.Itoa(item.ID),
+		Before:      item,
+	})
+	return nil
 }
 
 // ValidateMobilePayment matches an already-received R4 pago móvil payment
@@ -259,6 +414,12 @@ func (s *cartPaymentService) ValidateMobilePayment(
 	quote models.CartQuote,
 	req models.CartValidateMobilePaymentRequest,
 ) (*models.CartMobilePaymentResult, error) {
+	unlock, err := s.lockCharge(ctx, quote.CartID, domains.MobilePaymentInternalError)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	BCVTasa, err := s.bcvClient.Get(ctx)
 	if err != nil {
 		return nil, errors.New(domains.MobilePaymentInternalError)
@@ -277,13 +438,14 @@ func (s *cartPaymentService) ValidateMobilePayment(
 		}
 		break
 	}
+	notFound := &models.CartMobilePaymentResult{
+		Success: false,
+		Code:    domains.CartMobilePaymentNotFound,
+		Message: "no se encontro ningun pago movil que coincida con los datos proporcionados",
+	}
 	if item.ID == 0 {
 		s.logger.Error("no mobile payment found for cart", zap.String("cartId", quote.CartID), zap.Any("filters", req))
-		return &models.CartMobilePaymentResult{
-			Success: false,
-			Code:    domains.CartMobilePaymentNotFound,
-			Message: "no se encontro ningun pago movil que coincida con los datos proporcionados",
-		}, nil
+		return notFound, nil
 	}
 
 	dni := fmt.Sprintf("%s%s", req.DNIType, req.DNI)
@@ -295,7 +457,10 @@ func (s *cartPaymentService) ValidateMobilePayment(
 
 	switch domains.ClassifyCharge(expectedVES, item.Amount, BCVTasa) {
 	case domains.Underpaid:
-		if err := s.db.WithContext(ctx).Delete(&dbModels.R4AppaMobilePayment{}, item.ID).Error; err != nil {
+		if err := s.deleteUnderpaidMobilePayment(ctx, item); errors.Is(err, errMobilePaymentClaimed) {
+			s.logger.Warn("underpaid cart mobile payment claimed by another request", zap.Int("paymentId", item.ID))
+			return notFound, nil
+		} else if err != nil {
 			s.logger.Error("failed to delete underpaid cart mobile payment", zap.Error(err), zap.Int("paymentId", item.ID))
 		}
 		refundErr := s.r4Repo.ChangePaid(ctx, r4bank.ChangePaidRequest{
@@ -305,7 +470,7 @@ func (s *cartPaymentService) ValidateMobilePayment(
 			DNI:     dni,
 			Concept: fmt.Sprintf("DMT (%s)", cartID),
 		})
-		go s.registerMobilePaymentReversal(cartID, expectedVES, item.Amount, "LESS", refundErr)
+		s.registerMobilePaymentReversal(ctx, item, cartID, expectedVES, item.Amount, "LESS", refundErr)
 		if refundErr != nil {
 			s.logger.Error("failed to return money to sender", zap.Error(refundErr), zap.Any("payment", item))
 			return &models.CartMobilePaymentResult{
@@ -322,9 +487,10 @@ func (s *cartPaymentService) ValidateMobilePayment(
 		}, nil
 
 	case domains.Overpaid:
-		item.CartID = quote.CartID
-		item.UpdatedAt = time.Now()
-		if err := s.db.WithContext(ctx).Save(&item).Error; err != nil {
+		if err := s.saveMobilePayment(ctx, &item, quote.CartID); errors.Is(err, errMobilePaymentClaimed) {
+			s.logger.Warn("cart mobile payment claimed by another request", zap.Int("paymentId", item.ID))
+			return notFound, nil
+		} else if err != nil {
 			return nil, errors.New(domains.MobilePaymentInternalError)
 		}
 		excess := item.Amount - expectedVES
@@ -335,7 +501,7 @@ func (s *cartPaymentService) ValidateMobilePayment(
 			DNI:     dni,
 			Concept: fmt.Sprintf("DMT (%s)", cartID),
 		})
-		go s.registerMobilePaymentReversal(cartID, expectedVES, excess, "GREATER", refundErr)
+		s.registerMobilePaymentReversal(ctx, item, cartID, expectedVES, excess, "GREATER", refundErr)
 		message := fmt.Sprintf(
 			"El monto del pago fue mayor al total del pedido, se ha realizado la devolución del excedente (Bs.S %.2f), a los datos utilizados en su pago",
 			excess,
@@ -352,9 +518,10 @@ func (s *cartPaymentService) ValidateMobilePayment(
 		}, nil
 
 	default:
-		item.CartID = quote.CartID
-		item.UpdatedAt = time.Now()
-		if err := s.db.WithContext(ctx).Save(&item).Error; err != nil {
+		if err := s.saveMobilePayment(ctx, &item, quote.CartID); errors.Is(err, errMobilePaymentClaimed) {
+			s.logger.Warn("cart mobile payment claimed by another request", zap.Int("paymentId", item.ID))
+			return notFound, nil
+		} else if err != nil {
 			return nil, errors.New(domains.MobilePaymentInternalError)
 		}
 		return &models.CartMobilePaymentResult{
@@ -366,9 +533,27 @@ func (s *cartPaymentService) ValidateMobilePayment(
 }
 
 func (s *cartPaymentService) registerDirectDebitAccountResult(ctx context.Context, req dbModels.R4DebitDirectAccount) {
-	if err := s.db.WithContext(ctx).Create(&req).Error; err != nil {
+	var err error
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(&req).Error; err != nil {
 		s.logger.Error("failed to register cart direct debit account result", zap.Error(err))
-	}
+		return
+	}
+	if !req.Success {
+		return
+	}
+	err = s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:       domains.LedgerKindCharge,
+		Account:    domains.LedgerAccountR4,
+		AmountVES:  req.Amount,
+		Source:     req.TableName(),
+		SourceID:   req.ID,
+		Reference:  req.Reference,
+		CartID:     req.CartID,
+		CustomerID: req.StoreClientID,
+	})
 }
 
 // DirectDebitAccount charges a test amount to affiliate a new account for a
@@ -379,6 +564,22 @@ func (s *cartPaymentService) DirectDebitAccount(
 	quote models.CartQuote,
 	req models.CartDirectDebitAccountRequest,
 ) (*models.CartDirectDebitAccountResult, error) {
+	unlock, err := s.lockCharge(ctx, quote.CartID, _debitImmediateGenericError)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	customer, err := s.shopifyRepo.GetCustomerByID(ctx, req.ClientID)
+	if err != nil {
+		s.logger.Error("failed to fetch customer for direct debit account", zap.Error(err), zap.String("clientId", req.ClientID))
+		return nil, errors.New(_debitImmediateGenericError)
+	}
+	if customer == nil {
+		s.logger.Error("customer not found for direct debit account", zap.String("clientId", req.ClientID))
+		return nil, errors.New(_debitImmediateGenericError)
+	}
+
 	amount, err := s.amountVES(ctx, quote)
 	if err != nil {
 		s.logger.Error(err.Error())
@@ -394,7 +595,10 @@ func (s *cartPaymentService) DirectDebitAccount(
 	})
 	if err != nil {
 		s.logger.Error("direct debit account call failed", zap.Error(err))
-		return nil, errors.New(_debitImmediateGenericError)
+		if r4bank.Declined(err) {
+			return nil, errors.New(_debitImmediateGenericError)
+		}
+		return nil, chargeOutcomeUnknownError{}
 	}
 
 	s.registerDirectDebitAccountResult(context.Background(), dbModels.R4DebitDirectAccount{
@@ -410,7 +614,17 @@ func (s *cartPaymentService) DirectDebitAccount(
 		CreatedAt:   time.Now(),
 	})
 
-	return s.directDebitAccountResultFromR4(r4Resp)
+	result, err := s.directDebitAccountResultFromR4(r4Resp)
+	if err != nil {
+		return nil, err
+	}
+	s.affiliations.RecordCharge(ctx, domains.AffiliationCharge{
+		CustomerID:   customer.ID,
+		Account:      req.Account,
+		DNI:          req.DNI,
+		ResponseCode: result.Code,
+	})
+	return result, nil
 }
 
 // directDebitAccountResultFromR4 maps an R4 direct-debit-account response to
@@ -441,8 +655,8 @@ func (s *cartPaymentService) directDebitAccountResultFromR4(
 
 // RequestDirectDebitAccountOTP mails a 6-digit code to the email Shopify has
 // on file for ClientID — never one the request supplies, so a stolen
-// clientId can't redirect a charge's OTP to an attacker's inbox. Cached
-// under the cart id, mirroring how the order/draft flow caches under orderID.
+// clientId can't redirect a charge's OTP to an attacker's inbox. Stored
+// under the cart id, mirroring how the order/draft flow stores under orderID.
 func (s *cartPaymentService) RequestDirectDebitAccountOTP(
 	ctx context.Context,
 	quote models.CartQuote,
@@ -464,7 +678,16 @@ func (s *cartPaymentService) RequestDirectDebitAccountOTP(
 		return errors.New(_debitImmediateGenericError)
 	}
 
-	s.otpCache.Set(quote.CartID, code)
+	scopes := []string{domains.CustomerOTPScope(stripCustomerGIDPrefix(customer.ID))}
+	if err := s.otpStore.Issue(ctx, domains.CartOTPKey(quote.CartID), scopes, code); err != nil {
+		var throttled *domains.OTPThrottledError
+		if errors.As(err, &throttled) {
+			s.logger.Warn("OTP resend throttled", zap.String("cartId", quote.CartID), zap.Duration("retryAfter", throttled.RetryAfter))
+			return err
+		}
+		s.logger.Error("failed to store OTP code", zap.Error(err), zap.String("cartId", quote.CartID))
+		return errors.New(_debitImmediateGenericError)
+	}
 
 	return s.mailgunRepo.SendOTPEmail(ctx, mailgun.OTPEmailRequest{
 		To:                customer.Email,
@@ -482,6 +705,12 @@ func (s *cartPaymentService) ValidateDirectDebitAccountOTP(
 	quote models.CartQuote,
 	req models.CartValidateDirectDebitAccountOTPRequest,
 ) (*models.CartDirectDebitAccountResult, error) {
+	unlock, err := s.lockCharge(ctx, quote.CartID, _debitImmediateGenericError)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	customer, err := s.shopifyRepo.GetCustomerByID(ctx, req.ClientID)
 	if err != nil {
 		s.logger.Error("failed to fetch customer for direct debit account OTP", zap.Error(err), zap.String("clientId", req.ClientID))
@@ -491,7 +720,15 @@ func (s *cartPaymentService) ValidateDirectDebitAccountOTP(
 		return &models.CartDirectDebitAccountResult{Success: false, Code: domains.ResponseCodeAffiliationExists}, nil
 	}
 
-	if !s.otpCache.Validate(quote.CartID, req.OTP) {
+	verdict, err := s.otpStore.Validate(ctx, domains.CartOTPKey(quote.CartID), req.OTP)
+	if err != nil {
+		s.logger.Error("failed to validate OTP", zap.Error(err), zap.String("cartId", quote.CartID))
+		return nil, errors.New(_debitImmediateGenericError)
+	}
+	switch verdict {
+	case domains.OTPLocked:
+		return &models.CartDirectDebitAccountResult{Success: false, Code: domains.ResponseCodeOTPLocked}, nil
+	case domains.OTPInvalid:
 		return &models.CartDirectDebitAccountResult{Success: false, Code: domains.ResponseCodeInvalidOTP}, nil
 	}
 
@@ -516,7 +753,10 @@ func (s *cartPaymentService) ValidateDirectDebitAccountOTP(
 	})
 	if err != nil {
 		s.logger.Error("direct debit account call failed", zap.Error(err))
-		return nil, errors.New(_debitImmediateGenericError)
+		if r4bank.Declined(err) {
+			return nil, errors.New(_debitImmediateGenericError)
+		}
+		return nil, chargeOutcomeUnknownError{}
 	}
 
 	s.registerDirectDebitAccountResult(context.Background(), dbModels.R4DebitDirectAccount{
@@ -532,5 +772,15 @@ func (s *cartPaymentService) ValidateDirectDebitAccountOTP(
 		CreatedAt:   time.Now(),
 	})
 
-	return s.directDebitAccountResultFromR4(r4Resp)
+	result, err := s.directDebitAccountResultFromR4(r4Resp)
+	if err != nil {
+		return nil, err
+	}
+	s.affiliations.RecordCharge(ctx, domains.AffiliationCharge{
+		CustomerID:   customer.ID,
+		Account:      directDebit.Account,
+		DNI:          directDebit.DNI,
+		ResponseCode: result.Code,
+	})
+	return result, nil
 }
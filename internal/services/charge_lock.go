@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+)
+
+// chargeLockPollInterval is how often a waiting request retries the lock.
+const chargeLockPollInterval = 250 * time.Millisecond
+
+// chargeLockClass namespaces the advisory locks taken here (two-key form), so
+// they can't collide with any other advisory lock on the database.
+const chargeLockClass = 4040
+
+type chargeLocker struct {
+	db      *gorm.DB
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// NewChargeLocker takes Postgres session advisory locks, each on its own
+// pooled connection, so every replica of the service shares them.
+func NewChargeLocker(db *gorm.DB, timeout time.Duration, logger *zap.Logger) domains.ChargeLocker {
+	return &chargeLocker{db: db, timeout: timeout, logger: logger}
+}
+
+func (l *chargeLocker) Lock(ctx context.Context, key string) (func(), error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(l.timeout)
+	for {
+		var locked bool
+		err := conn.QueryRowContext(ctx,
+			"SELECT pg_try_advisory_lock($1, hashtext($2))", chargeLockClass, key,
+		).Scan(&locked)
+		if err != nil {
+			discardConn(conn)
+			return nil, err
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			_ = conn.Close()
+			l.logger.Warn("charge lock: timed out waiting", zap.String("key", key))
+			return nil, domains.ErrPaymentInProgress
+		}
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(chargeLockPollInterval):
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			var unlocked bool
+			err := conn.QueryRowContext(context.Background(),
+				"SELECT pg_advisory_unlock($1, hashtext($2))", chargeLockClass, key,
+			).Scan(&unlocked)
+			if err != nil || !unlocked {
+				// Closing the session is what frees the lock then.
+				l.logger.Error("charge lock: failed to unlock, dropping connection", zap.Error(err), zap.String("key", key))
+				discardConn(conn)
+				return
+			}
+			_ = conn.Close()
+		})
+	}, nil
+}
+
+// discardConn closes the underlying session instead of returning it to the
+// pool, which releases any advisory lock it still holds.
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = conn.Close()
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+)
+
+// moneyMovementsCTE normalizes every table that records money moving into
+// one row shape. Charges are positive and refunds negative; R4 tables carry
+// bolívares, manual orders dollars, except manual pago móvil, whose amount is
+// the bolívares sent for its dollar total. Refunds all leave as pago móvil,
+// except cash change, which is filed under efectivo. reason is the reversal
+// reason, empty for charges. An approved manual order happens when it was
+// approved, so a day's settlement counts the approvals made that day, however
+// old the receipt; any other manual order when it was submitted.
+const moneyMovementsCTE = `
+WITH movements AS (
+    SELECT created_at AS occurred_at, 'debito_inmediato' AS rail, 'charge' AS movement,
+           reference, amount AS amount_ves, NULL::numeric AS amount_usd,
+           COALESCE(order_id, '') AS order_id, COALESCE(order_name, '') AS order_name, COALESCE(cart_id, '') AS cart_id,
+           COALESCE(dni, '') AS customer,
+           CASE WHEN success THEN 'success' ELSE 'failed' END AS status, COALESCE(code, '') AS detail,
+           '' AS reason
+    FROM r4_appa_debits_direct
+    UNION ALL
+    SELECT created_at, 'domiciliacion', 'charge',
+           reference, amount, NULL,
+           COALESCE(order_id, ''), COALESCE(order_name, ''), COALESCE(cart_id, ''),
+           COALESCE(dni, ''),
+           CASE WHEN success THEN 'success' ELSE 'failed' END, COALESCE(code, ''),
+           ''
+    FROM r4_appa_debits_direct_account
+    UNION ALL
+    SELECT created_at, 'pago_movil', 'charge',
+           reference, amount, NULL,
+           COALESCE(order_id::text, ''), COALESCE(order_name, ''), COALESCE(cart_id, ''),
+           COALESCE(sender_phone, ''),
+           CASE WHEN refunded_at IS NOT NULL THEN 'refunded'
+                WHEN order_id IS NOT NULL OR COALESCE(cart_id, '') <> '' THEN 'linked'
+                ELSE 'unmatched' END,
+           COALESCE(issuing_bank, ''),
+           ''
+    FROM r4_appa_mobile_payments
+    UNION ALL
+    SELECT created_at, CASE WHEN reason = 'CHANGE' THEN 'efectivo' ELSE 'pago_movil' END, 'refund',
+           COALESCE(reference, ''), -reversal_amount, NULL,
+           '', COALESCE(order_name, ''), '',
+           '',
+           CASE WHEN success THEN 'success' ELSE 'failed' END,
+           TRIM(reason || ' ' || COALESCE(error_detail, '')),
+           reason
+    FROM r4_appa_mobile_payments_reversals
+    UNION ALL
+    SELECT COALESCE(a.approved_at, o.created_at::timestamptz),
+           CASE o.payment_method_id WHEN 1 THEN 'zelle' WHEN 2 THEN 'efectivo' ELSE 'pago_movil_manual' END, 'charge',
+           '',
+           CASE WHEN o.payment_method_id = 4 THEN o.amount END,
+           CASE WHEN o.payment_method_id = 4 THEN o.order_total_amount ELSE o.amount END,
+           o.order_id::text, o.order_name, '',
+           '',
+           lower(o.validate_status), '',
+           ''
+    FROM appa_manual_orders o
+    LEFT JOIN LATERAL (
+        SELECT MAX(t.created_at) AS approved_at
+        FROM appa_manual_order_transitions t
+        WHERE t.manual_order_id = o.id AND t.to_status = 'APPROVED'
+    ) a ON o.validate_status = 'APPROVED'
+)`
+
+// exportTransactionsQuery lists the movements in [@from, @to) with the rate
+// of the Caracas day each happened on.
+const exportTransactionsQuery = moneyMovementsCTE + `
+SELECT m.*, r.rate AS bcv_rate
+FROM movements m
+LEFT JOIN bcv_rates r ON r.date = (m.occurred_at AT TIME ZONE @tz)::date
+WHERE m.occurred_at >= @from AND m.occurred_at < @to AND (@rail = '' OR m.rail = @rail)
+ORDER BY m.occurred_at`
+
+type exportMovement struct {
+	OccurredAt time.Time
+	Rail       string
+	Movement   string
+	Reference  string
+	AmountVES  *float64
+	AmountUSD  *float64
+	OrderID    string
+	OrderName  string
+	CartID     string
+	Customer   string
+	Status     string
+	Detail     string
+	BCVRate    *float64
+}
+
+type exportService struct {
+	db       *gorm.DB
+	location *time.Location
+	logger   *zap.Logger
+}
+
+func NewExportService(db *gorm.DB, location *time.Location, logger *zap.Logger) domains.ExportService {
+	return &exportService{db: db, location: location, logger: logger}
+}
+
+func (s *exportService) StreamTransactions(
+	ctx context.Context,
+	req models.ExportTransactionsRequest,
+	fn func(models.TransactionRow) error,
+) error {
+	from, err := time.ParseInLocation("2006-01-02", req.From, s.location)
+	if err != nil {
+		return err
+	}
+	to, err := time.ParseInLocation("2006-01-02", req.To, s.location)
+	if err != nil {
+		return err
+	}
+	if to.Before(from) {
+		return domains.ErrExportRange
+	}
+
+	rows, err := s.db.WithContext(ctx).
+		Raw(exportTransactionsQuery, map[string]any{
+			"tz":   s.location.String(),
+			"from": from,
+			"to":   to.AddDate(0, 0, 1),
+			"rail": req.Rail,
+		}).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movement exportMovement
+		if err := s.db.ScanRows(rows, &movement); err != nil {
+			return err
+		}
+		if err := fn(transactionRow(movement, s.location)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// transactionRow fills whichever currency the source table lacks from the
+// day's BCV rate.
+func transactionRow(m exportMovement, location *time.Location) models.TransactionRow {
+	row := models.TransactionRow{
+		Date:      m.OccurredAt.In(location),
+		Rail:      m.Rail,
+		Movement:  m.Movement,
+		Reference: m.Reference,
+		AmountVES: m.AmountVES,
+		BCVRate:   m.BCVRate,
+		AmountUSD: m.AmountUSD,
+		OrderID:   m.OrderID,
+		OrderName: m.OrderName,
+		CartID:    m.CartID,
+		Customer:  m.Customer,
+		Status:    m.Status,
+		Detail:    m.Detail,
+	}
+	if m.BCVRate == nil || *m.BCVRate == 0 {
+		return row
+	}
+
+	switch {
+	case m.AmountVES != nil && m.AmountUSD == nil:
+		usd := roundCents(*m.AmountVES / *m.BCVRate)
+		row.AmountUSD = &usd
+	case m.AmountUSD != nil && m.AmountVES == nil:
+		ves := roundCents(*m.AmountUSD * *m.BCVRate)
+		row.AmountVES = &ves
+	}
+	return row
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
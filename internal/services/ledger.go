@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	helpers "appa_payments/pkg"
+	"appa_payments/pkg/bcv"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/shopify"
+)
+
+// ledgerPaymentsTotalsQuery sums what was paid per order or cart from the
+// payments side of the ledger, flipping the sign so payments read positive.
+const ledgerPaymentsTotalsQuery = `
+SELECT COALESCE(order_id, '') AS order_id, MAX(order_name) AS order_name,
+       CASE WHEN COALESCE(order_id, '') = '' THEN cart_id ELSE '' END AS cart_id,
+       -SUM(amount_ves) AS paid_ves, -COALESCE(SUM(amount_usd), 0) AS paid_usd
+FROM ledger_entries
+WHERE account = @account AND customer_id = @customerID
+GROUP BY 1, 3
+ORDER BY MIN(created_at)`
+
+type ledgerService struct {
+	db          *gorm.DB
+	shopifyRepo shopify.Repository
+	bcvClient   bcv.Client
+	logger      *zap.Logger
+}
+
+func NewLedgerService(
+	db *gorm.DB,
+	shopifyRepo shopify.Repository,
+	bcvClient bcv.Client,
+	logger *zap.Logger,
+) domains.LedgerService {
+	return &ledgerService{
+		db:          db,
+		shopifyRepo: shopifyRepo,
+		bcvClient:   bcvClient,
+		logger:      logger,
+	}
+}
+
+func (s *ledgerService) Post(ctx context.Context, tx *gorm.DB, posting domains.LedgerPosting) error {
+	if posting.AmountVES <= 0 {
+		return errors.New("ledger: posting amount must be positive")
+	}
+
+	var usd *float64
+	switch {
+	case posting.AmountUSD > 0:
+		usd = &posting.AmountUSD
+	default:
+		// Post runs inside the caller's transaction, so only a rate already
+		// fetched today is used; a cold cache posts bolívares alone.
+		if rate, ok := s.bcvClient.Cached(); ok {
+			converted := math.Round(posting.AmountVES/rate*100) / 100
+			usd = &converted
+		} else {
+			s.logger.Warn("ledger: posting without USD amount, BCV rate not cached", zap.String("source", posting.Source), zap.Int("sourceId", posting.SourceID))
+		}
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	transactionID := hex.EncodeToString(b)
+
+	// Money in debits the money account and credits payments; money out
+	// the other way round.
+	sign := 1.0
+	if posting.Kind == domains.LedgerKindRefund || posting.Kind == domains.LedgerKindExcess {
+		sign = -1
+	}
+	entry := func(account string, sign float64) dbModels.LedgerEntry {
+		e := dbModels.LedgerEntry{
+			TransactionID: transactionID,
+			Account:       account,
+			Kind:          posting.Kind,
+			AmountVES:     sign * posting.AmountVES,
+			Source:        posting.Source,
+			SourceID:      posting.SourceID,
+			Reference:     posting.Reference,
+			OrderID:       posting.OrderID,
+			OrderName:     posting.OrderName,
+			CartID:        posting.CartID,
+			CustomerID:    posting.CustomerID,
+		}
+		if usd != nil {
+			signed := sign * *usd
+			e.AmountUSD = &signed
+		}
+		return e
+	}
+
+	entries := []dbModels.LedgerEntry{
+		entry(posting.Account, sign),
+		entry(domains.LedgerAccountPayments, -sign),
+	}
+	if err := tx.WithContext(ctx).Create(&entries).Error; err != nil {
+		s.logger.Error("ledger: failed to post", zap.Error(err), zap.Any("posting", posting))
+		return err
+	}
+	return nil
+}
+
+func (s *ledgerService) ReassignOrder(ctx context.Context, tx *gorm.DB, draftID, orderID, orderName string) error {
+	if draftID == "" || draftID == orderID {
+		return nil
+	}
+	return tx.WithContext(ctx).
+		Model(&dbModels.LedgerEntry{}).
+		Where("order_id = ?", draftID).
+		Updates(map[string]any{"order_id": orderID, "order_name": orderName}).Error
+}
+
+func (s *ledgerService) AttachCartOrder(
+	ctx context.Context, tx *gorm.DB, cartID, reference, orderID, orderName, customerID string,
+) error {
+	values := map[string]any{"order_id": orderID, "order_name": orderName}
+	if customerID != "" {
+		values["customer_id"] = customerID
+	}
+	return tx.WithContext(ctx).
+		Model(&dbModels.LedgerEntry{}).
+		Where("cart_id = ? AND reference = ?", cartID, reference).
+		Updates(values).Error
+}
+
+func (s *ledgerService) OrderBalance(ctx context.Context, orderID string) (*models.OrderBalance, error) {
+	resp, err := s.shopifyRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Order == nil {
+		return nil, domains.ErrLedgerOrderNotFound
+	}
+	total, err := helpers.StringToFloat64(resp.Order.CurrentTotalPriceSet.ShopMoney.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &models.OrderBalance{
+		OrderID:   orderID,
+		OrderName: resp.Order.Name,
+		TotalUSD:  total,
+		Entries:   []dbModels.LedgerEntry{},
+	}
+	if err := s.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("created_at, id").
+		Find(&balance.Entries).Error; err != nil {
+		return nil, err
+	}
+
+	for _, e := range balance.Entries {
+		if e.Account != domains.LedgerAccountPayments {
+			continue
+		}
+		balance.PaidVES -= e.AmountVES
+		if e.AmountUSD != nil {
+			balance.PaidUSD -= *e.AmountUSD
+		}
+	}
+	balance.PaidVES = roundCents(balance.PaidVES)
+	balance.PaidUSD = roundCents(balance.PaidUSD)
+	balance.DueUSD = roundCents(math.Max(0, total-balance.PaidUSD))
+	balance.FullyPaid = balance.PaidUSD+domains.ToleranceUSD >= total
+
+	return balance, nil
+}
+
+func (s *ledgerService) CustomerBalance(ctx context.Context, customerID string) (*models.CustomerBalance, error) {
+	balance := &models.CustomerBalance{CustomerID: customerID, Orders: []models.CustomerOrderBalance{}}
+	if err := s.db.WithContext(ctx).
+		Raw(ledgerPaymentsTotalsQuery, map[string]any{
+			"account":    domains.LedgerAccountPayments,
+			"customerID": customerID,
+		}).
+		Scan(&balance.Orders).Error; err != nil {
+		return nil, err
+	}
+
+	for _, order := range balance.Orders {
+		balance.PaidVES += order.PaidVES
+		balance.PaidUSD += order.PaidUSD
+	}
+	balance.PaidVES = roundCents(balance.PaidVES)
+	balance.PaidUSD = roundCents(balance.PaidUSD)
+
+	return balance, nil
+}
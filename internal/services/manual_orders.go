@@ -0,0 +1,547 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/bcv"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/mailgun"
+	"appa_payments/pkg/r4bank"
+	"appa_payments/pkg/shopify"
+)
+
+// manualOrderActorCheckout is the actor recorded when the buyer's checkout
+// creates a manual order, as opposed to a back-office reviewer.
+const manualOrderActorCheckout = "checkout"
+
+const manualOrdersDefaultPageSize = 20
+
+type manualOrderService struct {
+	db             *gorm.DB
+	paymentService domains.PaymentService
+	shopifyRepo    shopify.Repository
+	r4Repo         r4bank.R4Repository
+	bcvClient      bcv.Client
+	mailgunRepo    mailgun.Repository
+	audit          domains.AuditService
+	ledger         domains.LedgerService
+	location       *time.Location
+	logger         *zap.Logger
+
+	// inflight tracks the rejection emails sent after their request
+	// answered. See Drain.
+	inflight sync.WaitGroup
+}
+
+func NewManualOrderService(
+	db *gorm.DB,
+	paymentService domains.PaymentService,
+	shopifyRepo shopify.Repository,
+	r4Repo r4bank.R4Repository,
+	bcvClient bcv.Client,
+	mailgunRepo mailgun.Repository,
+	audit domains.AuditService,
+	ledger domains.LedgerService,
+	location *time.Location,
+	logger *zap.Logger,
+) *manualOrderService {
+	return &manualOrderService{
+		db:             db,
+		paymentService: paymentService,
+		shopifyRepo:    shopifyRepo,
+		r4Repo:         r4Repo,
+		bcvClient:      bcvClient,
+		mailgunRepo:    mailgunRepo,
+		audit:          audit,
+		ledger:         ledger,
+		location:       location,
+		logger:         logger,
+	}
+}
+
+// createManualOrderTransition appends one row to the manual order history.
+func createManualOrderTransition(tx *gorm.DB, transition dbModels.ManualOrderTransition) error {
+	return tx.Create(&transition).Error
+}
+
+// List pages through manual orders, newest first. With no status it lists
+// the PENDING review queue.
+func (s *manualOrderService) List(
+	ctx context.Context,
+	req models.ListManualOrdersRequest,
+) (*models.ManualOrderPage, error) {
+	if req.Status == "" {
+		req.Status = domains.ManualOrderStatusPending
+	}
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = manualOrdersDefaultPageSize
+	}
+
+	query := s.db.WithContext(ctx).Model(&dbModels.ManualOrder{}).
+		Where("validate_status = ?", req.Status)
+	if req.PaymentMethodID != 0 {
+		query = query.Where("payment_method_id = ?", req.PaymentMethodID)
+	}
+	if req.OrderName != "" {
+		query = query.Where("order_name = ?", req.OrderName)
+	}
+	if req.From != "" {
+		query = query.Where("created_at >= ?", req.From)
+	}
+	if req.To != "" {
+		query = query.Where("created_at < (?::date + 1)", req.To)
+	}
+	if req.DuplicatesOnly {
+		query = query.Where("duplicate_of_id IS NOT NULL")
+	}
+
+	page := &models.ManualOrderPage{Page: req.Page, PageSize: req.PageSize}
+	if err := query.Count(&page.Total).Error; err != nil {
+		s.logger.Error("failed to count manual orders", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	page.Items = make([]dbModels.ManualOrder, 0, req.PageSize)
+	if err := query.Preload("PaymentMethod").
+		Order("created_at DESC, id DESC").
+		Offset((req.Page - 1) * req.PageSize).
+		Limit(req.PageSize).
+		Find(&page.Items).Error; err != nil {
+		s.logger.Error("failed to list manual orders", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// lockPending loads a manual order FOR UPDATE inside tx and checks it is
+// still waiting for review, so two reviewers can't settle the same row.
+func (s *manualOrderService) lockPending(tx *gorm.DB, id int) (*dbModels.ManualOrder, error) {
+	return s.lockInStatus(tx, id, domains.ManualOrderStatusPending)
+}
+
+// lockInStatus loads a manual order FOR UPDATE inside tx and checks it is in
+// status.
+func (s *manualOrderService) lockInStatus(tx *gorm.DB, id int, status string) (*dbModels.ManualOrder, error) {
+	var item dbModels.ManualOrder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domains.ErrManualOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if item.ValidateStatus != status {
+		return nil, domains.ErrManualOrderNotPending
+	}
+	return &item, nil
+}
+
+// Approve settles the order the receipt pays for — markAsPaid, or draft
+// completion — and moves the row to APPROVED. The row is claimed as
+// APPROVING and committed before Shopify is touched, so a second approve
+// can't settle the order again. If Shopify refuses, the row goes back to
+// PENDING for another try; if the approval can't be recorded after Shopify
+// settled, it stays APPROVING and support is alerted. Cash that needs change
+// gets its vuelto sent only once the approval is committed.
+func (s *manualOrderService) Approve(
+	ctx context.Context,
+	id int,
+	actor string,
+) (*models.ManualOrderReviewResponse, error) {
+	claimed, rate, err := s.claimApproval(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Past the claim the row must not be left behind by a caller that went
+	// away.
+	ctx = context.WithoutCancel(ctx)
+
+	orderType := models.OrderType(claimed.OrderType)
+	finalized, err := s.paymentService.FinalizeOrder(ctx, strconv.Itoa(claimed.OrderID), models.OrderTypeOrDefault(&orderType))
+	if err != nil {
+		s.logger.Error("failed to finalize approved manual order", zap.Error(err), zap.Int("manualOrderId", claimed.ID), zap.String("order", claimed.OrderName))
+		s.releaseApproval(ctx, claimed.ID)
+		return nil, err
+	}
+
+	item, err := s.approve(ctx, *claimed, actor, rate, finalized)
+	if err != nil {
+		s.alertApprovalNotRecorded(ctx, *claimed, err)
+		return nil, err
+	}
+
+	resp := &models.ManualOrderReviewResponse{
+		ManualOrder:     *item,
+		OrderID:         finalized.OrderID,
+		OrderName:       finalized.OrderName,
+		FinancialStatus: finalized.FinancialStatus,
+		ReviewedAt:      *item.ReviewedAt,
+	}
+	if item.IGTFAmount > 0 {
+		s.setOrderIGTF(ctx, *item)
+	}
+	if item.RequiresChange {
+		resp.Change = s.sendCashChange(ctx, *item)
+	}
+
+	return resp, nil
+}
+
+// claimApproval moves a PENDING row to APPROVING and commits, returning the
+// row as it was before. The BCV rate is taken here, before Shopify is
+// touched, so the ledger posting can't fail for want of it after the order
+// is already settled.
+func (s *manualOrderService) claimApproval(
+	ctx context.Context,
+	id int,
+) (claimed *dbModels.ManualOrder, rate float64, err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	claimed, err = s.lockPending(tx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rate, err = s.bcvClient.Get(ctx)
+	if err != nil {
+		s.logger.Error("failed to get BCV rate for manual order approval", zap.Error(err), zap.Int("manualOrderId", id))
+		return nil, 0, err
+	}
+
+	if err = tx.Model(&dbModels.ManualOrder{}).Where("id = ?", id).Updates(map[string]any{
+		"validate_status": domains.ManualOrderStatusApproving,
+		"updated_at":      time.Now().In(s.location),
+	}).Error; err != nil {
+		s.logger.Error("failed to claim manual order for approval", zap.Error(err), zap.Int("manualOrderId", id))
+		return nil, 0, err
+	}
+
+	return claimed, rate, nil
+}
+
+// releaseApproval puts a claimed row back to PENDING once Shopify refused to
+// settle its order. If that fails too the row stays APPROVING, which only
+// keeps it from being approved again.
+func (s *manualOrderService) releaseApproval(ctx context.Context, id int) {
+	if err := s.db.WithContext(ctx).Model(&dbModels.ManualOrder{}).
+		Where("id = ? AND validate_status = ?", id, domains.ManualOrderStatusApproving).
+		Updates(map[string]any{
+			"validate_status": domains.ManualOrderStatusPending,
+			"updated_at":      time.Now().In(s.location),
+		}).Error; err != nil {
+		s.logger.Error("failed to release manual order claim", zap.Error(err), zap.Int("manualOrderId", id))
+	}
+}
+
+// alertApprovalNotRecorded tells support an order was settled in Shopify
+// but its manual order is still APPROVING.
+func (s *manualOrderService) alertApprovalNotRecorded(ctx context.Context, item dbModels.ManualOrder, cause error) {
+	if err := s.mailgunRepo.SendSupportAlert(ctx, mailgun.SupportAlertRequest{
+		OrderName: item.OrderName,
+		Message:   fmt.Sprintf("se pagó en Shopify pero no se pudo registrar la aprobación del recibo %d: %v", item.ID, cause),
+	}); err != nil {
+		s.logger.Error("failed to send support alert email", zap.Error(err), zap.Int("manualOrderId", item.ID))
+	}
+}
+
+// setOrderIGTF writes the IGTF the buyer paid to the order's custom.igtf
+// metafield. A failure is only logged: the row keeps the amount.
+func (s *manualOrderService) setOrderIGTF(ctx context.Context, item dbModels.ManualOrder) {
+	var paymentMethod dbModels.PaymentMethod
+	if err := s.db.WithContext(ctx).First(&paymentMethod, item.PaymentMethodID).Error; err != nil {
+		s.logger.Warn("failed to get payment method for IGTF metafield", zap.Error(err), zap.Int("paymentMethodId", item.PaymentMethodID))
+	}
+
+	if err := s.shopifyRepo.SetOrderIGTF(ctx, strconv.Itoa(item.OrderID), shopify.OrderIGTFJson{
+		PaymentMethod: paymentMethod.Name,
+		Rate:          item.IGTFRate,
+		BaseAmount:    item.OrderTotalAmount,
+		Amount:        item.IGTFAmount,
+		Currency:      "USD",
+	}); err != nil {
+		s.logger.Error("failed to set order IGTF", zap.Error(err), zap.Int("manualOrderId", item.ID), zap.String("order", item.OrderName))
+	}
+}
+
+// approve records the APPROVED row, its transition, ledger posting and audit
+// event for an order Shopify settled. claimed is the row as it was before
+// claimApproval.
+func (s *manualOrderService) approve(
+	ctx context.Context,
+	claimed dbModels.ManualOrder,
+	actor string,
+	rate float64,
+	finalized *models.FinalizedOrder,
+) (item *dbModels.ManualOrder, err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	item, err = s.lockInStatus(tx, claimed.ID, domains.ManualOrderStatusApproving)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(s.location)
+	item.ValidateStatus = domains.ManualOrderStatusApproved
+	item.ReviewedBy = actor
+	item.ReviewedAt = &now
+	item.UpdatedAt = now
+	if realOrderID, convErr := strconv.Atoi(finalized.OrderID); convErr == nil {
+		item.OrderID = realOrderID
+		item.OrderName = finalized.OrderName
+	}
+	if err = tx.Save(item).Error; err != nil {
+		s.logger.Error("failed to save approved manual order", zap.Error(err), zap.Int("manualOrderId", item.ID))
+		return nil, err
+	}
+
+	if err = createManualOrderTransition(tx, dbModels.ManualOrderTransition{
+		ManualOrderID: item.ID,
+		FromStatus:    claimed.ValidateStatus,
+		ToStatus:      item.ValidateStatus,
+		Actor:         actor,
+	}); err != nil {
+		s.logger.Error("failed to record manual order approval", zap.Error(err), zap.Int("manualOrderId", item.ID))
+		return nil, err
+	}
+
+	// Manual pago móvil amounts are the bolívares sent; Zelle and cash are
+	// dollars.
+	posting := domains.LedgerPosting{
+		Kind:      domains.LedgerKindApproval,
+		Account:   domains.LedgerAccountManual,
+		AmountVES: item.Amount * rate,
+		AmountUSD: item.Amount,
+		Source:    item.TableName(),
+		SourceID:  item.ID,
+		OrderID:   strconv.Itoa(item.OrderID),
+		OrderName: item.OrderName,
+	}
+	if item.PaymentMethodID == domains.PaymentMethodMobilePayment {
+		posting.AmountVES, posting.AmountUSD = item.Amount, item.OrderTotalAmount
+	}
+	if err = s.ledger.Post(ctx, tx, posting); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionManualOrderApprove,
+		SubjectType: domains.AuditSubjectManualOrder,
+		SubjectID:   strconv.Itoa(item.ID),
+		Before:      claimed,
+		After:       item,
+	})
+
+	return item, nil
+}
+
+// sendCashChange returns the USD handed over above the order total and its
+// IGTF, in bolívares at today's BCV rate, to the pago móvil details the buyer
+// left. The attempt is recorded as a reversal with reason CHANGE either way; a
+// failure doesn't undo the approval, support settles it by hand.
+func (s *manualOrderService) sendCashChange(ctx context.Context, item dbModels.ManualOrder) *models.CashChange {
+	change := &models.CashChange{AmountUSD: item.Amount - item.OrderTotalAmount - item.IGTFAmount}
+	var orderAmountVES float64
+
+	err := func() error {
+		if item.ReturnData == nil {
+			return errors.New("cash order has no return data")
+		}
+		var returnData models.CashReturnData
+		if err := json.Unmarshal(*item.ReturnData, &returnData); err != nil {
+			return err
+		}
+
+		rate, err := s.bcvClient.Get(ctx)
+		if err != nil {
+			return err
+		}
+		change.AmountVES = change.AmountUSD * rate
+		orderAmountVES = item.OrderTotalAmount * rate
+
+		return s.r4Repo.ChangePaid(ctx, r4bank.ChangePaidRequest{
+			Bank:    returnData.Bank,
+			Amount:  change.AmountVES,
+			Phone:   returnData.Phone,
+			DNI:     fmt.Sprintf("%s%s", returnData.DNIType, returnData.DNI),
+			Concept: fmt.Sprintf("Vuelto (%s)", item.OrderName),
+		})
+	}()
+
+	record := dbModels.R4AppaMobilePaymentReversal{
+		OrderName:      item.OrderName,
+		OrderAmount:    orderAmountVES,
+		ReversalAmount: change.AmountVES,
+		Reason:         domains.ManualOrderReasonChange,
+		Success:        err == nil,
+	}
+	if err != nil {
+		s.logger.Error("failed to send cash change", zap.Error(err), zap.Int("manualOrderId", item.ID), zap.String("order", item.OrderName))
+		record.ErrorDetail = err.Error()
+		change.Error = err.Error()
+	}
+	change.Sent = err == nil
+
+	if err := s.createCashChange(ctx, &record, item, change.AmountUSD); err != nil {
+		s.logger.Error("failed to register cash change", zap.Error(err), zap.Any("record", record))
+	}
+
+	s.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionMobilePaymentRefund,
+		SubjectType: domains.AuditSubjectOrder,
+		SubjectID:   item.OrderName,
+		After:       record,
+	})
+
+	return change
+}
+
+// createCashChange writes the change record and, when it was sent, posts it
+// as a refund out of R4 against the order.
+func (s *manualOrderService) createCashChange(
+	ctx context.Context, record *dbModels.R4AppaMobilePaymentReversal, item dbModels.ManualOrder, amountUSD float64,
+) (err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(record).Error; err != nil || !record.Success {
+		return err
+	}
+	return s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:      domains.LedgerKindRefund,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: record.ReversalAmount,
+		AmountUSD: amountUSD,
+		Source:    record.TableName(),
+		SourceID:  record.ID,
+		OrderID:   strconv.Itoa(item.OrderID),
+		OrderName: item.OrderName,
+	})
+}
+
+// Reject moves the row to REJECTED with the reviewer's reason and emails the
+// buyer. The order in Shopify is left untouched.
+func (s *manualOrderService) Reject(
+	ctx context.Context,
+	id int,
+	actor string,
+	req models.RejectManualOrderRequest,
+) (resp *models.ManualOrderReviewResponse, err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	item, err := s.lockPending(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *item
+
+	now := time.Now().In(s.location)
+	from := item.ValidateStatus
+	item.ValidateStatus = domains.ManualOrderStatusRejected
+	item.RejectReason = req.Reason
+	item.ReviewedBy = actor
+	item.ReviewedAt = &now
+	item.UpdatedAt = now
+	if err = tx.Save(item).Error; err != nil {
+		s.logger.Error("failed to save rejected manual order", zap.Error(err), zap.Int("manualOrderId", item.ID))
+		return nil, err
+	}
+
+	if err = createManualOrderTransition(tx, dbModels.ManualOrderTransition{
+		ManualOrderID: item.ID,
+		FromStatus:    from,
+		ToStatus:      item.ValidateStatus,
+		Reason:        req.Reason,
+		Actor:         actor,
+	}); err != nil {
+		s.logger.Error("failed to record manual order rejection", zap.Error(err), zap.Int("manualOrderId", item.ID))
+		return nil, err
+	}
+
+	s.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionManualOrderReject,
+		SubjectType: domains.AuditSubjectManualOrder,
+		SubjectID:   strconv.Itoa(item.ID),
+		Before:      before,
+		After:       item,
+	})
+
+	rejected := *item
+	s.inflight.Go(func() { s.notifyRejected(rejected) })
+
+	return &models.ManualOrderReviewResponse{ManualOrder: *item, ReviewedAt: now}, nil
+}
+
+// Drain waits for the rejection emails still being sent until ctx is done.
+// Call it once the HTTP server has stopped taking requests.
+func (s *manualOrderService) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notifyRejected emails the buyer behind a rejected manual order, at the
+// address Shopify has on file for the order's customer.
+func (s *manualOrderService) notifyRejected(item dbModels.ManualOrder) {
+	ctx := context.Background()
+	orderID := strconv.Itoa(item.OrderID)
+
+	var customer shopify.Customer
+	if models.OrderType(item.OrderType) == models.OrderTypeDraft {
+		resp, err := s.shopifyRepo.GetDraftOrderByID(ctx, orderID)
+		if err != nil {
+			s.logger.Error("failed to get draft order to notify rejection", zap.Error(err), zap.Int("manualOrderId", item.ID))
+			return
+		}
+		customer = resp.DraftOrder.Customer
+	} else {
+		resp, err := s.shopifyRepo.GetOrderByID(ctx, orderID)
+		if err != nil {
+			s.logger.Error("failed to get order to notify rejection", zap.Error(err), zap.Int("manualOrderId", item.ID))
+			return
+		}
+		customer = resp.Order.Customer
+	}
+
+	if customer.Email == "" {
+		s.logger.Warn("customer has no email, rejection not notified", zap.Int("manualOrderId", item.ID), zap.String("order", item.OrderName))
+		return
+	}
+
+	if err := s.mailgunRepo.SendPaymentRejectedEmail(ctx, mailgun.PaymentRejectedEmailRequest{
+		To:        customer.Email,
+		UserName:  customer.DisplayName,
+		OrderName: item.OrderName,
+		Reason:    item.RejectReason,
+	}); err != nil {
+		s.logger.Error("failed to notify manual order rejection", zap.Error(err), zap.Int("manualOrderId", item.ID))
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// ValidateZelle registers a Zelle receipt for review. Zelle is paid in
+// dollars, so the row's amount is the order total plus IGTF, in USD.
+func (p *paymentService) ValidateZelle(ctx context.Context, req models.ValidateZelle) error {
+	orderType := models.OrderTypeOrDefault(req.TypeOrder)
+	target, err := p.GetChargeableByID(ctx, req.OrderID, orderType)
+	if err != nil {
+		return err
+	}
+
+	var amount float64
+	if value, err := strconv.ParseFloat(target.AmountUSD, 64); err == nil {
+		amount = value
+	}
+
+	igtf := p.igtfRates.Amount(domains.PaymentMethodZelle, amount)
+
+	return p.createManualOrder(ctx, req.OrderID, req.BillImageFile, dbModels.ManualOrder{
+		OrderName:        req.OrderName,
+		OrderType:        string(orderType),
+		Amount:           amount + igtf,
+		OrderTotalAmount: amount,
+		IGTFRate:         p.igtfRates.Rate(domains.PaymentMethodZelle),
+		IGTFAmount:       igtf,
+		PaymentMethodID:  domains.PaymentMethodZelle,
+	})
+}
+
+// ValidateCash registers a cash receipt for review. The amount handed over
+// must cover the order plus IGTF; when it exceeds that and the buyer asked
+// for change, the pago móvil details for the vuelto are stored with the row
+// and the change is sent when the receipt is approved.
+func (p *paymentService) ValidateCash(ctx context.Context, req models.ValidateCash) error {
+	orderType := models.OrderTypeOrDefault(req.TypeOrder)
+	target, err := p.GetChargeableByID(ctx, req.OrderID, orderType)
+	if err != nil {
+		return err
+	}
+
+	var amount float64
+	if value, err := strconv.ParseFloat(target.AmountUSD, 64); err == nil {
+		amount = value
+	}
+
+	igtf := p.igtfRates.Amount(domains.PaymentMethodCash, amount)
+	due := amount + igtf
+	if req.Amount <= 0 || req.Amount < due {
+		return domains.ErrCashAmountInvalid
+	}
+
+	manualOrder := dbModels.ManualOrder{
+		OrderName:        req.OrderName,
+		OrderType:        string(orderType),
+		Amount:           req.Amount,
+		OrderTotalAmount: amount,
+		IGTFRate:         p.igtfRates.Rate(domains.PaymentMethodCash),
+		IGTFAmount:       igtf,
+		RequiresChange:   req.RequiresChange && req.Amount > due,
+		PaymentMethodID:  domains.PaymentMethodCash,
+	}
+
+	if manualOrder.RequiresChange {
+		if !req.ReturnData.Complete() {
+			return domains.ErrCashReturnDataRequired
+		}
+		returnData, err := json.Marshal(req.ReturnData)
+		if err != nil {
+			return err
+		}
+		manualOrder.ReturnData = &returnData
+	}
+
+	return p.createManualOrder(ctx, req.OrderID, req.BillImageFile, manualOrder)
+}
+
+// createManualOrder uploads the receipt and stores manualOrder as PENDING
+// for back-office review, flagging a receipt already used for another order.
+// On DB failure the uploaded Drive file is deleted.
+func (p *paymentService) createManualOrder(
+	ctx context.Context,
+	orderID string,
+	billImageFile *multipart.FileHeader,
+	manualOrder dbModels.ManualOrder,
+) error {
+	var dbError error
+
+	id, err := strconv.Atoi(orderID)
+	if err != nil {
+		p.logger.Error(err.Error(), zap.String("orderId", orderID))
+		return errors.New("invalid order ID")
+	}
+	manualOrder.OrderID = id
+	manualOrder.ValidateStatus = domains.ManualOrderStatusPending
+
+	file, url, err := p.uploadReceipt(ctx, billImageFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if dbError == nil {
+			return
+		}
+
+		err := p.driveClient.DeleteFile(ctx, url)
+		if err != nil {
+			p.logger.Error("failed to delete file from google drive", zap.Any("url", url))
+		}
+	}()
+
+	manualOrder.BillImageURL = url
+	manualOrder.ReceiptSHA256 = file.SHA256
+	manualOrder.ReceiptPHash = file.PHash
+	duplicate := p.flagDuplicateReceipt(ctx, &manualOrder, file)
+
+	dbError = p.insertManualOrder(ctx, &manualOrder)
+	if dbError != nil {
+		p.logger.Error(dbError.Error(), zap.Any("order", manualOrder))
+		return dbError
+	}
+
+	if duplicate != nil {
+		p.inflight.Go(func() { p.alertDuplicateReceipt(manualOrder, *duplicate) })
+	}
+
+	return nil
+}
+
+// insertManualOrder writes manualOrder with its first transition, so no
+// manual order exists without one.
+func (p *paymentService) insertManualOrder(ctx context.Context, manualOrder *dbModels.ManualOrder) (err error) {
+	tx := p.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(manualOrder).Error; err != nil {
+		return err
+	}
+	err = createManualOrderTransition(tx, dbModels.ManualOrderTransition{
+		ManualOrderID: manualOrder.ID,
+		ToStatus:      manualOrder.ValidateStatus,
+		Actor:         manualOrderActorCheckout,
+	})
+	return err
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/r4bank"
+)
+
+// orphanMobilePaymentsQuery lists pago móvil rows with neither order nor cart
+// received before @before, each with the error of its last failed automatic
+// refund and the sender's DNI. A row whose refund failed is listed even while
+// claimed: R4's answer was lost and support has to check it. R4's notification carries no DNI, so it is
+// taken from the sender's latest successful débito inmediato from the same
+// phone (last 10 digits), stored as "V-123" and sent to R4 as "V123".
+const orphanMobilePaymentsQuery = `
+SELECT p.*, COALESCE(f.error_detail, '') AS refund_error, COALESCE(k.dni, '') AS sender_dni
+FROM r4_appa_mobile_payments p
+LEFT JOIN LATERAL (
+    SELECT r.error_detail
+    FROM r4_appa_mobile_payments_reversals r
+    WHERE r.reference = p.reference AND r.reason = @reason AND NOT r.success
+    ORDER BY r.id DESC
+    LIMIT 1
+) f ON true
+LEFT JOIN LATERAL (
+    SELECT replace(d.dni, '-', '') AS dni
+    FROM r4_appa_debits_direct d
+    WHERE d.success AND COALESCE(d.dni, '') <> ''
+      AND RIGHT(regexp_replace(d.sender_phone, '\D', '', 'g'), 10) = RIGHT(regexp_replace(p.sender_phone, '\D', '', 'g'), 10)
+    ORDER BY d.id DESC
+    LIMIT 1
+) k ON true
+WHERE p.order_id IS NULL AND p.cart_id IS NULL AND p.created_at < @before
+  AND (@includeRefunded OR p.refunded_at IS NULL OR f.error_detail IS NOT NULL)
+ORDER BY p.created_at, p.id`
+
+type orphanMobilePaymentService struct {
+	db              *gorm.DB
+	r4Repo          r4bank.R4Repository
+	audit           domains.AuditService
+	ledger          domains.LedgerService
+	days            int
+	refundEnabled   bool
+	refundMaxPerRun float64
+	logger          *zap.Logger
+}
+
+func NewOrphanMobilePaymentService(
+	db *gorm.DB,
+	r4Repo r4bank.R4Repository,
+	audit domains.AuditService,
+	ledger domains.LedgerService,
+	days int,
+	refundEnabled bool,
+	refundMaxPerRun float64,
+	logger *zap.Logger,
+) domains.OrphanMobilePaymentService {
+	return &orphanMobilePaymentService{
+		db:              db,
+		r4Repo:          r4Repo,
+		audit:           audit,
+		ledger:          ledger,
+		days:            days,
+		refundEnabled:   refundEnabled,
+		refundMaxPerRun: refundMaxPerRun,
+		logger:          logger,
+	}
+}
+
+func (s *orphanMobilePaymentService) Report(
+	ctx context.Context,
+	req models.OrphanMobilePaymentsRequest,
+) (*models.OrphanMobilePaymentReport, error) {
+	days := req.Days
+	if days == 0 {
+		days = s.days
+	}
+
+	items, err := s.list(ctx, days, req.IncludeRefunded)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.OrphanMobilePaymentReport{Days: days, Items: items}
+	for _, item := range items {
+		if item.RefundedAt == nil {
+			report.PendingAmount += item.Amount
+		}
+	}
+	return report, nil
+}
+
+// RefundOrphans returns the money of orphaned rows to the sender's phone and
+// bank, oldest first, stopping before the refund that would take the run past
+// refundMaxPerRun; only refunds that went through count against it. Rows
+// whose automatic refund already failed once, or whose sender's DNI isn't
+// known, are left for support. Meant to be invoked by the daily cron job
+// (internal/jobs).
+func (s *orphanMobilePaymentService) RefundOrphans(ctx context.Context) {
+	items, err := s.list(ctx, s.days, false)
+	if err != nil {
+		s.logger.Error("orphan mobile payments: failed to list", zap.Error(err))
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+	s.logger.Warn("orphan mobile payments: unmatched rows found", zap.Int("count", len(items)), zap.Int("days", s.days))
+
+	if !s.refundEnabled {
+		return
+	}
+
+	var refunded, failed, noDNI int
+	budget := s.refundMaxPerRun
+	for _, item := range items {
+		// Stopping between refunds: one under way is always finished.
+		if ctx.Err() != nil {
+			s.logger.Info("orphan mobile payments: stopping, remaining rows left for the next run")
+			break
+		}
+		if item.RefundError != "" {
+			continue
+		}
+		if item.SenderDNI == "" {
+			noDNI++
+			continue
+		}
+		if item.Amount > budget {
+			s.logger.Info("orphan mobile payments: per-run refund cap reached", zap.Float64("remaining", budget), zap.Int("id", item.ID))
+			break
+		}
+
+		claimed, err := s.refund(context.WithoutCancel(ctx), item.R4AppaMobilePayment, item.SenderDNI)
+		if !claimed {
+			continue
+		}
+		if err != nil {
+			failed++
+			continue
+		}
+		budget -= item.Amount
+		refunded++
+	}
+
+	s.logger.Info("orphan mobile payments: refunds finished",
+		zap.Int("refunded", refunded), zap.Int("failed", failed), zap.Int("no_dni", noDNI))
+}
+
+// refund claims the row by setting refunded_at, so a buyer can no longer
+// match it, and sends the money back. claimed is false when the row was
+// matched or refunded in the meantime. Only a transfer R4 declined releases
+// the row again; after a timeout or any other error the money may have gone
+// out, so the row stays claimed for support. The failure is kept in the
+// reversals table either way.
+func (s *orphanMobilePaymentService) refund(
+	ctx context.Context, item dbModels.R4AppaMobilePayment, dni string,
+) (claimed bool, err error) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).
+		Model(&dbModels.R4AppaMobilePayment{}).
+		Where("id = ? AND order_id IS NULL AND cart_id IS NULL AND refunded_at IS NULL", item.ID).
+		Update("refunded_at", now)
+	if result.Error != nil {
+		s.logger.Error("orphan mobile payments: failed to claim row", zap.Error(result.Error), zap.Int("id", item.ID))
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	err = s.r4Repo.ChangePaid(ctx, r4bank.ChangePaidRequest{
+		Bank:    item.IssuingBank,
+		Amount:  item.Amount,
+		Phone:   item.SenderPhone,
+		DNI:     dni,
+		Concept: fmt.Sprintf("Reintegro (%s)", item.Reference),
+	})
+
+	record := dbModels.R4AppaMobilePaymentReversal{
+		Reference:      item.Reference,
+		ReversalAmount: item.Amount,
+		Reason:         domains.MobilePaymentReversalReasonOrphan,
+		Success:        err == nil,
+	}
+	if err != nil && !r4bank.Declined(err) {
+		s.logger.Error("orphan mobile payments: refund outcome unknown, row left claimed", zap.Error(err), zap.Int("id", item.ID))
+		record.ErrorDetail = err.Error()
+	} else if err != nil {
+		s.logger.Error("orphan mobile payments: failed to refund", zap.Error(err), zap.Int("id", item.ID))
+		record.ErrorDetail = err.Error()
+		if err := s.db.WithContext(ctx).
+			Model(&dbModels.R4AppaMobilePayment{}).
+			Where("id = ?", item.ID).
+			Update("refunded_at", nil).Error; err != nil {
+			s.logger.Error("orphan mobile payments: failed to release row", zap.Error(err), zap.Int("id", item.ID))
+		}
+	}
+
+	if err := s.createReversal(ctx, &record, item); err != nil {
+		s.logger.Error("orphan mobile payments: failed to register reversal", zap.Error(err), zap.Any("record", record))
+	}
+
+	s.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionMobilePaymentRefund,
+		SubjectType: domains.AuditSubjectMobilePayment,
+		SubjectID:   strconv.Itoa(item.ID),
+		Before:      item,
+		After:       record,
+	})
+
+	return true, err
+}
+
+// createReversal writes the reversal record. An orphan never reached the
+// ledger, so a successful refund posts both the money that came in and the
+// money that went back, netting to zero.
+func (s *orphanMobilePaymentService) createReversal(
+	ctx context.Context, record *dbModels.R4AppaMobilePaymentReversal, item dbModels.R4AppaMobilePayment,
+) (err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(record).Error; err != nil || !record.Success {
+		return err
+	}
+	if err = s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:      domains.LedgerKindCharge,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: item.Amount,
+		Source:    item.TableName(),
+		SourceID:  item.ID,
+		Reference: item.Reference,
+	}); err != nil {
+		return err
+	}
+	return s.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:      domains.LedgerKindRefund,
+		Account:   domains.LedgerAccountR4,
+		AmountVES: record.ReversalAmount,
+		Source:    record.TableName(),
+		SourceID:  record.ID,
+		Reference: item.Reference,
+	})
+}
+
+func (s *orphanMobilePaymentService) list(
+	ctx context.Context, days int, includeRefunded bool,
+) ([]models.OrphanMobilePayment, error) {
+	var items []models.OrphanMobilePayment
+	err := s.db.WithContext(ctx).
+		Raw(orphanMobilePaymentsQuery, map[string]any{
+			"reason":          domains.MobilePaymentReversalReasonOrphan,
+			"before":          time.Now().AddDate(0, 0, -days),
+			"includeRefunded": includeRefunded,
+		}).
+		Scan(&items).Error
+	return items, err
+}
@@ -1,86 +1,135 @@
 package services
 
 import (
-	"crypto/rand"
-	"fmt"
-	"math/big"
+	"context"
 	"sync"
 	"time"
-)
 
-const (
-	otpTTL          = 2 * time.Minute
-	otpCleanupEvery = 5 * time.Minute
+	"appa_payments/internal/domains"
 )
 
+const otpCleanupEvery = 5 * time.Minute
+
 type otpEntry struct {
 	code      string
+	attempts  int
 	expiresAt time.Time
 }
 
+// otpCache is an in-process OTPStore for tests and local runs. It only works
+// with a single instance and loses codes on restart; see NewOTPStore for the
+// shared one.
 type otpCache struct {
 	mu      sync.Mutex
+	limits  domains.OTPLimits
 	entries map[string]otpEntry
+	sends   map[string][]time.Time
+	now     func() time.Time
 }
 
-func newOTPCache() *otpCache {
-	c := &otpCache{entries: make(map[string]otpEntry)}
-	go c.cleanupLoop()
+// NewMemoryOTPStore keeps codes in memory, cleaning up expired ones every
+// few minutes until ctx is cancelled.
+func NewMemoryOTPStore(ctx context.Context, limits domains.OTPLimits) domains.OTPStore {
+	c := &otpCache{
+		limits:  limits,
+		entries: make(map[string]otpEntry),
+		sends:   make(map[string][]time.Time),
+		now:     time.Now,
+	}
+	go c.cleanupLoop(ctx)
 	return c
 }
 
-// Set stores a new OTP for the given key, overwriting any existing entry.
-func (c *otpCache) Set(key, code string) {
+// Issue stores a new OTP for the given key, overwriting any existing entry,
+// if the resend limits of key and scopes allow it.
+func (c *otpCache) Issue(_ context.Context, key string, scopes []string, code string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.entries[key] = otpEntry{code: code, expiresAt: time.Now().Add(otpTTL)}
+
+	now := c.now()
+	scopes = append([]string{key}, scopes...)
+	var wait time.Duration
+	for _, scope := range scopes {
+		wait = max(wait, domains.OTPSendRetryAfter(c.limits, c.recentSends(scope, now), now))
+	}
+	if wait > 0 {
+		return &domains.OTPThrottledError{RetryAfter: wait}
+	}
+
+	for _, scope := range scopes {
+		c.sends[scope] = append(c.recentSends(scope, now), now)
+	}
+	c.entries[key] = otpEntry{code: code, expiresAt: now.Add(otpTTL)}
+	return nil
 }
 
 // Validate checks that the OTP for key matches code and has not expired.
-// On success the entry is consumed (deleted) so it cannot be reused.
-func (c *otpCache) Validate(key, code string) bool {
+// On success the entry is consumed (deleted) so it cannot be reused; a wrong
+// code spends one of the entry's attempts.
+func (c *otpCache) Validate(_ context.Context, key, code string) (domains.OTPVerdict, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	entry, ok := c.entries[key]
 	if !ok {
-		return false
+		return domains.OTPInvalid, nil
+	}
+	if c.now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return domains.OTPInvalid, nil
 	}
-	if time.Now().After(entry.expiresAt) {
+	if entry.attempts < c.limits.MaxAttempts && entry.code == code {
 		delete(c.entries, key)
-		return false
+		return domains.OTPValid, nil
 	}
-	if entry.code != code {
-		return false
+	entry.attempts++
+	c.entries[key] = entry
+	if entry.attempts >= c.limits.MaxAttempts {
+		return domains.OTPLocked, nil
 	}
-	delete(c.entries, key)
-	return true
+	return domains.OTPInvalid, nil
 }
 
-func (c *otpCache) cleanupLoop() {
+func (c *otpCache) PurgeExpired(context.Context) {
+	c.cleanup()
+}
+
+// recentSends drops sends to scope older than the window. Callers hold mu.
+func (c *otpCache) recentSends(scope string, now time.Time) []time.Time {
+	sends := c.sends[scope]
+	for len(sends) > 0 && !sends[0].After(now.Add(-domains.OTPSendWindow)) {
+		sends = sends[1:]
+	}
+	return sends
+}
+
+func (c *otpCache) cleanupLoop(ctx context.Context) {
 	ticker := time.NewTicker(otpCleanupEvery)
 	defer ticker.Stop()
-	for range ticker.C {
-		c.cleanup()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.cleanup()
+		}
 	}
 }
 
 func (c *otpCache) cleanup() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	now := time.Now()
+	now := c.now()
 	for k, v := range c.entries {
 		if now.After(v.expiresAt) {
 			delete(c.entries, k)
 		}
 	}
-}
-
-// generateOTPCode returns a cryptographically random 6-digit zero-padded code.
-func generateOTPCode() (string, error) {
-	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
-	if err != nil {
-		return "", err
+	for scope := range c.sends {
+		if sends := c.recentSends(scope, now); len(sends) > 0 {
+			c.sends[scope] = sends
+		} else {
+			delete(c.sends, scope)
+		}
 	}
-	return fmt.Sprintf("%06d", n.Int64()), nil
 }
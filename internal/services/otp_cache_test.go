@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"appa_payments/internal/domains"
+)
+
+// newTestOTPCache returns a memory store whose clock is *now.
+func newTestOTPCache(t *testing.T, limits domains.OTPLimits, now *time.Time) *otpCache {
+	t.Helper()
+	c := NewMemoryOTPStore(t.Context(), limits).(*otpCache)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+var testOTPLimits = domains.OTPLimits{MaxAttempts: 3, ResendCooldown: time.Minute, DailySends: 3}
+
+func TestOTPCacheExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	c := newTestOTPCache(t, testOTPLimits, &now)
+	if err := c.Issue(t.Context(), "order:1", nil, "123456"); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	now = now.Add(otpTTL + time.Second)
+	if got, _ := c.Validate(t.Context(), "order:1", "123456"); got != domains.OTPInvalid {
+		t.Fatalf("Validate after expiry = %v, want OTPInvalid", got)
+	}
+}
+
+func TestOTPCacheConsumeOnce(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	c := newTestOTPCache(t, testOTPLimits, &now)
+	if err := c.Issue(t.Context(), "cart:1", nil, "123456"); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if got, _ := c.Validate(t.Context(), "cart:1", "123456"); got != domains.OTPValid {
+		t.Fatalf("first Validate = %v, want OTPValid", got)
+	}
+	if got, _ := c.Validate(t.Context(), "cart:1", "123456"); got != domains.OTPInvalid {
+		t.Fatalf("second Validate = %v, want OTPInvalid", got)
+	}
+}
+
+func TestOTPCacheAttemptLockout(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	c := newTestOTPCache(t, testOTPLimits, &now)
+	if err := c.Issue(t.Context(), "order:1", nil, "123456"); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	want := []domains.OTPVerdict{domains.OTPInvalid, domains.OTPInvalid, domains.OTPLocked}
+	for i, w := range want {
+		if got, _ := c.Validate(t.Context(), "order:1", "000000"); got != w {
+			t.Fatalf("wrong guess %d = %v, want %v", i+1, got, w)
+		}
+	}
+	if got, _ := c.Validate(t.Context(), "order:1", "123456"); got != domains.OTPLocked {
+		t.Fatalf("right code after lockout = %v, want OTPLocked", got)
+	}
+
+	now = now.Add(testOTPLimits.ResendCooldown)
+	if err := c.Issue(t.Context(), "order:1", nil, "654321"); err != nil {
+		t.Fatalf("Issue after lockout: %v", err)
+	}
+	if got, _ := c.Validate(t.Context(), "order:1", "654321"); got != domains.OTPValid {
+		t.Fatalf("new code after lockout = %v, want OTPValid", got)
+	}
+}
+
+func TestOTPCacheResendThrottling(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	c := newTestOTPCache(t, testOTPLimits, &now)
+	scopes := []string{domains.CustomerOTPScope("42")}
+
+	retryAfter := func(err error) time.Duration {
+		t.Helper()
+		var throttled *domains.OTPThrottledError
+		if !errors.As(err, &throttled) {
+			t.Fatalf("Issue error = %v, want *OTPThrottledError", err)
+		}
+		return throttled.RetryAfter
+	}
+
+	if err := c.Issue(t.Context(), "order:1", scopes, "111111"); err != nil {
+		t.Fatalf("first Issue: %v", err)
+	}
+
+	// The cooldown applies to the key and to the customer across keys.
+	now = now.Add(20 * time.Second)
+	if got := retryAfter(c.Issue(t.Context(), "order:1", scopes, "222222")); got != 40*time.Second {
+		t.Fatalf("same key RetryAfter = %v, want 40s", got)
+	}
+	if got := retryAfter(c.Issue(t.Context(), "cart:1", scopes, "222222")); got != 40*time.Second {
+		t.Fatalf("same customer RetryAfter = %v, want 40s", got)
+	}
+
+	// A throttled send doesn't count, and the old code still works.
+	if got, _ := c.Validate(t.Context(), "order:1", "111111"); got != domains.OTPValid {
+		t.Fatalf("Validate of the first code = %v, want OTPValid", got)
+	}
+
+	// Three sends fill the day; the fourth waits for the first to age out.
+	start := now.Add(-20 * time.Second)
+	for i := 0; i < 2; i++ {
+		now = now.Add(testOTPLimits.ResendCooldown)
+		if err := c.Issue(t.Context(), "order:1", scopes, "333333"); err != nil {
+			t.Fatalf("Issue %d: %v", i+2, err)
+		}
+	}
+	now = now.Add(testOTPLimits.ResendCooldown)
+	if got, want := retryAfter(c.Issue(t.Context(), "order:1", scopes, "444444")), start.Add(domains.OTPSendWindow).Sub(now); got != want {
+		t.Fatalf("daily cap RetryAfter = %v, want %v", got, want)
+	}
+
+	now = start.Add(domains.OTPSendWindow + time.Second)
+	if err := c.Issue(t.Context(), "order:1", scopes, "444444"); err != nil {
+		t.Fatalf("Issue after the window: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// otpTTL is how long a code can be used after it is sent.
+const otpTTL = 2 * time.Minute
+
+// setOTPQuery replaces key's code with a fresh, unconsumed one.
+const setOTPQuery = `
+INSERT INTO otp_codes (key, code_hash, expires_at)
+VALUES (@key, @codeHash, @expiresAt)
+ON CONFLICT (key) DO UPDATE SET
+    code_hash = EXCLUDED.code_hash,
+    expires_at = EXCLUDED.expires_at,
+    attempts = 0,
+    consumed_at = NULL,
+    created_at = CURRENT_TIMESTAMP`
+
+// countOTPAttemptQuery spends one guess on key's live code.
+const countOTPAttemptQuery = `
+UPDATE otp_codes SET attempts = attempts + 1
+WHERE key = ? AND consumed_at IS NULL AND expires_at > ?
+RETURNING attempts`
+
+// otpSendLockClass namespaces the transaction advisory locks that serialize
+// sends to one scope.
+const otpSendLockClass = 4043
+
+type otpStore struct {
+	db         *gorm.DB
+	limits     domains.OTPLimits
+	hashSecret []byte
+	logger     *zap.Logger
+}
+
+// NewOTPStore keeps codes in Postgres, as an HMAC under hashSecret, so every
+// instance sees them and they survive a restart.
+func NewOTPStore(db *gorm.DB, limits domains.OTPLimits, hashSecret string, logger *zap.Logger) domains.OTPStore {
+	return &otpStore{db: db, limits: limits, hashSecret: []byte(hashSecret), logger: logger}
+}
+
+func (s *otpStore) Issue(ctx context.Context, key string, scopes []string, code string) (err error) {
+	scopes = append([]string{key}, scopes...)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	// Held until commit, in a stable order, so two requests can't both pass
+	// the check below.
+	for _, scope := range scopes {
+		if err = tx.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", otpSendLockClass, scope).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	var sends []dbModels.OTPSend
+	if err = tx.
+		Where("scope IN ? AND sent_at > ?", scopes, now.Add(-domains.OTPSendWindow)).
+		Order("sent_at").
+		Find(&sends).Error; err != nil {
+		return err
+	}
+	byScope := make(map[string][]time.Time)
+	for _, send := range sends {
+		byScope[send.Scope] = append(byScope[send.Scope], send.SentAt)
+	}
+	var wait time.Duration
+	for _, scope := range scopes {
+		wait = max(wait, domains.OTPSendRetryAfter(s.limits, byScope[scope], now))
+	}
+	if wait > 0 {
+		err = &domains.OTPThrottledError{RetryAfter: wait}
+		return err
+	}
+
+	records := make([]dbModels.OTPSend, 0, len(scopes))
+	for _, scope := range scopes {
+		records = append(records, dbModels.OTPSend{Scope: scope, SentAt: now})
+	}
+	if err = tx.Create(&records).Error; err != nil {
+		return err
+	}
+	err = tx.Exec(setOTPQuery, map[string]any{
+		"key":       key,
+		"codeHash":  s.hashOTP(key, code),
+		"expiresAt": now.Add(otpTTL),
+	}).Error
+	return err
+}
+
+// Validate consumes the code in the same statement that checks it, so two
+// requests racing with the right code can't both pass. Any other answer
+// spends a guess.
+func (s *otpStore) Validate(ctx context.Context, key, code string) (domains.OTPVerdict, error) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).
+		Model(&dbModels.OTPCode{}).
+		Where("key = ? AND code_hash = ? AND consumed_at IS NULL AND expires_at > ? AND attempts < ?",
+			key, s.hashOTP(key, code), now, s.limits.MaxAttempts).
+		Update("consumed_at", now)
+	if result.Error != nil {
+		return domains.OTPInvalid, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return domains.OTPValid, nil
+	}
+
+	var attempts []int
+	if err := s.db.WithContext(ctx).Raw(countOTPAttemptQuery, key, now).Scan(&attempts).Error; err != nil {
+		return domains.OTPInvalid, err
+	}
+	if len(attempts) > 0 && attempts[0] >= s.limits.MaxAttempts {
+		return domains.OTPLocked, nil
+	}
+	return domains.OTPInvalid, nil
+}
+
+func (s *otpStore) PurgeExpired(ctx context.Context) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).
+		Where("expires_at < ? OR consumed_at IS NOT NULL", now).
+		Delete(&dbModels.OTPCode{})
+	if result.Error != nil {
+		s.logger.Error("otp store: failed to purge expired codes", zap.Error(result.Error))
+		return
+	}
+	sends := s.db.WithContext(ctx).
+		Where("sent_at < ?", now.Add(-domains.OTPSendWindow)).
+		Delete(&dbModels.OTPSend{})
+	if sends.Error != nil {
+		s.logger.Error("otp store: failed to purge old sends", zap.Error(sends.Error))
+		return
+	}
+	s.logger.Info("otp store: purged expired codes",
+		zap.Int64("codes", result.RowsAffected),
+		zap.Int64("sends", sends.RowsAffected))
+}
+
+// hashOTP keys the hash with the server secret, so a leaked table can't be
+// brute-forced over the million codes, and mixes in the key, so equal codes
+// for different orders don't hash alike.
+func (s *otpStore) hashOTP(key, code string) string {
+	mac := hmac.New(sha256.New, s.hashSecret)
+	mac.Write([]byte(key + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateOTPCode returns a cryptographically random 6-digit zero-padded code.
+func generateOTPCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
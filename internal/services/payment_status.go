@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// GetPaymentStatus gathers every attempt to pay orderID across rails, the
+// refunds made against it and any pending recurrent retry, and computes its
+// overall state.
+func (p *paymentService) GetPaymentStatus(
+	ctx context.Context, orderID string, orderType models.OrderType,
+) (*models.PaymentStatusResponse, error) {
+	target, err := p.GetChargeableByID(ctx, orderID, orderType)
+	if err != nil {
+		p.logger.Error("failed to get order for payment status", zap.Error(err), zap.String("orderID", orderID))
+		return nil, err
+	}
+
+	status := &models.PaymentStatusResponse{
+		OrderID:         orderID,
+		OrderName:       target.Name,
+		OrderType:       target.Type,
+		AmountUSD:       target.AmountUSD,
+		FinancialStatus: target.FinancialStatus,
+		Attempts:        []models.PaymentAttempt{},
+		Refunds:         []dbModels.R4AppaMobilePaymentReversal{},
+	}
+	facts := domains.PaymentStateFacts{FinancialStatus: target.FinancialStatus}
+	query := p.db.WithContext(ctx)
+
+	var debits []dbModels.R4AppaDebitDirect
+	if err := query.Where("order_id = ?", orderID).Order("created_at").Find(&debits).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range debits {
+		approved := d.Code == domains.R4CodeApproved
+		if approved && d.RefundedAt == nil {
+			facts.Charges++
+		}
+		facts.InFlight = facts.InFlight || domains.IsR4BreakCode(d.Code)
+		status.Attempts = append(status.Attempts, models.PaymentAttempt{
+			Rail:       domains.RailDebitoInmediato,
+			Reference:  d.Reference,
+			Code:       d.Code,
+			Success:    approved,
+			AmountVES:  &d.Amount,
+			RefundedAt: d.RefundedAt,
+			CreatedAt:  d.CreatedAt,
+		})
+	}
+
+	var accounts []dbModels.R4DebitDirectAccount
+	if err := query.Where("order_id = ? OR draft_id = ?", orderID, orderID).Order("created_at").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range accounts {
+		if a.Success {
+			facts.Charges++
+		}
+		status.Attempts = append(status.Attempts, models.PaymentAttempt{
+			Rail:      domains.RailDomiciliacion,
+			Reference: a.Reference,
+			Code:      a.Code,
+			Success:   a.Success,
+			AmountVES: &a.Amount,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+
+	var mobiles []dbModels.R4AppaMobilePayment
+	if err := query.Where("order_id::text = ?", orderID).Order("created_at").Find(&mobiles).Error; err != nil {
+		return nil, err
+	}
+	references := []string{}
+	for _, m := range mobiles {
+		if m.RefundedAt == nil {
+			facts.Charges++
+		}
+		references = append(references, m.Reference)
+		status.Attempts = append(status.Attempts, models.PaymentAttempt{
+			Rail:       domains.RailPagoMovil,
+			Reference:  m.Reference,
+			Success:    true,
+			AmountVES:  &m.Amount,
+			RefundedAt: m.RefundedAt,
+			CreatedAt:  m.CreatedAt,
+		})
+	}
+
+	var manuals []dbModels.ManualOrder
+	if err := query.Where("order_id::text = ?", orderID).Order("created_at").Find(&manuals).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range manuals {
+		switch m.ValidateStatus {
+		case domains.ManualOrderStatusApproved:
+			facts.Charges++
+		case domains.ManualOrderStatusPending, domains.ManualOrderStatusApproving:
+			facts.InFlight = true
+		}
+		status.Attempts = append(status.Attempts, manualOrderAttempt(m))
+	}
+
+	// Reversals only carry the order name, or the reference of the pago
+	// móvil they return money from.
+	refunds := query.Where("order_name = ?", target.Name)
+	if len(references) > 0 {
+		refunds = refunds.Or("reference IN ?", references)
+	}
+	if err := refunds.Order("created_at").Find(&status.Refunds).Error; err != nil {
+		return nil, err
+	}
+	facts.FailedRefunds = unsettledFailedRefunds(status.Refunds)
+
+	var pending dbModels.RecurrentPendingPayment
+	if err := query.Where("order_id = ?", orderID).Limit(1).Find(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending.ID != 0 {
+		status.PendingRetry = &pending
+		facts.PendingRetry = pending.GaveUpAt == nil
+	}
+
+	status.State = domains.PaymentState(facts)
+	return status, nil
+}
+
+// manualOrderAttempt shows a manual receipt as an attempt. Manual pago móvil
+// amounts are bolívares; Zelle and cash are dollars.
+func manualOrderAttempt(m dbModels.ManualOrder) models.PaymentAttempt {
+	attempt := models.PaymentAttempt{
+		Code:      m.ValidateStatus,
+		Success:   m.ValidateStatus == domains.ManualOrderStatusApproved,
+		CreatedAt: m.CreatedAt,
+	}
+	switch m.PaymentMethodID {
+	case domains.PaymentMethodZelle:
+		attempt.Rail, attempt.AmountUSD = domains.RailZelle, &m.Amount
+	case domains.PaymentMethodCash:
+		attempt.Rail, attempt.AmountUSD = domains.RailEfectivo, &m.Amount
+	default:
+		attempt.Rail, attempt.AmountVES, attempt.AmountUSD = domains.RailPagoMovilManual, &m.Amount, &m.OrderTotalAmount
+	}
+	return attempt
+}
+
+// unsettledFailedRefunds counts failed refunds not followed by a successful
+// one for the same reference and reason.
+func unsettledFailedRefunds(refunds []dbModels.R4AppaMobilePaymentReversal) int {
+	type key struct{ reference, reason string }
+	settled := make(map[key]time.Time)
+	for _, r := range refunds {
+		if r.Success {
+			settled[key{r.Reference, r.Reason}] = r.CreatedAt
+		}
+	}
+
+	count := 0
+	for _, r := range refunds {
+		if r.Success {
+			continue
+		}
+		if at, ok := settled[key{r.Reference, r.Reason}]; ok && !at.Before(r.CreatedAt) {
+			continue
+		}
+		count++
+	}
+	return count
+}
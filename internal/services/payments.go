@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"appa_payments/internal/domains"
 	"appa_payments/internal/models"
@@ -33,8 +35,17 @@ type paymentService struct {
 	db                        *gorm.DB
 	location                  *time.Location
 	logger                    *zap.Logger
-	otpCache                  *otpCache
+	otpStore                  domains.OTPStore
+	affiliations              domains.AffiliationService
+	audit                     domains.AuditService
+	ledger                    domains.LedgerService
+	chargeLock                domains.ChargeLocker
+	igtfRates                 domains.IGTFRates
 	recurrentDirectDebitAppID string
+
+	// inflight tracks work that outlives its request: a débito inmediato
+	// being settled, customer data being saved. See Drain.
+	inflight sync.WaitGroup
 }
 
 const (
@@ -45,6 +56,27 @@ func (p *paymentService) debitImmediateGenericError() error {
 	return errors.New(_debitImmediateGenericError)
 }
 
+// chargeOutcomeUnknownError reads as the generic error to the buyer and
+// matches domains.ErrChargeOutcomeUnknown for the webhook queue and the
+// handlers, which keep the request's Idempotency-Key.
+type chargeOutcomeUnknownError struct{}
+
+func (chargeOutcomeUnknownError) Error() string { return _debitImmediateGenericError }
+
+func (chargeOutcomeUnknownError) Is(target error) bool {
+	return target == domains.ErrChargeOutcomeUnknown
+}
+
+// lockCharge takes the charge lock of an order or draft; see
+// domains.ChargeLocker.
+func (p *paymentService) lockCharge(ctx context.Context, orderType models.OrderType, orderID string) (func(), error) {
+	unlock, err := p.chargeLock.Lock(ctx, domains.OrderChargeLockKey(string(orderType), stripOrderGIDPrefix(orderID)))
+	if err != nil && !errors.Is(err, domains.ErrPaymentInProgress) {
+		p.logger.Error("failed to take charge lock", zap.Error(err), zap.String("orderID", orderID))
+	}
+	return unlock, err
+}
+
 func NewPaymentService(
 	db *gorm.DB,
 	shopifyRepo shopify.Repository,
@@ -53,6 +85,12 @@ func NewPaymentService(
 	driveClient drive.Client,
 	mailgunRepo mailgun.Repository,
 	location *time.Location,
+	audit domains.AuditService,
+	ledger domains.LedgerService,
+	chargeLock domains.ChargeLocker,
+	otpStore domains.OTPStore,
+	affiliations domains.AffiliationService,
+	igtfRates domains.IGTFRates,
 	recurrentDirectDebitAppID string,
 	logger *zap.Logger,
 ) *paymentService {
@@ -65,7 +103,12 @@ func NewPaymentService(
 		db:                        db,
 		location:                  location,
 		logger:                    logger,
-		otpCache:                  newOTPCache(),
+		otpStore:                  otpStore,
+		affiliations:              affiliations,
+		audit:                     audit,
+		ledger:                    ledger,
+		chargeLock:                chargeLock,
+		igtfRates:                 igtfRates,
 		recurrentDirectDebitAppID: recurrentDirectDebitAppID,
 	}
 }
@@ -77,17 +120,24 @@ func (p *paymentService) ValidateMobilePayment(
 ) *models.MobilePaymentResponse {
 	var (
 		item      dbModels.R4AppaMobilePayment
-		query     = p.db.Model(&dbModels.R4AppaMobilePayment{}).WithContext(ctx).Select("r4_appa_mobile_payments.*")
 		count     = 0
 		maxintent = 3
 		response  = &models.MobilePaymentResponse{Success: false}
-		tx        = p.db.Begin()
 		errDB     error
 	)
-	defer db.DBRollback(tx, &errDB)
 
 	orderType := models.OrderTypeOrDefault(req.TypeOrder)
 
+	unlock, err := p.lockCharge(ctx, orderType, req.OrderID)
+	if err != nil {
+		response.Message = domains.MobilePaymentInternalError
+		if errors.Is(err, domains.ErrPaymentInProgress) {
+			response.Message = domains.PaymentInProgressMessage
+		}
+		return response
+	}
+	defer unlock()
+
 	// Get BCV Tasa
 	BCVTasa, err := p.bcvClient.Get(ctx)
 	if err != nil {
@@ -95,6 +145,15 @@ func (p *paymentService) ValidateMobilePayment(
 		return response
 	}
 
+	// The transaction begins once the charge lock is held. The matched row
+	// stays locked until it ends; a concurrent request skips it and looks
+	// for another.
+	tx := p.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &errDB)
+	query := tx.Model(&dbModels.R4AppaMobilePayment{}).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Select("r4_appa_mobile_payments.*")
+
 	// Apply filters
 	query = p.getMobilePaymentsFilters(query, req)
 	for count < maxintent {
@@ -130,7 +189,7 @@ func (p *paymentService) ValidateMobilePayment(
 
 	if verdict == domains.Underpaid {
 		response, err := p.mobilePaymentLessTotalAmount(
-			ctx, tx, item, req.OrderName, currentOrderPrice, dni,
+			ctx, tx, item, req.OrderName, currentOrderPrice, dni, stripCustomerGIDPrefix(target.Customer.ID),
 		)
 		errDB = err
 		return response
@@ -143,17 +202,38 @@ func (p *paymentService) ValidateMobilePayment(
 		return response
 	}
 
+	if errDB = claimMobilePayment(tx, &item, map[string]any{
+		"order_id":   orderID,
+		"order_name": req.OrderName,
+	}); errDB != nil {
+		p.logger.Error("failed to claim mobile payment", zap.Error(errDB), zap.Int("paymentId", item.ID))
+		response.Message = domains.MobilePaymentInternalError
+		if errors.Is(errDB, errMobilePaymentClaimed) {
+			response.Message = domains.MobilePaymentNotFoundMessage
+		}
+		return response
+	}
 	item.OrderID = &orderID
 	item.OrderName = req.OrderName
-	item.UpdatedAt = time.Now()
-	if err := tx.Save(&item).Error; err != nil {
+	customerID := stripCustomerGIDPrefix(target.Customer.ID)
+	if errDB = p.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:       domains.LedgerKindCharge,
+		Account:    domains.LedgerAccountR4,
+		AmountVES:  item.Amount,
+		Source:     item.TableName(),
+		SourceID:   item.ID,
+		Reference:  item.Reference,
+		OrderID:    req.OrderID,
+		OrderName:  req.OrderName,
+		CustomerID: customerID,
+	}); errDB != nil {
 		response.Message = domains.MobilePaymentInternalError
 		return response
 	}
 
 	response.Success = true
 	if verdict == domains.Overpaid {
-		response.Message = p.mobilePaymentGreaterTotalAmount(ctx, item, req.OrderName, currentOrderPrice, dni)
+		response.Message = p.mobilePaymentGreaterTotalAmount(ctx, item, req.OrderName, currentOrderPrice, dni, customerID)
 	} else {
 		response.Message = domains.MobilePaymentSuccessfulMessage
 	}
@@ -176,17 +256,22 @@ func (p *paymentService) ValidateMobilePayment(
 			if err := tx.Save(&item).Error; err != nil {
 				p.logger.Error("failed to update mobile payment with completed order id", zap.Error(err), zap.Int("paymentId", item.ID))
 			}
+			if err := p.ledger.ReassignOrder(ctx, tx, req.OrderID, completed.LegacyOrderID, completed.Name); err != nil {
+				p.logger.Error("failed to move ledger entries to completed order", zap.Error(err), zap.String("draftId", req.OrderID))
+			}
 		} else {
 			p.logger.Error("failed to parse completed order legacy id", zap.Error(err), zap.String("legacyOrderId", completed.LegacyOrderID))
 		}
 	}
 
 	if !req.Automatic {
-		go p.updateDebitDirectData(ctx, target.Customer.ID, models.DebitDirect{
-			Bank:    req.Bank,
-			Phone:   req.Phone,
-			DNI:     req.DNI,
-			DNIType: req.DNIType,
+		p.inflight.Go(func() {
+			p.updateDebitDirectData(ctx, target.Customer.ID, models.DebitDirect{
+				Bank:    req.Bank,
+				Phone:   req.Phone,
+				DNI:     req.DNI,
+				DNIType: req.DNIType,
+			})
 		})
 	}
 
@@ -200,6 +285,22 @@ func (p *paymentService) ValidateDirectDebit(
 ) error {
 	orderType := models.OrderTypeOrDefault(req.TypeOrder)
 
+	// The lock is held until the operation settles, which may be after
+	// this returns.
+	unlock, err := p.lockCharge(ctx, orderType, req.OrderID)
+	if err != nil {
+		if errors.Is(err, domains.ErrPaymentInProgress) {
+			return err
+		}
+		return errors.New(_debitImmediateGenericError)
+	}
+	settling := false
+	defer func() {
+		if !settling {
+			unlock()
+		}
+	}()
+
 	// Get BCV Tasa
 	BCVTasa, err := p.bcvClient.Get(ctx)
 	if err != nil {
@@ -227,37 +328,43 @@ func (p *paymentService) ValidateDirectDebit(
 	})
 	if err != nil {
 		p.logger.Error(err.Error())
-		return errors.New(_debitImmediateGenericError)
+		if r4bank.Declined(err) {
+			return errors.New(_debitImmediateGenericError)
+		}
+		return chargeOutcomeUnknownError{}
+	}
+
+	settling = true
+	operation := dbModels.R4AppaDebitDirect{
+		SenderPhone: req.Phone,
+		IssuingBank: req.Bank,
+		Amount:      currentOrderPrice,
+		Reference:   r4Resp.Reference,
+		DNI:         fmt.Sprintf("%s-%s", req.DNIType, req.DNI),
+		Code:        r4Resp.Code,
+		Success:     r4Resp.Status,
+		OrderName:   target.Name,
+		OrderID:     req.OrderID,
+		OrderType:   string(orderType),
+		Date:        time.Now().In(p.location),
+		CreatedAt:   time.Now(),
 	}
-
-	go p.waitForOperationCompletion(
-		r4Resp.ID,
-		dbModels.R4AppaDebitDirect{
-			SenderPhone: req.Phone,
-			IssuingBank: req.Bank,
-			Amount:      currentOrderPrice,
-			Reference:   r4Resp.Reference,
-			DNI:         fmt.Sprintf("%s-%s", req.DNIType, req.DNI),
-			Code:        r4Resp.Code,
-			Success:     r4Resp.Status,
-			OrderName:   target.Name,
-			OrderID:     req.OrderID,
-			OrderType:   string(orderType),
-			Date:        time.Now().In(p.location),
-			CreatedAt:   time.Now(),
-		},
-	)
+	p.inflight.Go(func() {
+		p.waitForOperationCompletion(unlock, r4Resp.ID, stripCustomerGIDPrefix(target.Customer.ID), operation)
+	})
 
 	if domains.IsR4BreakCode(r4Resp.Code) {
 		p.logger.Warn("debit direct is being processed", zap.Any("response", r4Resp), zap.Any("order", target.Name))
 		return fmt.Errorf("EN_PROCESO")
 	}
 
-	go p.updateDebitDirectData(ctx, target.Customer.ID, models.DebitDirect{
-		Bank:    req.Bank,
-		Phone:   req.Phone,
-		DNI:     req.DNI,
-		DNIType: req.DNIType,
+	p.inflight.Go(func() {
+		p.updateDebitDirectData(ctx, target.Customer.ID, models.DebitDirect{
+			Bank:    req.Bank,
+			Phone:   req.Phone,
+			DNI:     req.DNI,
+			DNIType: req.DNIType,
+		})
 	})
 
 	return nil
@@ -307,9 +414,13 @@ func (p *paymentService) updateDebitDirectData(ctx context.Context, customerID s
 
 // waitForOperationCompletion waits for the operation to complete
 func (p *paymentService) waitForOperationCompletion(
+	unlock func(),
 	operationID string,
+	customerID string,
 	log dbModels.R4AppaDebitDirect,
 ) {
+	defer unlock()
+
 	intents := 0
 	for domains.IsR4BreakCode(log.Code) && intents < 10 {
 		resp, err := p.r4Repo.GetOperationByID(context.Background(), operationID)
@@ -348,7 +459,25 @@ func (p *paymentService) waitForOperationCompletion(
 
 	p.logger.Info("debit direct operation completed", zap.Any("log", log), zap.Any("response_code", log.Code))
 
-	p.registerDebitDirectPayment(context.Background(), log)
+	p.registerDebitDirectPayment(context.Background(), log, customerID)
+}
+
+// Drain waits for the work started by requests that is still running in the
+// background — débitos inmediatos being polled and finalized, above all —
+// until ctx is done. Call it once the HTTP server has stopped taking
+// requests.
+func (p *paymentService) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // markOrderAsPaid marks an order as paid in Shopify
@@ -374,6 +503,8 @@ type Chargeable struct {
 	Customer  shopify.Customer
 	Tags      []string
 	App       *shopify.App // only set for Complete; a draft has no App yet
+	// FinancialStatus is only set for Complete; a draft has none.
+	FinancialStatus string
 }
 
 // GetChargeableByID resolves an Order or a DraftOrder into one common shape.
@@ -411,6 +542,8 @@ func (p *paymentService) GetChargeableByID(
 			Customer:  o.Customer,
 			Tags:      o.Tags,
 			App:       o.App,
+
+			FinancialStatus: o.DisplayFinancialStatus,
 		}, nil
 	}
 }
@@ -454,6 +587,49 @@ func (p *paymentService) finalizeCharge(
 	return completed, nil
 }
 
+// FinalizeOrder settles an order or draft whose payment was confirmed
+// outside the rails this service charges — a manual receipt a reviewer
+// approved. Same finalizeCharge as every other rail.
+func (p *paymentService) FinalizeOrder(
+	ctx context.Context, orderID string, orderType models.OrderType,
+) (*models.FinalizedOrder, error) {
+	target, err := p.GetChargeableByID(ctx, orderID, orderType)
+	if err != nil {
+		p.logger.Error("failed to get order to finalize", zap.Error(err), zap.String("orderID", orderID))
+		return nil, err
+	}
+
+	completed, err := p.finalizeCharge(ctx, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &models.FinalizedOrder{
+		OrderID:   orderID,
+		OrderName: target.Name,
+	}
+	if completed != nil {
+		out.OrderID = completed.LegacyOrderID
+		out.OrderName = completed.Name
+		out.StatusPageURL = completed.StatusPageURL
+		out.FinancialStatus = completed.DisplayFinancialStatus
+		return out, nil
+	}
+
+	// markAsPaid answers nothing about the order: read back what Shopify
+	// holds, and leave the status out if that fails.
+	legacyID := stripOrderGIDPrefix(target.GID)
+	statuses, err := p.shopifyRepo.GetOrdersStatus(ctx, []string{legacyID})
+	if err != nil {
+		p.logger.Warn("failed to read finalized order status", zap.Error(err), zap.String("orderID", legacyID))
+		return out, nil
+	}
+	if status, ok := statuses[legacyID]; ok {
+		out.FinancialStatus = status.DisplayFinancialStatus
+	}
+	return out, nil
+}
+
 func (p *paymentService) alertDraftFinalizationFailed(ctx context.Context, target *Chargeable, reason string, cause error) {
 	if mailErr := p.mailgunRepo.SendSupportAlert(ctx, mailgun.SupportAlertRequest{
 		OrderName: target.Name,
@@ -469,19 +645,64 @@ func stripOrderGIDPrefix(gid string) string {
 	return gid
 }
 
-// registerDebitDirectPayment registers a debit direct payment
+func stripCustomerGIDPrefix(gid string) string {
+	return strings.ReplaceAll(gid, shopify.CustomerKindID, "")
+}
+
+// registerDebitDirectPayment registers a debit direct payment, posting it
+// to the ledger in the same transaction when R4 approved it
 func (p *paymentService) registerDebitDirectPayment(
 	ctx context.Context,
 	req dbModels.R4AppaDebitDirect,
+	customerID string,
 ) {
-	if err := p.db.WithContext(ctx).Create(&req).Error; err != nil {
+	var err error
+	tx := p.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(&req).Error; err != nil {
 		p.logger.Error("failed to register debit direct payment", zap.Error(err))
+		return
+	}
+	if req.Code != domains.R4CodeApproved {
+		return
 	}
+	err = p.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:       domains.LedgerKindCharge,
+		Account:    domains.LedgerAccountR4,
+		AmountVES:  req.Amount,
+		Source:     req.TableName(),
+		SourceID:   req.ID,
+		Reference:  req.Reference,
+		OrderID:    stripOrderGIDPrefix(req.OrderID),
+		OrderName:  req.OrderName,
+		CustomerID: customerID,
+	})
+}
+
+// mobilePaymentUnclaimed matches pago móvil rows no order, cart or refund has
+// claimed yet.
+const mobilePaymentUnclaimed = "order_id IS NULL AND cart_id IS NULL AND refunded_at IS NULL"
+
+// errMobilePaymentClaimed means another request claimed the row first.
+var errMobilePaymentClaimed = errors.New("mobile payment already claimed")
+
+// claimMobilePayment links item to an order or cart with values, only if
+// nothing claimed it since it was read.
+func claimMobilePayment(tx *gorm.DB, item *dbModels.R4AppaMobilePayment, values map[string]any) error {
+	result := tx.Model(item).Where(mobilePaymentUnclaimed).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errMobilePaymentClaimed
+	}
+	return nil
 }
 
 // getMobilePaymentsFilters retrieves mobile payment filters
 func (p *paymentService) getMobilePaymentsFilters(query *gorm.DB, filters models.ValidateMobilePaymentRequest) *gorm.DB {
-	query = query.Where("order_id IS NULL") // only unlinked payments
+	query = query.Where(mobilePaymentUnclaimed)
 
 	if filters.Bank != "" {
 		query = query.Where("issuing_bank = ?", filters.Bank)
@@ -510,6 +731,7 @@ func (p *paymentService) mobilePaymentLessTotalAmount(
 	orderName string,
 	currentOrderPrice float64,
 	dni string,
+	customerID string,
 ) (*models.MobilePaymentResponse, error) {
 	response := &models.MobilePaymentResponse{
 		Success: false,
@@ -517,11 +739,27 @@ func (p *paymentService) mobilePaymentLessTotalAmount(
 	}
 	p.logger.Warn("payment amount is less than order total", zap.String("order", orderName), zap.Float64("order_total", currentOrderPrice), zap.Float64("payment_amount", item.Amount))
 
-	// Delete mobile payment to avoid future conflicts
-	err := p.deleteMobilePayment(ctx, tx, item.ID)
+	// Delete mobile payment to avoid future conflicts. The money still came
+	// in, so it's posted without an order; the refund below nets it out.
+	err := p.deleteMobilePayment(ctx, tx, item)
+	if errors.Is(err, errMobilePaymentClaimed) {
+		response.Message = domains.MobilePaymentNotFoundMessage
+		return response, err
+	}
 	if err != nil {
 		return response, err
 	}
+	if err := p.ledger.Post(ctx, tx, domains.LedgerPosting{
+		Kind:       domains.LedgerKindCharge,
+		Account:    domains.LedgerAccountR4,
+		AmountVES:  item.Amount,
+		Source:     item.TableName(),
+		SourceID:   item.ID,
+		Reference:  item.Reference,
+		CustomerID: customerID,
+	}); err != nil {
+		return response, err
+	}
 	// Return money to sender
 	err = p.r4Repo.ChangePaid(ctx, r4bank.ChangePaidRequest{
 		Bank:    item.IssuingBank,
@@ -530,7 +768,7 @@ func (p *paymentService) mobilePaymentLessTotalAmount(
 		DNI:     dni,
 		Concept: fmt.Sprintf("DMT (%s)", orderName),
 	})
-	go p.registerMobilePaymentReversal(item, orderName, currentOrderPrice, item.Amount, "LESS", err)
+	p.registerMobilePaymentReversal(ctx, item, orderName, currentOrderPrice, item.Amount, "LESS", err, customerID)
 
 	if err != nil {
 		p.logger.Error("failed to return money to sender", zap.Error(err), zap.Any("payment", item))
@@ -542,8 +780,10 @@ func (p *paymentService) mobilePaymentLessTotalAmount(
 	return response, nil
 }
 
-// registerMobilePaymentReversal records a reversal result (success or error)
-func (p *paymentService) registerMobilePaymentReversal(item dbModels.R4AppaMobilePayment, orderName string, orderAmount, reversalAmount float64, reason string, changePaidErr error) {
+// registerMobilePaymentReversal records a reversal result (success or error).
+// A successful one is posted to the ledger with the record: an excess back
+// to the order's payer, or a refund of a payment that never applied.
+func (p *paymentService) registerMobilePaymentReversal(ctx context.Context, item dbModels.R4AppaMobilePayment, orderName string, orderAmount, reversalAmount float64, reason string, changePaidErr error, customerID string) {
 	record := dbModels.R4AppaMobilePaymentReversal{
 		Reference:      item.Reference,
 		OrderName:      orderName,
@@ -555,25 +795,71 @@ func (p *paymentService) registerMobilePaymentReversal(item dbModels.R4AppaMobil
 	if changePaidErr != nil {
 		record.ErrorDetail = changePaidErr.Error()
 	}
-	if err := p.db.Create(&record).Error; err != nil {
+	if err := p.createMobilePaymentReversal(ctx, &record, item, customerID); err != nil {
 		p.logger.Error("failed to register mobile payment reversal", zap.Error(err), zap.Any("record", record))
 	}
+
+	p.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionMobilePaymentRefund,
+		SubjectType: domains.AuditSubjectOrder,
+		SubjectID:   orderName,
+		Before:      item,
+		After:       record,
+	})
 }
 
-// deleteMobilePayment deletes a mobile payment by ID
-func (p *paymentService) deleteMobilePayment(ctx context.Context, tx *gorm.DB, id int) error {
-	if err := tx.WithContext(ctx).Delete(&dbModels.R4AppaMobilePayment{}, id).Error; err != nil {
-		p.logger.Error("failed to delete mobile payment", zap.Error(err), zap.Any("id", id))
+func (p *paymentService) createMobilePaymentReversal(
+	ctx context.Context, record *dbModels.R4AppaMobilePaymentReversal, item dbModels.R4AppaMobilePayment, customerID string,
+) (err error) {
+	tx := p.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(record).Error; err != nil || !record.Success {
 		return err
 	}
+	posting := domains.LedgerPosting{
+		Kind:       domains.LedgerKindRefund,
+		Account:    domains.LedgerAccountR4,
+		AmountVES:  record.ReversalAmount,
+		Source:     record.TableName(),
+		SourceID:   record.ID,
+		Reference:  item.Reference,
+		CustomerID: customerID,
+	}
+	if record.Reason == "GREATER" && item.OrderID != nil {
+		posting.Kind = domains.LedgerKindExcess
+		posting.OrderID = strconv.Itoa(*item.OrderID)
+		posting.OrderName = item.OrderName
+	}
+	return p.ledger.Post(ctx, tx, posting)
+}
+
+// deleteMobilePayment deletes a mobile payment nothing else has claimed,
+// keeping the deleted row in the audit log
+func (p *paymentService) deleteMobilePayment(ctx context.Context, tx *gorm.DB, item dbModels.R4AppaMobilePayment) error {
+	result := tx.WithContext(ctx).Where(mobilePaymentUnclaimed).Delete(&dbModels.R4AppaMobilePayment{}, item.ID)
+	if result.Error != nil {
+		p.logger.Error("failed to delete mobile payment", zap.Error(result.Error), zap.Any("id", item.ID))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errMobilePaymentClaimed
+	}
+
+	p.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionMobilePaymentDelete,
+		SubjectType: domains.AuditSubjectMobilePayment,
+		SubjectID:   strconv.Itoa(item.ID),
+		Before:      item,
+	})
 
-	p.logger.Debug("mobile payment deleted", zap.Any("id", id))
+	p.logger.Debug("mobile payment deleted", zap.Any("id", item.ID))
 	return nil
 }
 
 // mobilePaymentGreaterTotalAmount
 func (p *paymentService) mobilePaymentGreaterTotalAmount(
-	ctx context.Context, item dbModels.R4AppaMobilePayment, orderName string, currentOrderPrice float64, dni string,
+	ctx context.Context, item dbModels.R4AppaMobilePayment, orderName string, currentOrderPrice float64, dni, customerID string,
 ) string {
 	p.logger.Warn("payment amount is greater than order total", zap.String("order", orderName), zap.Float64("order_total", currentOrderPrice), zap.Float64("payment_amount", item.Amount))
 
@@ -585,7 +871,7 @@ func (p *paymentService) mobilePaymentGreaterTotalAmount(
 		DNI:     dni,
 		Concept: fmt.Sprintf("DMT (%s)", orderName),
 	})
-	go p.registerMobilePaymentReversal(item, orderName, currentOrderPrice, amount, "GREATER", err)
+	p.registerMobilePaymentReversal(ctx, item, orderName, currentOrderPrice, amount, "GREATER", err, customerID)
 
 	if err != nil {
 		p.logger.Error("failed to return money to sender", zap.Error(err), zap.Any("payment", item))
@@ -606,9 +892,8 @@ func (p *paymentService) ValidateMobilePaymentManual(
 	ctx context.Context,
 	req models.ValidateMobilePaymentManualRequest,
 ) error {
-	var dbError error
-
-	target, err := p.GetChargeableByID(ctx, req.OrderID, models.OrderTypeOrDefault(req.TypeOrder))
+	orderType := models.OrderTypeOrDefault(req.TypeOrder)
+	target, err := p.GetChargeableByID(ctx, req.OrderID, orderType)
 	if err != nil {
 		return err // or custom error
 	}
@@ -618,50 +903,18 @@ func (p *paymentService) ValidateMobilePaymentManual(
 		return err
 	}
 
-	orderID, err := strconv.Atoi(req.OrderID)
-	if err != nil {
-		p.logger.Error(err.Error(), zap.Any("order", target))
-		return errors.New("invalid order ID")
-	}
-
 	var amount float64
 	if value, err := strconv.ParseFloat(target.AmountUSD, 64); err == nil {
 		amount = value
 	}
 
-	manualOrder := dbModels.ManualOrder{
+	return p.createManualOrder(ctx, req.OrderID, req.BillImageFile, dbModels.ManualOrder{
 		OrderName:        req.OrderName,
-		OrderID:          orderID,
+		OrderType:        string(orderType),
 		Amount:           amount * tasaBCV,
 		OrderTotalAmount: amount,
-		ValidateStatus:   "PENDING",
-		PaymentMethodID:  4, // Pago Móvil
-	}
-
-	url, err := p.driveClient.UploadFile(ctx, req.BillImageFile)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if dbError == nil {
-			return
-		}
-
-		err := p.driveClient.DeleteFile(ctx, url)
-		if err != nil {
-			p.logger.Error("failed to delete file from google drive", zap.Any("url", url))
-		}
-	}()
-
-	manualOrder.BillImageURL = url
-
-	dbError = p.db.Create(&manualOrder).Error
-	if dbError != nil {
-		p.logger.Error(dbError.Error(), zap.Any("order", manualOrder))
-		return dbError
-	}
-
-	return nil
+		PaymentMethodID:  domains.PaymentMethodMobilePayment,
+	})
 }
 
 // RequestDirectDebitAccountOTP generates a 6-digit OTP, stores it in the cache,
@@ -679,7 +932,16 @@ func (p *paymentService) RequestDirectDebitAccountOTP(ctx context.Context, order
 		return errors.New(_debitImmediateGenericError)
 	}
 
-	p.otpCache.Set(orderID, code)
+	scopes := []string{domains.CustomerOTPScope(stripCustomerGIDPrefix(target.Customer.ID))}
+	if err := p.otpStore.Issue(ctx, domains.OrderOTPKey(orderID), scopes, code); err != nil {
+		var throttled *domains.OTPThrottledError
+		if errors.As(err, &throttled) {
+			p.logger.Warn("OTP resend throttled", zap.String("orderID", orderID), zap.Duration("retryAfter", throttled.RetryAfter))
+			return err
+		}
+		p.logger.Error("failed to store OTP code", zap.Error(err), zap.String("orderID", orderID))
+		return errors.New(_debitImmediateGenericError)
+	}
 
 	return p.mailgunRepo.SendOTPEmail(ctx, mailgun.OTPEmailRequest{
 		To:                target.Customer.Email,
@@ -694,7 +956,17 @@ func (p *paymentService) DirectDebitAccount(
 	ctx context.Context,
 	req models.DirectDebitAccountRequest,
 ) (*models.ProcessDirectDebitAccountResponse, error) {
-	target, err := p.GetChargeableByID(ctx, req.OrderID, models.OrderTypeOrDefault(req.TypeOrder))
+	orderType := models.OrderTypeOrDefault(req.TypeOrder)
+	unlock, err := p.lockCharge(ctx, orderType, req.OrderID)
+	if err != nil {
+		if errors.Is(err, domains.ErrPaymentInProgress) {
+			return nil, err
+		}
+		return nil, p.debitImmediateGenericError()
+	}
+	defer unlock()
+
+	target, err := p.GetChargeableByID(ctx, req.OrderID, orderType)
 	if err != nil {
 		p.logger.Error("failed to get order from Shopify", zap.Error(err), zap.String("orderID", req.OrderID))
 		return nil, p.debitImmediateGenericError()
@@ -728,6 +1000,13 @@ func (p *paymentService) DirectDebitAccount(
 	if err != nil {
 		return nil, err
 	}
+	p.affiliations.RecordCharge(ctx, domains.AffiliationCharge{
+		CustomerID:   target.Customer.ID,
+		Account:      req.Account,
+		DNI:          req.DNI,
+		ResponseCode: resp.Code,
+		OrderID:      target.GID,
+	})
 
 	if !resp.Success {
 		return resp, nil
@@ -760,10 +1039,43 @@ func (p *paymentService) DirectDebitAccount(
 func (p *paymentService) DirectDebitAccountWithOTP(
 	ctx context.Context,
 	req models.DirectDebitAccountWithOTPRequest,
+) (*models.ProcessDirectDebitAccountResponse, error) {
+	return p.directDebitAccountWithOTP(ctx, req, false)
+}
+
+// ChargeRecurring charges an order or draft this service created itself, a
+// subscription's, on the recurring path: no OTP, and the dedup check against
+// earlier successful charges. Never reachable from a request.
+func (p *paymentService) ChargeRecurring(
+	ctx context.Context, orderID string, orderType models.OrderType,
+) (*models.ProcessDirectDebitAccountResponse, error) {
+	return p.directDebitAccountWithOTP(ctx, models.DirectDebitAccountWithOTPRequest{
+		OrderID:   orderID,
+		TypeOrder: &orderType,
+	}, true)
+}
+
+// directDebitAccountWithOTP charges req's order. The OTP is skipped for
+// recurring charges: those of orders the recurrent app created, and those
+// ChargeRecurring asks for.
+func (p *paymentService) directDebitAccountWithOTP(
+	ctx context.Context,
+	req models.DirectDebitAccountWithOTPRequest,
+	recurring bool,
 ) (*models.ProcessDirectDebitAccountResponse, error) {
 	var isRecurrentAppOrder bool
 
-	target, err := p.GetChargeableByID(ctx, req.OrderID, models.OrderTypeOrDefault(req.TypeOrder))
+	orderType := models.OrderTypeOrDefault(req.TypeOrder)
+	unlock, err := p.lockCharge(ctx, orderType, req.OrderID)
+	if err != nil {
+		if errors.Is(err, domains.ErrPaymentInProgress) {
+			return nil, err
+		}
+		return nil, p.debitImmediateGenericError()
+	}
+	defer unlock()
+
+	target, err := p.GetChargeableByID(ctx, req.OrderID, orderType)
 	if err != nil {
 		p.logger.Error("failed to get order from Shopify", zap.Error(err), zap.String("orderID", req.OrderID))
 		return nil, p.debitImmediateGenericError()
@@ -777,10 +1089,34 @@ func (p *paymentService) DirectDebitAccountWithOTP(
 		}, nil
 	}
 
-	isRecurrentAppOrder = target.App != nil && target.App.IsID(p.recurrentDirectDebitAppID)
-	if !isRecurrentAppOrder && !p.otpCache.Validate(req.OrderID, req.OTP) {
-		p.logger.Warn("invalid OTP", zap.String("orderID", req.OrderID))
-		return &models.ProcessDirectDebitAccountResponse{Success: false, Code: domains.ResponseCodeInvalidOTP}, nil
+	isRecurrentAppOrder = recurring || target.App != nil && target.App.IsID(p.recurrentDirectDebitAppID)
+	if !isRecurrentAppOrder {
+		verdict, err := p.otpStore.Validate(ctx, domains.OrderOTPKey(req.OrderID), req.OTP)
+		if err != nil {
+			p.logger.Error("failed to validate OTP", zap.Error(err), zap.String("orderID", req.OrderID))
+			return nil, p.debitImmediateGenericError()
+		}
+		switch verdict {
+		case domains.OTPLocked:
+			p.logger.Warn("OTP locked after too many attempts", zap.String("orderID", req.OrderID))
+			return &models.ProcessDirectDebitAccountResponse{Success: false, Code: domains.ResponseCodeOTPLocked}, nil
+		case domains.OTPInvalid:
+			p.logger.Warn("invalid OTP", zap.String("orderID", req.OrderID))
+			return &models.ProcessDirectDebitAccountResponse{Success: false, Code: domains.ResponseCodeInvalidOTP}, nil
+		}
+	}
+
+	// Checked under the lock: the webhook, the retry job and the buyer may
+	// all reach here for the same recurrent order.
+	if isRecurrentAppOrder {
+		charged, err := p.HasSuccessfulRecurrentCharge(ctx, target.GID)
+		if err != nil {
+			p.logger.Error("failed to check previous recurrent charges", zap.Error(err), zap.String("orderID", req.OrderID))
+			return nil, p.debitImmediateGenericError()
+		}
+		if charged {
+			return nil, domains.ErrOrderAlreadyCharged
+		}
 	}
 
 	var directDebit models.DirectDebitAccount
@@ -810,10 +1146,17 @@ func (p *paymentService) DirectDebitAccountWithOTP(
 	if err != nil {
 		return nil, err
 	}
+	p.affiliations.RecordCharge(ctx, domains.AffiliationCharge{
+		CustomerID:   target.Customer.ID,
+		Account:      directDebit.Account,
+		DNI:          directDebit.DNI,
+		ResponseCode: resp.Code,
+		OrderID:      target.GID,
+	})
 
 	if !resp.Success {
 		if domains.IsAffiliationPending(resp.Code) {
-			if err := p.clearDirectDebitAccount(ctx, target.Customer.ID); err != nil {
+			if err := p.clearDirectDebitAccount(ctx, target.Customer.ID, target.Customer.DirectDebitAccount); err != nil {
 				p.logger.Error("failed to clear direct debit account data", zap.Error(err), zap.String("customerID", target.Customer.ID))
 			} else {
 				p.logger.Warn("delete direct debit account data in shoppify", zap.String("r4_code", resp.Code))
@@ -853,7 +1196,10 @@ func (p *paymentService) processDirectDebitAccount(
 	})
 	if err != nil {
 		p.logger.Error("direct debit account call failed", zap.Error(err))
-		return nil, nil, errors.New(_debitImmediateGenericError)
+		if r4bank.Declined(err) {
+			return nil, nil, p.debitImmediateGenericError()
+		}
+		return nil, nil, chargeOutcomeUnknownError{}
 	}
 
 	record, err := p.registerDirectDebitAccountResult(ctx, req, r4Resp)
@@ -892,9 +1238,10 @@ func applyCompletion(resp *models.ProcessDirectDebitAccountResponse, completed *
 	resp.FinancialStatus = completed.DisplayFinancialStatus
 }
 
-// registerDirectDebitAccountResult stores the R4 charge result and returns
-// the row so it can be updated once finalizeCharge completes a draft.
-func (p *paymentService) registerDirectDebitAccountResult(ctx context.Context, req domains.DirectDebitAccountRequest, r4Resp *r4bank.DirectDebitAccountResponse) (*dbModels.R4DebitDirectAccount, error) {
+// registerDirectDebitAccountResult stores the R4 charge result, with its
+// ledger posting when approved, and returns the row so it can be updated once
+// finalizeCharge completes a draft.
+func (p *paymentService) registerDirectDebitAccountResult(ctx context.Context, req domains.DirectDebitAccountRequest, r4Resp *r4bank.DirectDebitAccountResponse) (_ *dbModels.R4DebitDirectAccount, err error) {
 	result := &dbModels.R4DebitDirectAccount{
 		StoreClientID: strings.ReplaceAll(req.CustomerID, shopify.CustomerKindID, ""),
 		Amount:        req.Amount,
@@ -916,9 +1263,27 @@ func (p *paymentService) registerDirectDebitAccountResult(ctx context.Context, r
 		result.DraftID = &draftID
 	}
 
-	if err := p.db.WithContext(ctx).Create(result).Error; err != nil {
+	tx := p.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(result).Error; err != nil {
 		return nil, err
 	}
+	if result.Success {
+		if err = p.ledger.Post(ctx, tx, domains.LedgerPosting{
+			Kind:       domains.LedgerKindCharge,
+			Account:    domains.LedgerAccountR4,
+			AmountVES:  result.Amount,
+			Source:     result.TableName(),
+			SourceID:   result.ID,
+			Reference:  result.Reference,
+			OrderID:    result.OrderID,
+			OrderName:  result.OrderName,
+			CustomerID: result.StoreClientID,
+		}); err != nil {
+			return nil, err
+		}
+	}
 
 	return result, nil
 }
@@ -929,32 +1294,60 @@ func (p *paymentService) updateDirectDebitAccountRecordAfterCompletion(
 	if record == nil || completed == nil {
 		return
 	}
+	var err error
+	tx := p.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	draftID := record.OrderID
 	record.OrderID = completed.LegacyOrderID
 	record.OrderName = completed.Name
 	record.UpdatedAt = time.Now()
-	if err := p.db.WithContext(ctx).Save(record).Error; err != nil {
+	if err = tx.Save(record).Error; err != nil {
 		p.logger.Error("failed to update direct debit account record with completed order id", zap.Error(err), zap.Int("recordId", record.ID))
+		return
+	}
+	if err = p.ledger.ReassignOrder(ctx, tx, draftID, completed.LegacyOrderID, completed.Name); err != nil {
+		p.logger.Error("failed to move ledger entries to completed order", zap.Error(err), zap.String("draftId", draftID))
 	}
 }
 
-// clearDirectDebitAccount removes the direct debit account metafield for the given customer.
-func (p *paymentService) clearDirectDebitAccount(ctx context.Context, customerID string) error {
+// clearDirectDebitAccount removes the direct debit account metafield for the
+// given customer. before is the metafield being removed; the audit log keeps
+// it with the account cut to its last 4 digits, as the DB rows do.
+func (p *paymentService) clearDirectDebitAccount(ctx context.Context, customerID string, before *shopify.Metafield) error {
 	if err := p.shopifyRepo.DeleteCustomerDebitDirectAccount(ctx, customerID); err != nil {
 		p.logger.Error("failed to clear direct debit account data", zap.Error(err), zap.Any("customer_id", customerID))
 		return err
 	}
 
+	event := domains.AuditEvent{
+		Action:      domains.AuditActionDirectDebitAccountClear,
+		SubjectType: domains.AuditSubjectCustomer,
+		SubjectID:   customerID,
+	}
+	var account shopify.DebitDirectAccountJson
+	if before != nil && json.Unmarshal(before.JsonValue, &account) == nil {
+		event.Before = account
+	}
+	p.audit.Record(ctx, nil, event)
+
 	return nil
 }
 
 // HasSuccessfulRecurrentCharge reports whether there is a successful direct debit charge associated with the given order ID.
+// A draft GID is looked up by draft id, which the row keeps once the draft is
+// completed.
 func (p *paymentService) HasSuccessfulRecurrentCharge(ctx context.Context, orderID string) (bool, error) {
-	numericID := strings.ReplaceAll(orderID, shopify.OrderKindID, "")
-	var count int64
-	err := p.db.WithContext(ctx).
+	query := p.db.WithContext(ctx).
 		Model(&dbModels.R4DebitDirectAccount{}).
-		Where(&dbModels.R4DebitDirectAccount{OrderID: numericID, Success: true}).
-		Count(&count).Error
+		Where("success = ?", true)
+	if strings.HasPrefix(orderID, shopify.DraftOrderKindID) {
+		query = query.Where("draft_id = ?", stripOrderGIDPrefix(orderID))
+	} else {
+		query = query.Where("order_id = ?", stripOrderGIDPrefix(orderID))
+	}
+	var count int64
+	err := query.Count(&count).Error
 	if err != nil {
 		return false, err
 	}
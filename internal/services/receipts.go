@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/mailgun"
+	"appa_payments/pkg/receipt"
+)
+
+// receiptPHashMaxDistance is how many of the 64 perceptual-hash bits two
+// receipts may differ by and still count as the same photo. Re-saves and
+// screenshots land well under it; two different transfers land near 32.
+const receiptPHashMaxDistance = 6
+
+// uploadReceipt validates and normalizes a receipt (pkg/receipt), then stores
+// it in Google Drive. The returned file carries the hashes the duplicate
+// check needs.
+func (p *paymentService) uploadReceipt(
+	ctx context.Context,
+	fileHeader *multipart.FileHeader,
+) (*receipt.File, string, error) {
+	file, err := receipt.Normalize(fileHeader)
+	if err != nil {
+		p.logger.Warn("rejected receipt upload", zap.Error(err), zap.String("filename", fileHeader.Filename))
+		return nil, "", err
+	}
+
+	url, err := p.driveClient.UploadFile(ctx, file.Name, file.MimeType, file.Data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return file, url, nil
+}
+
+// findDuplicateReceipt returns the earliest manual order for a different
+// order whose receipt is byte-identical or perceptually the same photo, or
+// nil if there is none.
+func (p *paymentService) findDuplicateReceipt(
+	ctx context.Context,
+	orderID int,
+	file *receipt.File,
+) (*dbModels.ManualOrder, error) {
+	query := p.db.WithContext(ctx).Model(&dbModels.ManualOrder{}).
+		Where("order_id <> ? AND validate_status <> ?", orderID, domains.ManualOrderStatusCanceled)
+
+	if file.PHash != nil {
+		query = query.Where(
+			"(receipt_sha256 = ? OR (receipt_phash IS NOT NULL AND "+
+				"length(replace(((receipt_phash # ?)::bit(64))::text, '0', '')) <= ?))",
+			file.SHA256, *file.PHash, receiptPHashMaxDistance,
+		)
+	} else {
+		query = query.Where("receipt_sha256 = ?", file.SHA256)
+	}
+
+	var item dbModels.ManualOrder
+	if err := query.Order("id ASC").First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// flagDuplicateReceipt marks manualOrder for review when its receipt was
+// already submitted for another order, and returns that earlier order. A
+// failed lookup is logged and the order is stored unflagged — the human
+// reviewer still sees every receipt.
+func (p *paymentService) flagDuplicateReceipt(
+	ctx context.Context,
+	manualOrder *dbModels.ManualOrder,
+	file *receipt.File,
+) *dbModels.ManualOrder {
+	duplicate, err := p.findDuplicateReceipt(ctx, manualOrder.OrderID, file)
+	if err != nil {
+		p.logger.Error("failed to check receipt for duplicates", zap.Error(err), zap.String("order", manualOrder.OrderName))
+		return nil
+	}
+	if duplicate == nil {
+		return nil
+	}
+
+	manualOrder.DuplicateOfID = &duplicate.ID
+	p.logger.Warn("receipt already submitted for another order",
+		zap.String("order", manualOrder.OrderName),
+		zap.String("duplicateOf", duplicate.OrderName))
+	return duplicate
+}
+
+// alertDuplicateReceipt tells support a stored manual order reuses the
+// receipt of an earlier one.
+func (p *paymentService) alertDuplicateReceipt(manualOrder, duplicate dbModels.ManualOrder) {
+	if err := p.mailgunRepo.SendSupportEmail(context.Background(), mailgun.SupportEmailRequest{
+		Subject: fmt.Sprintf("Revisión: comprobante repetido en orden %s", manualOrder.OrderName),
+		Body: fmt.Sprintf(
+			"El comprobante enviado para la orden %s coincide con el de la orden %s.\nRevise ambos pagos antes de aprobarlos.\n\nComprobante: %s\nComprobante anterior: %s",
+			manualOrder.OrderName, duplicate.OrderName, manualOrder.BillImageURL, duplicate.BillImageURL,
+		),
+	}); err != nil {
+		p.logger.Error("failed to send duplicate receipt alert", zap.Error(err), zap.String("order", manualOrder.OrderName))
+	}
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"appa_payments/internal/domains"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/mailgun"
+	"appa_payments/pkg/shopify"
+)
+
+const (
+	// reconciliationLookback is how far back each daily run looks. Runs
+	// overlap on purpose: a row missed one day is still checked the next.
+	reconciliationLookback = 72 * time.Hour
+	// reconciliationSettle skips the last hour, where charges may still be
+	// finalizing (débito polling, draft completion).
+	reconciliationSettle = time.Hour
+	// reconciliationEmailMaxLines caps the discrepancies listed in the email.
+	reconciliationEmailMaxLines = 100
+)
+
+// reconciliationChargesQuery joins every R4 table that records money taken
+// for an order into one shape.
+const reconciliationChargesQuery = `
+SELECT 'r4_appa_debits_direct' AS source, order_id, order_name, COALESCE(order_type, '') AS order_type, amount, reference
+FROM r4_appa_debits_direct
+WHERE success AND COALESCE(order_id, '') <> '' AND created_at >= @since AND created_at < @until
+UNION ALL
+SELECT 'r4_appa_mobile_payments', order_id::text, order_name, '', amount, reference
+FROM r4_appa_mobile_payments
+WHERE order_id IS NOT NULL AND updated_at >= @since AND updated_at < @until
+UNION ALL
+SELECT 'r4_appa_debits_direct_account', order_id, order_name,
+       CASE WHEN draft_id IS NOT NULL AND draft_id = order_id THEN 'Draft' ELSE '' END, amount, reference
+FROM r4_appa_debits_direct_account
+WHERE success AND COALESCE(order_id, '') <> '' AND created_at >= @since AND created_at < @until`
+
+// reconciliationRecordedOrdersQuery returns which of @ids have any record of
+// being paid through this service, at any time.
+const reconciliationRecordedOrdersQuery = `
+SELECT order_id FROM r4_appa_debits_direct WHERE success AND order_id IN @ids
+UNION
+SELECT order_id::text FROM r4_appa_mobile_payments WHERE order_id::text IN @ids
+UNION
+SELECT order_id FROM r4_appa_debits_direct_account WHERE success AND order_id IN @ids
+UNION
+SELECT order_id::text FROM appa_manual_orders WHERE validate_status = @approved AND order_id::text IN @ids`
+
+type reconciliationCharge struct {
+	Source    string
+	OrderID   string
+	OrderName string
+	OrderType string
+	Amount    float64
+	Reference string
+}
+
+// ReconciliationService cross-checks the R4 tables against Shopify once a
+// day and records what doesn't match in reconciliation_discrepancies.
+type ReconciliationService struct {
+	db          *gorm.DB
+	shopifyRepo shopify.Repository
+	mailgunRepo mailgun.Repository
+	location    *time.Location
+	logger      *zap.Logger
+}
+
+func NewReconciliationService(
+	db *gorm.DB,
+	shopifyRepo shopify.Repository,
+	mailgunRepo mailgun.Repository,
+	location *time.Location,
+	logger *zap.Logger,
+) *ReconciliationService {
+	return &ReconciliationService{
+		db:          db,
+		shopifyRepo: shopifyRepo,
+		mailgunRepo: mailgunRepo,
+		location:    location,
+		logger:      logger,
+	}
+}
+
+// Reconcile runs one reconciliation over the last reconciliationLookback and
+// emails support a summary when it finds anything not reported before. A
+// discrepancy is stored and emailed once, whichever run first sees it. Meant
+// to be invoked by the daily cron job (internal/jobs).
+func (s *ReconciliationService) Reconcile(ctx context.Context) {
+	now := time.Now().In(s.location)
+	runDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.location)
+	since, until := now.Add(-reconciliationLookback), now.Add(-reconciliationSettle)
+
+	charged, err := s.checkCharges(ctx, since, until)
+	if err != nil {
+		s.logger.Error("reconciliation: failed to check R4 charges", zap.Error(err))
+		return
+	}
+
+	paid, err := s.checkPaidOrders(ctx, since)
+	if err != nil {
+		s.logger.Error("reconciliation: failed to check paid orders", zap.Error(err))
+		return
+	}
+
+	found := append(charged, paid...)
+	discrepancies, err := s.unreported(ctx, found)
+	if err != nil {
+		s.logger.Error("reconciliation: failed to load reported discrepancies", zap.Error(err))
+		return
+	}
+	if len(discrepancies) == 0 {
+		s.logger.Info("reconciliation: no new discrepancies",
+			zap.Time("since", since), zap.Time("until", until), zap.Int("already_reported", len(found)))
+		return
+	}
+
+	for i := range discrepancies {
+		discrepancies[i].RunDate = runDate
+	}
+	if err := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&discrepancies).Error; err != nil {
+		s.logger.Error("reconciliation: failed to save discrepancies", zap.Error(err), zap.Int("count", len(discrepancies)))
+		return
+	}
+
+	s.logger.Warn("reconciliation: discrepancies found",
+		zap.Int("count", len(discrepancies)), zap.Int("already_reported", len(found)-len(discrepancies)))
+	s.sendSummary(ctx, runDate, discrepancies)
+}
+
+// unreported drops the discrepancies an earlier run already stored. Runs
+// overlap by reconciliationLookback, so without this the same finding would
+// be saved and emailed on every run that still sees it.
+func (s *ReconciliationService) unreported(
+	ctx context.Context, discrepancies []dbModels.ReconciliationDiscrepancy,
+) ([]dbModels.ReconciliationDiscrepancy, error) {
+	if len(discrepancies) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(discrepancies))
+	for _, d := range discrepancies {
+		ids = append(ids, d.OrderID)
+	}
+
+	var reported []dbModels.ReconciliationDiscrepancy
+	if err := s.db.WithContext(ctx).
+		Select("type", "order_id").
+		Where("order_id IN ?", ids).
+		Find(&reported).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[[2]string]bool, len(reported))
+	for _, d := range reported {
+		seen[[2]string{d.Type, d.OrderID}] = true
+	}
+
+	fresh := make([]dbModels.ReconciliationDiscrepancy, 0, len(discrepancies))
+	for _, d := range discrepancies {
+		if key := [2]string{d.Type, d.OrderID}; !seen[key] {
+			seen[key] = true
+			fresh = append(fresh, d)
+		}
+	}
+	return fresh, nil
+}
+
+// checkCharges looks up every order R4 took money for and flags the ones
+// Shopify doesn't show as paid, doesn't have, or that were charged twice.
+func (s *ReconciliationService) checkCharges(
+	ctx context.Context, since, until time.Time,
+) ([]dbModels.ReconciliationDiscrepancy, error) {
+	var charges []reconciliationCharge
+	if err := s.db.WithContext(ctx).
+		Raw(reconciliationChargesQuery, map[string]any{"since": since, "until": until}).
+		Scan(&charges).Error; err != nil {
+		return nil, err
+	}
+
+	byOrder := make(map[string][]reconciliationCharge)
+	for _, charge := range charges {
+		id := stripOrderGIDPrefix(charge.OrderID)
+		byOrder[id] = append(byOrder[id], charge)
+	}
+	if len(byOrder) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(byOrder))
+	for id := range byOrder {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	statuses, err := s.shopifyRepo.GetOrdersStatus(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var discrepancies []dbModels.ReconciliationDiscrepancy
+	for _, id := range ids {
+		group := byOrder[id]
+		base := newDiscrepancy(id, group)
+
+		if len(group) > 1 {
+			d := base
+			d.Type = domains.DiscrepancyDuplicateCharge
+			d.Detail = fmt.Sprintf("%d successful R4 records for the same order", len(group))
+			discrepancies = append(discrepancies, d)
+		}
+
+		status, found := statuses[id]
+		switch {
+		case !found && slices.ContainsFunc(group, func(c reconciliationCharge) bool { return c.OrderType == "Draft" }):
+			d := base
+			d.Type = domains.DiscrepancyDraftNotCompleted
+			d.Detail = "charged draft has no completed order"
+			discrepancies = append(discrepancies, d)
+		case !found:
+			d := base
+			d.Type = domains.DiscrepancyOrderNotFound
+			d.Detail = "Shopify has no order with this id"
+			discrepancies = append(discrepancies, d)
+		case status.CancelledAt != nil || !domains.SettledFinancialStatus(status.DisplayFinancialStatus):
+			d := base
+			d.Type = domains.DiscrepancyChargedNotPaid
+			d.ShopifyStatus = status.DisplayFinancialStatus
+			if status.CancelledAt != nil {
+				d.Detail = "order cancelled at " + *status.CancelledAt
+			}
+			discrepancies = append(discrepancies, d)
+		}
+	}
+
+	return discrepancies, nil
+}
+
+// checkPaidOrders flags orders marked paid through the manual gateway that
+// nothing in this service's tables accounts for.
+func (s *ReconciliationService) checkPaidOrders(
+	ctx context.Context, since time.Time,
+) ([]dbModels.ReconciliationDiscrepancy, error) {
+	orders, err := s.shopifyRepo.ListPaidOrders(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.LegacyResourceID)
+	}
+
+	var recorded []string
+	if err := s.db.WithContext(ctx).
+		Raw(reconciliationRecordedOrdersQuery, map[string]any{"ids": ids, "approved": domains.ManualOrderStatusApproved}).
+		Scan(&recorded).Error; err != nil {
+		return nil, err
+	}
+
+	var discrepancies []dbModels.ReconciliationDiscrepancy
+	for _, order := range orders {
+		if slices.Contains(recorded, order.LegacyResourceID) {
+			continue
+		}
+		discrepancies = append(discrepancies, dbModels.ReconciliationDiscrepancy{
+			Type:          domains.DiscrepancyPaidWithoutRecord,
+			OrderID:       order.LegacyResourceID,
+			OrderName:     order.Name,
+			ShopifyStatus: order.DisplayFinancialStatus,
+			Detail:        "paid through the manual gateway with no R4 record or approved manual order",
+		})
+	}
+
+	return discrepancies, nil
+}
+
+func newDiscrepancy(orderID string, group []reconciliationCharge) dbModels.ReconciliationDiscrepancy {
+	var (
+		sources, references []string
+		amount              float64
+		orderName           string
+	)
+	for _, charge := range group {
+		if !slices.Contains(sources, charge.Source) {
+			sources = append(sources, charge.Source)
+		}
+		if charge.Reference != "" {
+			references = append(references, charge.Reference)
+		}
+		if charge.OrderName != "" {
+			orderName = charge.OrderName
+		}
+		amount += charge.Amount
+	}
+
+	return dbModels.ReconciliationDiscrepancy{
+		OrderID:    orderID,
+		OrderName:  orderName,
+		Sources:    strings.Join(sources, ","),
+		References: strings.Join(references, ","),
+		Amount:     amount,
+	}
+}
+
+// sendSummary emails support the run's discrepancies, counted by type.
+func (s *ReconciliationService) sendSummary(
+	ctx context.Context, runDate time.Time, discrepancies []dbModels.ReconciliationDiscrepancy,
+) {
+	counts := make(map[string]int)
+	for _, d := range discrepancies {
+		counts[d.Type]++
+	}
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Conciliación R4 / Shopify del %s: %d diferencias.\n\n", runDate.Format("2006-01-02"), len(discrepancies))
+	for _, t := range types {
+		fmt.Fprintf(&body, "%s: %d\n", t, counts[t])
+	}
+	body.WriteString("\n")
+	for i, d := range discrepancies {
+		if i == reconciliationEmailMaxLines {
+			fmt.Fprintf(&body, "... y %d más en reconciliation_discrepancies\n", len(discrepancies)-i)
+			break
+		}
+		fmt.Fprintf(&body, "%s  %s (%s)  %s  %s  %s\n", d.Type, d.OrderName, d.OrderID, d.Sources, d.ShopifyStatus, d.Detail)
+	}
+
+	if err := s.mailgunRepo.SendSupportEmail(ctx, mailgun.SupportEmailRequest{
+		Subject: fmt.Sprintf("Conciliación %s: %d diferencias", runDate.Format("2006-01-02"), len(discrepancies)),
+		Body:    body.String(),
+	}); err != nil {
+		s.logger.Error("reconciliation: failed to send summary email", zap.Error(err))
+	}
+}
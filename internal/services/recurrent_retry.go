@@ -2,15 +2,20 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"appa_payments/internal/domains"
 	"appa_payments/internal/models"
 	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/mailgun"
+	"appa_payments/pkg/shopify"
 )
 
 const _shopifyPendingStatus = "PENDING"
@@ -18,7 +23,7 @@ const _shopifyPendingStatus = "PENDING"
 // recurrentRetryWorkers bounds how many charges run concurrently — each R4
 // charge call takes close to a minute, so this keeps a large backlog from
 // stretching the daily job for hours while not hammering R4 with unbounded
-// concurrent requests. Mirrors webhookWorkers in internal/handlers/webhook.go.
+// concurrent requests. Mirrors webhookWorkers in internal/services/webhook_queue.go.
 const recurrentRetryWorkers = 4
 
 // RecurrentRetryService retries recurrent direct-debit charges that were
@@ -27,6 +32,10 @@ type RecurrentRetryService struct {
 	db             *gorm.DB
 	paymentService domains.PaymentService
 	storeService   domains.StoreService
+	shopifyRepo    shopify.Repository
+	mailgunRepo    mailgun.Repository
+	audit          domains.AuditService
+	policy         domains.RecurrentRetryPolicy
 	location       *time.Location
 	logger         *zap.Logger
 }
@@ -35,6 +44,10 @@ func NewRecurrentRetryService(
 	db *gorm.DB,
 	paymentService domains.PaymentService,
 	storeService domains.StoreService,
+	shopifyRepo shopify.Repository,
+	mailgunRepo mailgun.Repository,
+	audit domains.AuditService,
+	policy domains.RecurrentRetryPolicy,
 	location *time.Location,
 	logger *zap.Logger,
 ) *RecurrentRetryService {
@@ -42,104 +55,366 @@ func NewRecurrentRetryService(
 		db:             db,
 		paymentService: paymentService,
 		storeService:   storeService,
+		shopifyRepo:    shopifyRepo,
+		mailgunRepo:    mailgunRepo,
+		audit:          audit,
+		policy:         policy,
 		location:       location,
 		logger:         logger,
 	}
 }
 
-// RetryPendingCharges loads every pending recurrent direct-debit charge and
-// retries each one across a bounded worker pool (recurrentRetryWorkers). Only
-// orders still PENDING in Shopify get charged; any other status (PAID,
-// CANCELLED, REFUNDED, etc.) deletes the record without charging. A charge
-// success also deletes the record — there is no give-up window, retries
-// continue indefinitely while the order stays pending. Blocks until every
-// record has been processed. Meant to be
-// invoked by the daily cron job (internal/jobs).
+// RecordDecline records a recurrent charge declined at webhook time for the
+// daily retry job, scheduled by the policy. ON CONFLICT DO NOTHING means
+// repeated declines for the same order do not duplicate rows or reset the
+// retry window. A decline no retry can fix is given up on at once.
+func (s *RecurrentRetryService) RecordDecline(ctx context.Context, orderID, orderName, code string) error {
+	now := time.Now().In(s.location)
+	retryAt, giveUp := s.policy.Next(code, 1, now, now)
+	record := &dbModels.RecurrentPendingPayment{
+		OrderID:       orderID,
+		OrderName:     orderName,
+		Attempts:      1,
+		LastAttemptAt: now,
+		LastCode:      code,
+	}
+	if giveUp == "" {
+		record.NextRetryAt = &retryAt
+	}
+
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_id"}},
+		DoNothing: true,
+	}).Create(record)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	if giveUp != "" {
+		s.giveUp(ctx, *record, giveUp)
+	}
+	return nil
+}
+
+// RetryPendingCharges loads every pending recurrent direct-debit charge due
+// by the policy and retries each one across a bounded worker pool
+// (recurrentRetryWorkers). Only orders still PENDING in Shopify get charged;
+// any other status (PAID, CANCELLED, REFUNDED, etc.) deletes the record
+// without charging. A charge success also deletes the record; a decline
+// schedules the next retry, or gives up (see giveUp). Blocks until every
+// record has been processed, or, once ctx is cancelled, until the charges
+// under way have finished. Meant to be invoked by the daily cron job
+// (internal/jobs).
 func (s *RecurrentRetryService) RetryPendingCharges(ctx context.Context) {
-	var pending []dbModels.RecurrentPendingPayment
-	if err := s.db.WithContext(ctx).Find(&pending).Error; err != nil {
+	if _, err := s.retry(ctx, models.RecurrentRetryRequest{}); err != nil {
 		s.logger.Error("recurrent retry: failed to load pending payments", zap.Error(err))
-		return
+	}
+}
+
+// Retry is RetryPendingCharges on demand, for one order or all, reporting
+// what happened to each pending charge. Support runs it from
+// POST /admin/recurrent/retry; a run that isn't dry is audited.
+func (s *RecurrentRetryService) Retry(ctx context.Context, req models.RecurrentRetryRequest) (*models.RecurrentRetryReport, error) {
+	report, err := s.retry(ctx, req)
+	if err != nil || req.DryRun {
+		return report, err
+	}
+
+	subjectID := req.OrderID
+	if subjectID == "" {
+		subjectID = "all"
+	}
+	s.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionRecurrentRetry,
+		SubjectType: domains.AuditSubjectRecurrentPending,
+		SubjectID:   subjectID,
+		After:       report,
+	})
+	return report, nil
+}
+
+func (s *RecurrentRetryService) retry(ctx context.Context, req models.RecurrentRetryRequest) (*models.RecurrentRetryReport, error) {
+	// An order named by support is retried whatever its schedule, even
+	// after giving up on it.
+	query := s.db.WithContext(ctx)
+	if req.OrderID != "" {
+		query = query.Where("order_id = ?", req.OrderID)
+	} else {
+		query = query.Where("gave_up_at IS NULL AND (next_retry_at IS NULL OR next_retry_at <= ?)", time.Now())
+	}
+	var pending []dbModels.RecurrentPendingPayment
+	if err := query.Find(&pending).Error; err != nil {
+		return nil, err
+	}
+	if req.OrderID != "" && len(pending) == 0 {
+		return nil, domains.ErrRecurrentPendingNotFound
 	}
 
 	now := time.Now().In(s.location)
+	report := &models.RecurrentRetryReport{DryRun: req.DryRun, Results: make([]models.RecurrentRetryResult, 0, len(pending))}
+	var mu sync.Mutex
 
+	// A charge already started is seen through even if ctx is cancelled;
+	// cancelling only stops handing out records.
+	chargeCtx := context.WithoutCancel(ctx)
 	jobs := make(chan dbModels.RecurrentPendingPayment)
 	var wg sync.WaitGroup
 	for range recurrentRetryWorkers {
 		wg.Go(func() {
 			for record := range jobs {
-				s.retryOneSafe(ctx, record, now)
+				result := s.retryOneSafe(chargeCtx, record, now, req.DryRun)
+				mu.Lock()
+				report.Results = append(report.Results, result)
+				mu.Unlock()
 			}
 		})
 	}
 
-	for _, record := range pending {
-		jobs <- record
+dispatch:
+	for i, record := range pending {
+		select {
+		case jobs <- record:
+		case <-ctx.Done():
+			s.logger.Info("recurrent retry: stopping, remaining records left for the next run",
+				zap.Int("remaining", len(pending)-i))
+			break dispatch
+		}
 	}
 	close(jobs)
 	wg.Wait()
+
+	return report, nil
 }
 
 // retryOneSafe runs retryOne with panic recovery so one bad record can't take
 // down its worker goroutine and strand the rest of the queue.
-func (s *RecurrentRetryService) retryOneSafe(ctx context.Context, record dbModels.RecurrentPendingPayment, now time.Time) {
+func (s *RecurrentRetryService) retryOneSafe(
+	ctx context.Context, record dbModels.RecurrentPendingPayment, now time.Time, dryRun bool,
+) (result models.RecurrentRetryResult) {
 	defer func() {
 		if r := recover(); r != nil {
 			s.logger.Error("recurrent retry: worker panicked",
 				zap.String("orderID", record.OrderID),
 				zap.Any("panic", r))
+			result = models.RecurrentRetryResult{
+				OrderID:   record.OrderID,
+				OrderName: record.OrderName,
+				Outcome:   models.RecurrentRetryError,
+				Error:     fmt.Sprintf("panic: %v", r),
+			}
 		}
 	}()
-	s.retryOne(ctx, record, now)
+	return s.retryOne(ctx, record, now, dryRun)
 }
 
-func (s *RecurrentRetryService) retryOne(ctx context.Context, record dbModels.RecurrentPendingPayment, now time.Time) {
+func (s *RecurrentRetryService) retryOne(
+	ctx context.Context, record dbModels.RecurrentPendingPayment, now time.Time, dryRun bool,
+) models.RecurrentRetryResult {
 	logger := s.logger.With(
 		zap.String("orderID", record.OrderID),
 		zap.String("orderName", record.OrderName),
+		zap.Bool("dryRun", dryRun),
 	)
+	result := models.RecurrentRetryResult{OrderID: record.OrderID, OrderName: record.OrderName}
+	failed := func(err error) models.RecurrentRetryResult {
+		result.Outcome = models.RecurrentRetryError
+		result.Error = err.Error()
+		return result
+	}
 
 	order, err := s.storeService.GetOrderByID(ctx, record.OrderID)
+	if errors.Is(err, domains.ErrOrderNotFound) {
+		result.Outcome = models.RecurrentRetryGaveUp
+		result.GiveUpReason = domains.RecurrentGiveUpOrderNotFound
+		if dryRun || record.GaveUpAt != nil {
+			return result
+		}
+		s.giveUp(ctx, record, domains.RecurrentGiveUpOrderNotFound)
+		return result
+	}
 	if err != nil {
 		logger.Error("recurrent retry: failed to fetch order from Shopify, will retry next day", zap.Error(err))
-		return
+		return failed(err)
 	}
 
 	// Only PENDING orders are chargeable. PAID, CANCELLED, REFUNDED, etc. are
 	// all resolved-or-dead states — stop retrying and drop the record.
 	if order.DisplayFinancialStatus != _shopifyPendingStatus {
+		result.Outcome = models.RecurrentRetryNotPending
+		result.FinancialStatus = order.DisplayFinancialStatus
+		if dryRun {
+			return result
+		}
 		if err := s.deletePending(ctx, record.OrderID); err != nil {
 			logger.Error("recurrent retry: failed to delete non-pending order's record", zap.Error(err))
-			return
+			return failed(err)
 		}
 		logger.Info("recurrent retry: order no longer pending, deleted pending payment",
 			zap.String("financialStatus", order.DisplayFinancialStatus))
-		return
+		return result
+	}
+
+	if dryRun {
+		charged, err := s.paymentService.HasSuccessfulRecurrentCharge(ctx, record.OrderID)
+		if err != nil {
+			return failed(err)
+		}
+		if charged {
+			result.Outcome = models.RecurrentRetryAlreadyCharged
+		} else {
+			result.Outcome = models.RecurrentRetryWouldCharge
+		}
+		return result
 	}
 
 	resp, err := s.paymentService.DirectDebitAccountWithOTP(ctx, models.DirectDebitAccountWithOTPRequest{
 		OrderID: record.OrderID,
 		OTP:     "",
 	})
+	if errors.Is(err, domains.ErrOrderAlreadyCharged) {
+		result.Outcome = models.RecurrentRetryAlreadyCharged
+		if err := s.deletePending(ctx, record.OrderID); err != nil {
+			logger.Error("recurrent retry: failed to delete already charged pending payment", zap.Error(err))
+			return failed(err)
+		}
+		logger.Info("recurrent retry: order already charged, deleted pending payment")
+		return result
+	}
+	if errors.Is(err, domains.ErrChargeOutcomeUnknown) {
+		logger.Error("recurrent retry: charge outcome unknown, giving up", zap.Error(err))
+		result.Outcome = models.RecurrentRetryGaveUp
+		result.GiveUpReason = domains.RecurrentGiveUpOutcomeUnknown
+		s.giveUp(ctx, record, domains.RecurrentGiveUpOutcomeUnknown)
+		return result
+	}
 	if err != nil {
 		logger.Error("recurrent retry: charge errored, will retry next day", zap.Error(err))
-		return
+		return failed(err)
 	}
 
 	if resp.Success {
+		result.Outcome = models.RecurrentRetryCharged
 		if err := s.deletePending(ctx, record.OrderID); err != nil {
 			logger.Error("recurrent retry: failed to delete resolved pending payment", zap.Error(err))
-			return
+			return failed(err)
 		}
 		logger.Info("recurrent retry: charge succeeded, deleted pending payment")
+		return result
+	}
+
+	result.Code = resp.Code
+	attempts := record.Attempts + 1
+	retryAt, giveUp := s.policy.Next(resp.Code, attempts, record.CreatedAt, now)
+	var nextRetryAt *time.Time
+	if giveUp == "" {
+		nextRetryAt = &retryAt
+	}
+	if err := s.recordAttempt(ctx, record.OrderID, attempts, resp.Code, nextRetryAt, now); err != nil {
+		logger.Error("recurrent retry: failed to record attempt", zap.Error(err))
+	}
+
+	if giveUp == "" {
+		result.Outcome = models.RecurrentRetryDeclined
+		logger.Info("recurrent retry: charge declined, will retry",
+			zap.String("code", resp.Code), zap.Time("nextRetryAt", retryAt))
+		return result
+	}
+
+	result.Outcome = models.RecurrentRetryGaveUp
+	result.GiveUpReason = giveUp
+	if record.GaveUpAt != nil {
+		logger.Info("recurrent retry: charge declined again after giving up", zap.String("code", resp.Code))
+		return result
+	}
+	record.Attempts = attempts
+	record.LastCode = resp.Code
+	s.giveUp(ctx, record, giveUp)
+	return result
+}
+
+// giveUp stops retrying record: the row is kept, marked, and the Shopify
+// order tagged RecurrentGiveUpTag; the buyer and support are emailed. Tagging
+// and emails are best effort, logged on failure. An order Shopify no longer
+// has, or one R4 may have charged, is only reported to support.
+func (s *RecurrentRetryService) giveUp(ctx context.Context, record dbModels.RecurrentPendingPayment, reason string) {
+	logger := s.logger.With(
+		zap.String("orderID", record.OrderID),
+		zap.String("orderName", record.OrderName),
+		zap.String("reason", reason),
+		zap.String("code", record.LastCode),
+		zap.Int("attempts", record.Attempts),
+	)
+	now := time.Now()
+
+	if err := s.db.WithContext(ctx).
+		Model(&dbModels.RecurrentPendingPayment{}).
+		Where("order_id = ?", record.OrderID).
+		Updates(map[string]any{
+			"gave_up_at":     now,
+			"give_up_reason": reason,
+			"next_retry_at":  nil,
+			"updated_at":     now,
+		}).Error; err != nil {
+		logger.Error("recurrent retry: failed to mark pending payment given up", zap.Error(err))
+	}
+	logger.Warn("recurrent retry: giving up on recurrent charge")
+
+	failedCharge := reason != domains.RecurrentGiveUpOrderNotFound && reason != domains.RecurrentGiveUpOutcomeUnknown
+	tagged := ""
+	if failedCharge {
+		if err := s.shopifyRepo.AddOrderTags(ctx, record.OrderID, []string{domains.RecurrentGiveUpTag}); err != nil {
+			logger.Error("recurrent retry: failed to tag given up order", zap.Error(err))
+		}
+		tagged = fmt.Sprintf("\nLa orden quedó etiquetada %q en Shopify.", domains.RecurrentGiveUpTag)
+	}
+
+	why := recurrentGiveUpReasons[reason]
+	if err := s.mailgunRepo.SendSupportEmail(ctx, mailgun.SupportEmailRequest{
+		Subject: fmt.Sprintf("Domiciliación abandonada: orden %s", record.OrderName),
+		Body: fmt.Sprintf(
+			"Se dejó de reintentar el cobro recurrente de la orden %s (id %s).\nMotivo: %s (%s)\nIntentos: %d\nÚltimo código: %s%s",
+			record.OrderName, record.OrderID, why, reason, record.Attempts, record.LastCode, tagged,
+		),
+	}); err != nil {
+		logger.Error("recurrent retry: failed to notify support", zap.Error(err))
+	}
+	if !failedCharge {
 		return
 	}
 
-	if err := s.bumpAttempt(ctx, record.OrderID, now); err != nil {
-		logger.Error("recurrent retry: failed to bump attempt count", zap.Error(err))
+	resp, err := s.shopifyRepo.GetOrderByID(ctx, record.OrderID)
+	if err != nil {
+		logger.Error("recurrent retry: failed to get order to notify the customer", zap.Error(err))
+		return
 	}
-	logger.Info("recurrent retry: charge declined, will retry next day", zap.String("code", resp.Code))
+	if resp == nil || resp.Order == nil {
+		logger.Warn("recurrent retry: order no longer exists, give up not notified")
+		return
+	}
+	customer := resp.Order.Customer
+	if customer.Email == "" {
+		logger.Warn("recurrent retry: customer has no email, give up not notified")
+		return
+	}
+	if err := s.mailgunRepo.SendRecurrentChargeFailedEmail(ctx, mailgun.RecurrentChargeFailedEmailRequest{
+		To:        customer.Email,
+		UserName:  customer.DisplayName,
+		OrderName: record.OrderName,
+		Reason:    why,
+	}); err != nil {
+		logger.Error("recurrent retry: failed to notify the customer", zap.Error(err))
+	}
+}
+
+// recurrentGiveUpReasons are what the buyer and support read for each
+// give-up reason.
+var recurrentGiveUpReasons = map[string]string{
+	domains.RecurrentGiveUpMaxAttempts:        "se alcanzó el máximo de intentos de cobro",
+	domains.RecurrentGiveUpMaxDays:            "se alcanzó el plazo máximo para cobrar",
+	domains.RecurrentGiveUpAffiliationRefused: "el banco rechazó la afiliación de tu cuenta a la domiciliación",
+	domains.RecurrentGiveUpInvalidAccount:     "la cuenta afiliada no es válida",
+	domains.RecurrentGiveUpOrderNotFound:      "la orden ya no existe en Shopify",
+	domains.RecurrentGiveUpOutcomeUnknown:     "R4 no respondió al cobro; verificar en R4 si se cobró antes de reintentar",
 }
 
 func (s *RecurrentRetryService) deletePending(ctx context.Context, orderID string) error {
@@ -153,13 +428,17 @@ func (s *RecurrentRetryService) deletePending(ctx context.Context, orderID strin
 	return nil
 }
 
-func (s *RecurrentRetryService) bumpAttempt(ctx context.Context, orderID string, now time.Time) error {
+func (s *RecurrentRetryService) recordAttempt(
+	ctx context.Context, orderID string, attempts int, code string, nextRetryAt *time.Time, now time.Time,
+) error {
 	return s.db.WithContext(ctx).
 		Model(&dbModels.RecurrentPendingPayment{}).
 		Where("order_id = ?", orderID).
 		Updates(map[string]any{
-			"attempts":        gorm.Expr("attempts + 1"),
+			"attempts":        attempts,
 			"last_attempt_at": now,
+			"last_code":       code,
+			"next_retry_at":   nextRetryAt,
 			"updated_at":      now,
 		}).Error
 }
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	dbModels "appa_payments/pkg/db/models"
+)
+
+// settlementTotalsQuery sums one Caracas day of movements per rail. Every
+// pago móvil received counts as a charge, matched or not, since R4 settled it
+// either way; manual orders on the day they were approved. Reversals are the LESS and
+// GREATER refunds made while matching a pago móvil; every other successful
+// refund (orphaned, unattached, cash change) is a refund.
+const settlementTotalsQuery = moneyMovementsCTE + `,
+day AS (
+    SELECT m.rail, m.movement, m.status, m.reason, COALESCE(m.amount_ves, m.amount_usd * r.rate) AS ves
+    FROM movements m
+    LEFT JOIN bcv_rates r ON r.date = @day
+    WHERE m.occurred_at >= @from AND m.occurred_at < @to
+)
+SELECT rail,
+       COUNT(*) FILTER (WHERE movement = 'charge' AND status IN ('success', 'linked', 'unmatched', 'refunded', 'approved')) AS charges_count,
+       COALESCE(SUM(ves) FILTER (WHERE movement = 'charge' AND status IN ('success', 'linked', 'unmatched', 'refunded', 'approved')), 0) AS charges_ves,
+       COUNT(*) FILTER (WHERE movement = 'refund' AND status = 'success' AND reason NOT IN ('LESS', 'GREATER')) AS refunds_count,
+       COALESCE(-SUM(ves) FILTER (WHERE movement = 'refund' AND status = 'success' AND reason NOT IN ('LESS', 'GREATER')), 0) AS refunds_ves,
+       COUNT(*) FILTER (WHERE movement = 'refund' AND status = 'success' AND reason IN ('LESS', 'GREATER')) AS reversals_count,
+       COALESCE(-SUM(ves) FILTER (WHERE movement = 'refund' AND status = 'success' AND reason IN ('LESS', 'GREATER')), 0) AS reversals_ves,
+       COUNT(*) FILTER (WHERE movement = 'charge' AND status = 'failed') AS failed_count
+FROM day
+GROUP BY rail`
+
+// settlementFailuresQuery counts one Caracas day's declined charges per rail
+// and R4 code.
+const settlementFailuresQuery = moneyMovementsCTE + `
+SELECT rail, detail AS code, COUNT(*) AS count
+FROM movements
+WHERE movement = 'charge' AND status = 'failed' AND occurred_at >= @from AND occurred_at < @to
+GROUP BY rail, detail`
+
+type settlementFailure struct {
+	Rail  string
+	Code  string
+	Count int
+}
+
+type settlementService struct {
+	db       *gorm.DB
+	location *time.Location
+	logger   *zap.Logger
+}
+
+func NewSettlementService(db *gorm.DB, location *time.Location, logger *zap.Logger) domains.SettlementService {
+	return &settlementService{db: db, location: location, logger: logger}
+}
+
+func (s *settlementService) Settle(ctx context.Context, day time.Time) error {
+	day = day.In(s.location)
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, s.location)
+	params := map[string]any{
+		"day":  from.Format("2006-01-02"),
+		"from": from,
+		"to":   from.AddDate(0, 0, 1),
+	}
+
+	var rate dbModels.BCVRate
+	if err := s.db.WithContext(ctx).Where("date = ?", params["day"]).Limit(1).Find(&rate).Error; err != nil {
+		return err
+	}
+
+	var settlements []dbModels.DailySettlement
+	if err := s.db.WithContext(ctx).Raw(settlementTotalsQuery, params).Scan(&settlements).Error; err != nil {
+		return err
+	}
+	if len(settlements) == 0 {
+		s.logger.Info("settlement: no movements", zap.String("day", params["day"].(string)))
+		return nil
+	}
+
+	var failures []settlementFailure
+	if err := s.db.WithContext(ctx).Raw(settlementFailuresQuery, params).Scan(&failures).Error; err != nil {
+		return err
+	}
+	byRail := make(map[string]map[string]int)
+	for _, f := range failures {
+		if byRail[f.Rail] == nil {
+			byRail[f.Rail] = make(map[string]int)
+		}
+		byRail[f.Rail][f.Code] = f.Count
+	}
+
+	for i := range settlements {
+		settlement := &settlements[i]
+		settlement.BusinessDate = from
+		settlement.ChargesVES = roundCents(settlement.ChargesVES)
+		settlement.RefundsVES = roundCents(settlement.RefundsVES)
+		settlement.ReversalsVES = roundCents(settlement.ReversalsVES)
+		settlement.NetVES = roundCents(settlement.ChargesVES - settlement.RefundsVES - settlement.ReversalsVES)
+		if rate.Rate > 0 {
+			bcvRate, netUSD := rate.Rate, roundCents(settlement.NetVES/rate.Rate)
+			settlement.BCVRate, settlement.NetUSD = &bcvRate, &netUSD
+		}
+
+		codes := byRail[settlement.Rail]
+		if codes == nil {
+			codes = map[string]int{}
+		}
+		raw, err := json.Marshal(codes)
+		if err != nil {
+			return err
+		}
+		settlement.FailedByCode = raw
+	}
+
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "business_date"}, {Name: "rail"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"charges_count", "charges_ves", "refunds_count", "refunds_ves",
+				"reversals_count", "reversals_ves", "net_ves", "bcv_rate", "net_usd",
+				"failed_count", "failed_by_code", "updated_at",
+			}),
+		}).
+		Create(&settlements).Error
+}
+
+func (s *settlementService) SettlePreviousDay(ctx context.Context) {
+	day := time.Now().In(s.location).AddDate(0, 0, -1)
+	if err := s.Settle(ctx, day); err != nil {
+		s.logger.Error("settlement: failed to settle day", zap.Error(err), zap.String("day", day.Format("2006-01-02")))
+	}
+}
+
+func (s *settlementService) List(
+	ctx context.Context,
+	req models.ListSettlementsRequest,
+) (*models.SettlementReport, error) {
+	query := s.db.WithContext(ctx).
+		Where("business_date BETWEEN ? AND ?", req.From, req.To).
+		Order("business_date, rail")
+	if req.Rail != "" {
+		query = query.Where("rail = ?", req.Rail)
+	}
+
+	report := &models.SettlementReport{From: req.From, To: req.To, Items: []dbModels.DailySettlement{}}
+	if err := query.Find(&report.Items).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -25,6 +25,8 @@ type storeService struct {
 	R4Repository              r4bank.R4Repository
 	DB                        *gorm.DB
 	bcvClient                 bcv.Client
+	audit                     domains.AuditService
+	igtfRates                 domains.IGTFRates
 	recurrentDirectDebitAppID string
 }
 
@@ -34,6 +36,8 @@ func NewStoreService(
 	R4Repository r4bank.R4Repository,
 	DB *gorm.DB,
 	bcvClient bcv.Client,
+	audit domains.AuditService,
+	igtfRates domains.IGTFRates,
 	recurrentDirectDebitAppID string,
 	logger *zap.Logger,
 ) domains.StoreService {
@@ -42,6 +46,8 @@ func NewStoreService(
 		R4Repository:              R4Repository,
 		DB:                        DB,
 		bcvClient:                 bcvClient,
+		audit:                     audit,
+		igtfRates:                 igtfRates,
 		recurrentDirectDebitAppID: recurrentDirectDebitAppID,
 		Logger:                    logger,
 	}
@@ -63,6 +69,29 @@ func (s *storeService) getLineItems(
 	return items
 }
 
+// getIGTF lists, for each payment method that pays IGTF, the tax on
+// totalAmount (USD) and the total with it.
+func (s *storeService) getIGTF(totalAmount float64, currencyCode string) []models.IGTF {
+	methods := s.igtfRates.PaymentMethods()
+	igtf := make([]models.IGTF, 0, len(methods))
+	for _, id := range methods {
+		amount := s.igtfRates.Amount(id, totalAmount)
+		igtf = append(igtf, models.IGTF{
+			PaymentMethodID: id,
+			Rate:            s.igtfRates.Rate(id),
+			Amount: models.OrderPrice{
+				Amount:       fmt.Sprintf("%.2f", amount),
+				CurrencyCode: currencyCode,
+			},
+			Total: models.OrderPrice{
+				Amount:       fmt.Sprintf("%.2f", totalAmount+amount),
+				CurrencyCode: currencyCode,
+			},
+		})
+	}
+	return igtf
+}
+
 // getOrderResponse converts a Shopify order to models.OrderResponse
 func (s *storeService) getOrderResponse(
 	ctx context.Context,
@@ -134,6 +163,7 @@ func (s *storeService) getOrderResponse(
 			Amount:       fmt.Sprintf("%.2f", totalAmount*tasaBCV),
 			CurrencyCode: "VES",
 		},
+		IGTF:      s.getIGTF(totalAmount, order.CurrentTotalPriceSet.ShopMoney.CurrencyCode),
 		LineItems: lineItems,
 		Customer: models.Customer{
 			ID:          strings.TrimPrefix(order.Customer.ID, shopify.CustomerKindID),
@@ -150,14 +180,16 @@ func (s *storeService) getOrderResponse(
 	return response, nil
 }
 
-// getManualOrderByFilter retrieves manual orders based on the provided filter
+// getManualOrderByFilter retrieves manual orders based on the provided filter.
+// Canceled and rejected rows don't count: the buyer may submit again.
 func (s *storeService) getManualOrderByFilter(
 	ctx context.Context,
 	filter dbModels.ManualOrder,
 ) (*models.OrderResponse, error) {
 	var item dbModels.ManualOrder
 	err := s.DB.Model(&dbModels.ManualOrder{}).WithContext(ctx).
-		Where(filter).Where("validate_status <> ?", "CANCELED").
+		Where(filter).
+		Where("validate_status NOT IN ?", []string{domains.ManualOrderStatusCanceled, domains.ManualOrderStatusRejected}).
 		First(&item).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		s.Logger.Error("failed to get manual order", zap.Error(err))
@@ -165,10 +197,19 @@ func (s *storeService) getManualOrderByFilter(
 	}
 
 	if item.ID != 0 {
-		return &models.OrderResponse{
+		response := &models.OrderResponse{
 			ID:   fmt.Sprintf("%d", item.OrderID),
 			Name: item.OrderName,
-		}, nil
+		}
+		if item.IGTFAmount > 0 {
+			response.IGTF = []models.IGTF{{
+				PaymentMethodID: item.PaymentMethodID,
+				Rate:            item.IGTFRate,
+				Amount:          models.OrderPrice{Amount: fmt.Sprintf("%.2f", item.IGTFAmount), CurrencyCode: "USD"},
+				Total:           models.OrderPrice{Amount: fmt.Sprintf("%.2f", item.OrderTotalAmount+item.IGTFAmount), CurrencyCode: "USD"},
+			}}
+		}
+		return response, nil
 	}
 
 	return nil, nil
@@ -196,6 +237,9 @@ func (s *storeService) GetOrderByID(
 	if err != nil {
 		return nil, err // or custom error
 	}
+	if store.Order == nil {
+		return nil, domains.ErrOrderNotFound
+	}
 
 	manualOrder, err := s.getManualOrderByFilter(ctx, dbModels.ManualOrder{
 		OrderID: orderID,
@@ -266,11 +310,25 @@ func (s *storeService) UpdateCustomerParentID(
 	ctx context.Context,
 	req models.UpdateCustomerParentIDRequest,
 ) error {
-	err := s.ShopifyRepository.SetCustomerParentID(ctx, req.CustomerID, fmt.Sprintf("%s-%s", req.DNIType, req.DNI))
+	var before any
+	if current, err := s.ShopifyRepository.GetCustomerParentID(ctx, req.CustomerID); err == nil && current != nil {
+		before = domains.MaskPII(current.Value)
+	}
+
+	parentID := fmt.Sprintf("%s-%s", req.DNIType, req.DNI)
+	err := s.ShopifyRepository.SetCustomerParentID(ctx, req.CustomerID, parentID)
 	if err != nil {
 		s.Logger.Error("failed to update customer parent ID", zap.Error(err), zap.String("customerId", req.CustomerID))
 		return err
 	}
 
+	s.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionCustomerParentIDUpdate,
+		SubjectType: domains.AuditSubjectCustomer,
+		SubjectID:   req.CustomerID,
+		Before:      before,
+		After:       domains.MaskPII(parentID),
+	})
+
 	return nil
 }
@@ -0,0 +1,509 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+	"appa_payments/pkg/mailgun"
+	"appa_payments/pkg/shopify"
+)
+
+const (
+	// subscriptionWorkers bounds how many subscriptions are charged at once,
+	// as recurrentRetryWorkers does for the retry job.
+	subscriptionWorkers = 4
+
+	subscriptionsDefaultPageSize = 50
+)
+
+// claimSubscriptionQuery leases the next active subscription that is due.
+// A lease taken since runStart, by this run or one running beside it on
+// another instance, isn't taken again, so a subscription that errors waits
+// for the next run instead of being retried in a loop.
+const claimSubscriptionQuery = `
+UPDATE subscriptions
+SET locked_until = @lockedUntil, updated_at = @now
+WHERE id = (
+	SELECT id FROM subscriptions
+	WHERE status = @active AND next_charge_at <= @now
+	  AND (locked_until IS NULL OR locked_until < @runStart)
+	ORDER BY next_charge_at
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *`
+
+type subscriptionService struct {
+	db             *gorm.DB
+	paymentService domains.PaymentService
+	shopifyRepo    shopify.Repository
+	mailgunRepo    mailgun.Repository
+	audit          domains.AuditService
+	policy         domains.RecurrentRetryPolicy
+	location       *time.Location
+	logger         *zap.Logger
+}
+
+// NewSubscriptionService charges subscriptions through paymentService's
+// recurring path, retrying declines on policy as the recurrent retry does.
+func NewSubscriptionService(
+	db *gorm.DB,
+	paymentService domains.PaymentService,
+	shopifyRepo shopify.Repository,
+	mailgunRepo mailgun.Repository,
+	audit domains.AuditService,
+	policy domains.RecurrentRetryPolicy,
+	location *time.Location,
+	logger *zap.Logger,
+) domains.SubscriptionService {
+	return &subscriptionService{
+		db:             db,
+		paymentService: paymentService,
+		shopifyRepo:    shopifyRepo,
+		mailgunRepo:    mailgunRepo,
+		audit:          audit,
+		policy:         policy,
+		location:       location,
+		logger:         logger,
+	}
+}
+
+// Create starts a subscription for a customer who has an affiliated
+// account. Its first charge is at req.StartsAt, or at the next run.
+func (s *subscriptionService) Create(ctx context.Context, req models.CreateSubscriptionRequest) (*models.SubscriptionResponse, error) {
+	interval := domains.SubscriptionInterval{Unit: req.IntervalUnit, Count: req.IntervalCount}
+	if err := interval.Validate(); err != nil {
+		return nil, err
+	}
+
+	customer, err := s.shopifyRepo.GetCustomerByID(ctx, req.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil || !customer.HasDirectDebitAccount() {
+		return nil, domains.ErrSubscriptionNoAffiliation
+	}
+
+	lineItems, err := json.Marshal(req.LineItems)
+	if err != nil {
+		return nil, err
+	}
+	startsAt := time.Now()
+	if req.StartsAt != nil {
+		startsAt = *req.StartsAt
+	}
+	sub := dbModels.Subscription{
+		CustomerID:    stripCustomerGIDPrefix(customer.ID),
+		LineItems:     lineItems,
+		IntervalUnit:  interval.Unit,
+		IntervalCount: interval.Count,
+		StartsAt:      startsAt,
+		NextChargeAt:  startsAt,
+		Status:        domains.SubscriptionStatusActive,
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	if err = tx.Create(&sub).Error; err != nil {
+		s.logger.Error("failed to create subscription", zap.Error(err), zap.String("customerID", sub.CustomerID))
+		return nil, err
+	}
+	s.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionSubscriptionCreate,
+		SubjectType: domains.AuditSubjectSubscription,
+		SubjectID:   fmt.Sprint(sub.ID),
+		After:       sub,
+	})
+
+	return &models.SubscriptionResponse{Subscription: sub}, nil
+}
+
+func (s *subscriptionService) Get(ctx context.Context, id int) (*models.SubscriptionResponse, error) {
+	var sub dbModels.Subscription
+	err := s.db.WithContext(ctx).First(&sub, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domains.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.SubscriptionResponse{Subscription: sub}, nil
+}
+
+func (s *subscriptionService) List(ctx context.Context, req models.ListSubscriptionsRequest) (*models.SubscriptionPage, error) {
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = subscriptionsDefaultPageSize
+	}
+
+	query := s.db.WithContext(ctx).Model(&dbModels.Subscription{})
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+	if req.CustomerID != "" {
+		query = query.Where("customer_id = ?", stripCustomerGIDPrefix(req.CustomerID))
+	}
+
+	page := &models.SubscriptionPage{Page: req.Page, PageSize: req.PageSize}
+	if err := query.Count(&page.Total).Error; err != nil {
+		s.logger.Error("failed to count subscriptions", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	page.Items = make([]dbModels.Subscription, 0, req.PageSize)
+	if err := query.Order("id DESC").
+		Offset((req.Page - 1) * req.PageSize).
+		Limit(req.PageSize).
+		Find(&page.Items).Error; err != nil {
+		s.logger.Error("failed to list subscriptions", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Pause stops charging an active subscription until it is resumed.
+func (s *subscriptionService) Pause(ctx context.Context, id int) (*models.SubscriptionResponse, error) {
+	return s.transition(ctx, id, domains.AuditActionSubscriptionPause,
+		[]string{domains.SubscriptionStatusActive},
+		func(sub *dbModels.Subscription, now time.Time) {
+			sub.Status = domains.SubscriptionStatusPaused
+			sub.PauseReason = domains.SubscriptionPauseManual
+			sub.PausedAt = &now
+		})
+}
+
+// Resume charges a paused subscription again, from a clean slate of
+// declines. A charge that fell due while paused is made at the next run.
+func (s *subscriptionService) Resume(ctx context.Context, id int) (*models.SubscriptionResponse, error) {
+	return s.transition(ctx, id, domains.AuditActionSubscriptionResume,
+		[]string{domains.SubscriptionStatusPaused},
+		func(sub *dbModels.Subscription, now time.Time) {
+			sub.Status = domains.SubscriptionStatusActive
+			sub.PauseReason = ""
+			sub.PausedAt = nil
+			sub.Attempts = 0
+			sub.LastCode = ""
+			sub.FirstDeclinedAt = nil
+		})
+}
+
+// Cancel ends a subscription for good. A draft already created for the
+// period is left in Shopify, unpaid.
+func (s *subscriptionService) Cancel(ctx context.Context, id int) (*models.SubscriptionResponse, error) {
+	return s.transition(ctx, id, domains.AuditActionSubscriptionCancel,
+		[]string{domains.SubscriptionStatusActive, domains.SubscriptionStatusPaused},
+		func(sub *dbModels.Subscription, now time.Time) {
+			sub.Status = domains.SubscriptionStatusCancelled
+			sub.CancelledAt = &now
+		})
+}
+
+// transition applies change to subscription id if its status is one of
+// from, locking the row so two callers can't both move it.
+func (s *subscriptionService) transition(
+	ctx context.Context, id int, action string, from []string, change func(*dbModels.Subscription, time.Time),
+) (_ *models.SubscriptionResponse, err error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	var sub dbModels.Subscription
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = domains.ErrSubscriptionNotFound
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(from, sub.Status) {
+		err = fmt.Errorf("%w: it is %s", domains.ErrSubscriptionStatus, sub.Status)
+		return nil, err
+	}
+
+	before := sub
+	change(&sub, time.Now())
+	if err = tx.Save(&sub).Error; err != nil {
+		s.logger.Error("failed to update subscription", zap.Error(err), zap.Int("subscriptionID", id), zap.String("action", action))
+		return nil, err
+	}
+	s.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      action,
+		SubjectType: domains.AuditSubjectSubscription,
+		SubjectID:   fmt.Sprint(id),
+		Before:      before,
+		After:       sub,
+	})
+
+	return &models.SubscriptionResponse{Subscription: sub}, nil
+}
+
+// ChargeDue charges every due subscription across subscriptionWorkers.
+// Once ctx is cancelled no more are claimed; charges under way finish.
+func (s *subscriptionService) ChargeDue(ctx context.Context) {
+	runStart := time.Now()
+	var wg sync.WaitGroup
+	for range subscriptionWorkers {
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				sub, err := s.claim(ctx, runStart)
+				if err != nil {
+					if !errors.Is(err, context.Canceled) {
+						s.logger.Error("subscriptions: failed to claim subscription", zap.Error(err))
+					}
+					return
+				}
+				if sub == nil {
+					return
+				}
+				s.chargeSafe(context.WithoutCancel(ctx), sub)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func (s *subscriptionService) claim(ctx context.Context, runStart time.Time) (*dbModels.Subscription, error) {
+	now := time.Now()
+	var sub dbModels.Subscription
+	err := s.db.WithContext(ctx).Raw(claimSubscriptionQuery, map[string]any{
+		"active":      domains.SubscriptionStatusActive,
+		"lockedUntil": now.Add(domains.SubscriptionLease),
+		"runStart":    runStart,
+		"now":         now,
+	}).Scan(&sub).Error
+	if err != nil || sub.ID == 0 {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// chargeSafe runs charge with panic recovery so one bad subscription can't
+// take down its worker.
+func (s *subscriptionService) chargeSafe(ctx context.Context, sub *dbModels.Subscription) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("subscriptions: worker panicked", zap.Int("subscriptionID", sub.ID), zap.Any("panic", r))
+		}
+	}()
+	s.charge(ctx, sub)
+}
+
+// charge bills sub's current period: creates its draft unless an earlier run
+// did, charges it and records the outcome. An error leaves everything as it
+// was, under the lease, for the next run.
+func (s *subscriptionService) charge(ctx context.Context, sub *dbModels.Subscription) {
+	logger := s.logger.With(
+		zap.Int("subscriptionID", sub.ID),
+		zap.String("customerID", sub.CustomerID),
+		zap.Int("period", sub.Period),
+	)
+
+	if sub.DraftOrderID == nil {
+		if err := s.createDraft(ctx, sub); err != nil {
+			logger.Error("subscriptions: failed to create draft order, will retry next run", zap.Error(err))
+			return
+		}
+	}
+	logger = logger.With(zap.String("draftOrderID", *sub.DraftOrderID))
+
+	resp, err := s.paymentService.ChargeRecurring(ctx, *sub.DraftOrderID, models.OrderTypeDraft)
+	switch {
+	case errors.Is(err, domains.ErrOrderAlreadyCharged):
+		// An earlier run charged it but didn't get to record it.
+		logger.Info("subscriptions: draft order already charged")
+		s.charged(ctx, sub, nil)
+	case errors.Is(err, domains.ErrChargeOutcomeUnknown):
+		logger.Error("subscriptions: charge outcome unknown, pausing", zap.Error(err))
+		s.pauseOnFailure(ctx, sub, domains.SubscriptionPauseOutcomeUnknown)
+	case err != nil:
+		logger.Error("subscriptions: charge errored, will retry next run", zap.Error(err))
+	case resp.Success:
+		logger.Info("subscriptions: charged", zap.String("orderID", resp.OrderID))
+		s.charged(ctx, sub, resp)
+	default:
+		s.declined(ctx, sub, resp.Code)
+	}
+}
+
+// createDraft creates the draft order for sub's current period and records
+// it on sub, so a later run charges the same draft instead of making another.
+func (s *subscriptionService) createDraft(ctx context.Context, sub *dbModels.Subscription) error {
+	var items []models.SubscriptionLineItem
+	if err := json.Unmarshal(sub.LineItems, &items); err != nil {
+		return fmt.Errorf("line items: %w", err)
+	}
+	input := shopify.DraftOrderInput{
+		CustomerID: sub.CustomerID,
+		Tags:       []string{domains.SubscriptionTag},
+		Note:       fmt.Sprintf("Suscripción %d, período %d", sub.ID, sub.Period+1),
+	}
+	for _, item := range items {
+		input.LineItems = append(input.LineItems, shopify.DraftOrderLineItem{VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+
+	draft, err := s.shopifyRepo.CreateDraftOrder(ctx, input)
+	if err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Model(sub).Updates(map[string]any{
+		"draft_order_id":   draft.ID,
+		"draft_order_name": draft.Name,
+	}).Error; err != nil {
+		// The draft is left unpaid in Shopify; the next run makes another.
+		return fmt.Errorf("record draft order %s: %w", draft.ID, err)
+	}
+	sub.DraftOrderID = &draft.ID
+	sub.DraftOrderName = draft.Name
+	return nil
+}
+
+// charged moves sub on to its next period after now. resp is nil when the
+// draft was found already charged.
+func (s *subscriptionService) charged(ctx context.Context, sub *dbModels.Subscription, resp *models.ProcessDirectDebitAccountResponse) {
+	now := time.Now()
+	interval := domains.SubscriptionInterval{Unit: sub.IntervalUnit, Count: sub.IntervalCount}
+	period, nextChargeAt := interval.NextPeriod(sub.StartsAt, sub.Period, now)
+
+	// A draft charged but not completed (support is alerted) has no order
+	// yet: the draft stands in for it.
+	orderID, orderName := *sub.DraftOrderID, sub.DraftOrderName
+	if resp != nil && resp.OrderID != "" {
+		orderID, orderName = resp.OrderID, resp.OrderName
+	}
+
+	if err := s.db.WithContext(ctx).Model(sub).Updates(map[string]any{
+		"period":            period,
+		"next_charge_at":    nextChargeAt,
+		"draft_order_id":    nil,
+		"draft_order_name":  "",
+		"attempts":          0,
+		"last_code":         "",
+		"first_declined_at": nil,
+		"last_order_id":     orderID,
+		"last_order_name":   orderName,
+		"last_charged_at":   now,
+		"locked_until":      nil,
+	}).Error; err != nil {
+		// Left leased with the draft on it: the next run finds it charged.
+		s.logger.Error("subscriptions: failed to record charge", zap.Error(err), zap.Int("subscriptionID", sub.ID))
+	}
+}
+
+// declined schedules the period's next attempt on policy, or pauses sub once
+// the policy gives up.
+func (s *subscriptionService) declined(ctx context.Context, sub *dbModels.Subscription, code string) {
+	now := time.Now().In(s.location)
+	attempts := sub.Attempts + 1
+	firstDeclinedAt := now
+	if sub.FirstDeclinedAt != nil {
+		firstDeclinedAt = *sub.FirstDeclinedAt
+	}
+	retryAt, giveUp := s.policy.Next(code, attempts, firstDeclinedAt, now)
+
+	values := map[string]any{
+		"attempts":          attempts,
+		"last_code":         code,
+		"first_declined_at": firstDeclinedAt,
+		"locked_until":      nil,
+	}
+	if giveUp == "" {
+		values["next_charge_at"] = retryAt
+	}
+	if err := s.db.WithContext(ctx).Model(sub).Updates(values).Error; err != nil {
+		s.logger.Error("subscriptions: failed to record decline", zap.Error(err), zap.Int("subscriptionID", sub.ID))
+	}
+	sub.Attempts, sub.LastCode, sub.FirstDeclinedAt = attempts, code, &firstDeclinedAt
+
+	if giveUp == "" {
+		s.logger.Info("subscriptions: charge declined, will retry",
+			zap.Int("subscriptionID", sub.ID), zap.String("code", code), zap.Time("nextChargeAt", retryAt))
+		return
+	}
+	s.pauseOnFailure(ctx, sub, giveUp)
+}
+
+// pauseOnFailure pauses sub, if still active, for a charge the scheduler
+// won't retry, and tells support; the customer too, for a decline. The
+// period's draft stays on sub and is charged on resume.
+func (s *subscriptionService) pauseOnFailure(ctx context.Context, sub *dbModels.Subscription, reason string) {
+	logger := s.logger.With(
+		zap.Int("subscriptionID", sub.ID),
+		zap.String("customerID", sub.CustomerID),
+		zap.String("reason", reason),
+		zap.String("code", sub.LastCode),
+	)
+	now := time.Now()
+
+	before := *sub
+	result := s.db.WithContext(ctx).Model(sub).
+		Where("status = ?", domains.SubscriptionStatusActive).
+		Updates(map[string]any{
+			"status":       domains.SubscriptionStatusPaused,
+			"pause_reason": reason,
+			"paused_at":    now,
+			"locked_until": nil,
+		})
+	if result.Error != nil {
+		logger.Error("subscriptions: failed to pause subscription", zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	logger.Warn("subscriptions: paused after a failed charge")
+	s.audit.Record(ctx, nil, domains.AuditEvent{
+		Action:      domains.AuditActionSubscriptionPause,
+		SubjectType: domains.AuditSubjectSubscription,
+		SubjectID:   fmt.Sprint(sub.ID),
+		Before:      before,
+		After:       map[string]any{"status": domains.SubscriptionStatusPaused, "pauseReason": reason},
+	})
+
+	why, ok := recurrentGiveUpReasons[reason]
+	if !ok {
+		why = "R4 no respondió al cobro; verificar en R4 si se cobró antes de reanudar"
+	}
+	if err := s.mailgunRepo.SendSupportEmail(ctx, mailgun.SupportEmailRequest{
+		Subject: fmt.Sprintf("Suscripción %d pausada", sub.ID),
+		Body: fmt.Sprintf(
+			"Se pausó la suscripción %d del cliente %s.\nMotivo: %s (%s)\nBorrador: %s\nIntentos: %d\nÚltimo código: %s",
+			sub.ID, sub.CustomerID, why, reason, sub.DraftOrderName, sub.Attempts, sub.LastCode,
+		),
+	}); err != nil {
+		logger.Error("subscriptions: failed to notify support", zap.Error(err))
+	}
+	if !ok {
+		return
+	}
+
+	customer, err := s.shopifyRepo.GetCustomerByID(ctx, sub.CustomerID)
+	if err != nil || customer == nil || customer.Email == "" {
+		logger.Warn("subscriptions: customer not notified, no email found", zap.Error(err))
+		return
+	}
+	if err := s.mailgunRepo.SendRecurrentChargeFailedEmail(ctx, mailgun.RecurrentChargeFailedEmailRequest{
+		To:        customer.Email,
+		UserName:  customer.DisplayName,
+		OrderName: sub.DraftOrderName,
+		Reason:    why,
+	}); err != nil {
+		logger.Error("subscriptions: failed to notify the customer", zap.Error(err))
+	}
+}
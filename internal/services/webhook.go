@@ -2,30 +2,29 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"go.uber.org/zap"
-	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 
 	"appa_payments/internal/domains"
 	"appa_payments/internal/models"
-	dbModels "appa_payments/pkg/db/models"
 )
 
 type webhookService struct {
 	paymentService domains.PaymentService
-	db             *gorm.DB
+	recurrentRetry domains.RecurrentRetrier
 	logger         *zap.Logger
 }
 
 func NewWebhookService(
 	paymentService domains.PaymentService,
-	db *gorm.DB,
+	recurrentRetry domains.RecurrentRetrier,
 	logger *zap.Logger,
 ) domains.WebhookService {
 	return &webhookService{
 		paymentService: paymentService,
-		db:             db,
+		recurrentRetry: recurrentRetry,
 		logger:         logger,
 	}
 }
@@ -36,17 +35,18 @@ func NewWebhookService(
 // source of truth for the recurrent-app gate, the affiliation gate, and the
 // OTP-bypass behaviour, so no order data is fetched here.
 //
-// Charge failures are persisted by the payment service and do not propagate as
-// errors — the webhook always succeeds so Shopify does not retry. A declined
-// (not erroring) charge is also recorded as a pending retry so the daily
-// recurrent-retry job (see internal/services/recurrent_retry.go) can follow up.
+// A failed dedup check or an erroring charge is returned, so the webhook queue
+// retries the job with backoff (see internal/services/webhook_queue.go). A
+// declined (not erroring) charge is not an error: it is recorded as a pending
+// retry so the daily recurrent-retry job (see
+// internal/services/recurrent_retry.go) can follow up.
 func (s *webhookService) OrdersCreated(ctx context.Context, orderID string) error {
 	alreadyCharged, err := s.paymentService.HasSuccessfulRecurrentCharge(ctx, orderID)
 	if err != nil {
 		s.logger.Error("webhook: dedup check failed",
 			zap.String("orderID", orderID),
 			zap.Error(err))
-		return nil
+		return fmt.Errorf("dedup check: %w", err)
 	}
 	if alreadyCharged {
 		s.logger.Info("webhook: order already charged successfully, skipping",
@@ -58,11 +58,22 @@ func (s *webhookService) OrdersCreated(ctx context.Context, orderID string) erro
 		OrderID: orderID,
 		OTP:     "",
 	})
-	if err != nil {
+	switch {
+	case errors.Is(err, domains.ErrOrderAlreadyCharged):
+		s.logger.Info("webhook: order charged elsewhere, skipping",
+			zap.String("orderID", orderID))
+		return nil
+	case errors.Is(err, domains.ErrPaymentInProgress):
+		// Retried: by then the other charge has finished and the dedup check
+		// settles it.
+		s.logger.Info("webhook: order being charged elsewhere, will check again",
+			zap.String("orderID", orderID))
+		return err
+	case err != nil:
 		s.logger.Error("webhook: recurrent charge errored",
 			zap.String("orderID", orderID),
 			zap.Error(err))
-		return nil
+		return fmt.Errorf("recurrent charge: %w", err)
 	}
 
 	s.logger.Info("webhook: recurrent charge completed",
@@ -70,8 +81,16 @@ func (s *webhookService) OrdersCreated(ctx context.Context, orderID string) erro
 		zap.Bool("success", chargeResp.Success),
 		zap.String("code", chargeResp.Code))
 
+	// An order from outside the recurring app, which a replay may name, is
+	// refused for its empty OTP; no retry can charge it.
+	if chargeResp.Code == domains.ResponseCodeInvalidOTP || chargeResp.Code == domains.ResponseCodeOTPLocked {
+		s.logger.Warn("webhook: order is not a recurring app order, not retrying",
+			zap.String("orderID", orderID))
+		return nil
+	}
+
 	if !chargeResp.Success {
-		if err := s.savePendingRetry(ctx, orderID, chargeResp.OrderName); err != nil {
+		if err := s.recurrentRetry.RecordDecline(ctx, orderID, chargeResp.OrderName, chargeResp.Code); err != nil {
 			s.logger.Error("webhook: failed to save pending recurrent retry",
 				zap.String("orderID", orderID),
 				zap.Error(err))
@@ -80,17 +99,3 @@ func (s *webhookService) OrdersCreated(ctx context.Context, orderID string) erro
 
 	return nil
 }
-
-// savePendingRetry records a declined recurrent charge for the daily retry job.
-// ON CONFLICT DO NOTHING means repeated declines for the same order do not
-// duplicate rows or reset the retry window.
-func (s *webhookService) savePendingRetry(ctx context.Context, orderID, orderName string) error {
-	record := &dbModels.RecurrentPendingPayment{
-		OrderID:   orderID,
-		OrderName: orderName,
-	}
-	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "order_id"}},
-		DoNothing: true,
-	}).Create(record).Error
-}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"appa_payments/internal/domains"
+	"appa_payments/internal/models"
+	"appa_payments/pkg/db"
+	dbModels "appa_payments/pkg/db/models"
+)
+
+const (
+	// webhookWorkers bounds how many jobs run at once; each may wait on a
+	// charge call to R4 for minutes.
+	webhookWorkers = 4
+	// webhookPollEvery is how long an idle worker waits before looking for
+	// jobs again.
+	webhookPollEvery = 2 * time.Second
+
+	webhookJobsDefaultPageSize = 50
+)
+
+// claimWebhookJobQuery takes the next due job: a pending one whose run_at has
+// come, or a running one whose lease ran out. SKIP LOCKED lets every worker
+// of every instance claim at once without handing out the same job twice.
+const claimWebhookJobQuery = `
+UPDATE webhook_jobs
+SET status = @running, attempts = attempts + 1, locked_until = @lockedUntil, updated_at = @now
+WHERE id = (
+	SELECT id FROM webhook_jobs
+	WHERE (status = @pending AND run_at <= @now)
+	   OR (status = @running AND locked_until < @now)
+	ORDER BY run_at
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *`
+
+// replayWebhookJobQuery queues a job to run now: a new one, or the existing
+// one reset to a fresh start. A running job is left alone and no row comes
+// back.
+const replayWebhookJobQuery = `
+INSERT INTO webhook_jobs (topic, order_id, status, run_at)
+VALUES (@topic, @orderID, @pending, @now)
+ON CONFLICT (topic, order_id) DO UPDATE
+SET status = @pending, attempts = 0, last_error = NULL, run_at = @now,
+	locked_until = NULL, completed_at = NULL, updated_at = @now
+WHERE webhook_jobs.status <> @running
+RETURNING *`
+
+type webhookQueue struct {
+	db             *gorm.DB
+	webhookService domains.WebhookService
+	audit          domains.AuditService
+	logger         *zap.Logger
+}
+
+// NewWebhookQueue keeps webhook jobs in Postgres; Run processes them with
+// webhookService.
+func NewWebhookQueue(db *gorm.DB, webhookService domains.WebhookService, audit domains.AuditService, logger *zap.Logger) domains.WebhookQueue {
+	return &webhookQueue{db: db, webhookService: webhookService, audit: audit, logger: logger}
+}
+
+func (q *webhookQueue) Enqueue(ctx context.Context, topic, orderID string) error {
+	job := &dbModels.WebhookJob{
+		Topic:   topic,
+		OrderID: orderID,
+		Status:  domains.WebhookJobPending,
+		RunAt:   time.Now(),
+	}
+	return q.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "topic"}, {Name: "order_id"}},
+		DoNothing: true,
+	}).Create(job).Error
+}
+
+func (q *webhookQueue) Replay(ctx context.Context, topic, orderID string) (_ *models.WebhookJobResponse, err error) {
+	tx := q.db.WithContext(ctx).Begin()
+	defer db.DBRollback(tx, &err)
+
+	var before dbModels.WebhookJob
+	if err = tx.Where("topic = ? AND order_id = ?", topic, orderID).
+		Limit(1).Find(&before).Error; err != nil {
+		return nil, err
+	}
+
+	var job dbModels.WebhookJob
+	if err = tx.Raw(replayWebhookJobQuery, map[string]any{
+		"topic":   topic,
+		"orderID": orderID,
+		"pending": domains.WebhookJobPending,
+		"running": domains.WebhookJobRunning,
+		"now":     time.Now(),
+	}).Scan(&job).Error; err != nil {
+		q.logger.Error("webhook: failed to replay job", zap.Error(err), zap.String("topic", topic), zap.String("orderID", orderID))
+		return nil, err
+	}
+	if job.ID == 0 {
+		err = domains.ErrWebhookJobRunning
+		return nil, err
+	}
+
+	var previous any
+	if before.ID != 0 {
+		previous = before
+	}
+	q.audit.Record(ctx, tx, domains.AuditEvent{
+		Action:      domains.AuditActionWebhookReplay,
+		SubjectType: domains.AuditSubjectOrder,
+		SubjectID:   orderID,
+		Before:      previous,
+		After:       job,
+	})
+
+	return &models.WebhookJobResponse{Job: job}, nil
+}
+
+func (q *webhookQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range webhookWorkers {
+		wg.Go(func() { q.worker(ctx, i) })
+	}
+	wg.Wait()
+}
+
+// worker processes jobs until ctx is cancelled. A job in hand is finished
+// first: it runs on a context that isn't cancelled with ctx, so a shutdown
+// doesn't cut a charge short.
+func (q *webhookQueue) worker(ctx context.Context, id int) {
+	for ctx.Err() == nil {
+		job, err := q.claim(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			q.logger.Error("webhook: failed to claim job", zap.Int("workerID", id), zap.Error(err))
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(webhookPollEvery):
+			}
+			continue
+		}
+		q.finish(context.WithoutCancel(ctx), job, q.process(context.WithoutCancel(ctx), job))
+	}
+}
+
+func (q *webhookQueue) claim(ctx context.Context) (*dbModels.WebhookJob, error) {
+	now := time.Now()
+	var job dbModels.WebhookJob
+	err := q.db.WithContext(ctx).Raw(claimWebhookJobQuery, map[string]any{
+		"running":     domains.WebhookJobRunning,
+		"pending":     domains.WebhookJobPending,
+		"lockedUntil": now.Add(domains.WebhookJobLease),
+		"now":         now,
+	}).Scan(&job).Error
+	if err != nil || job.ID == 0 {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (q *webhookQueue) process(ctx context.Context, job *dbModels.WebhookJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	switch job.Topic {
+	case domains.WebhookTopicOrdersCreated:
+		return q.webhookService.OrdersCreated(ctx, job.OrderID)
+	default:
+		return fmt.Errorf("unknown webhook topic %q", job.Topic)
+	}
+}
+
+// finish records how job went: done, pending again after a backoff, or dead
+// once it has used up its attempts or R4 may already have charged.
+func (q *webhookQueue) finish(ctx context.Context, job *dbModels.WebhookJob, jobErr error) {
+	now := time.Now()
+	fields := []zap.Field{
+		zap.Int("jobID", job.ID),
+		zap.String("topic", job.Topic),
+		zap.String("orderID", job.OrderID),
+		zap.Int("attempts", job.Attempts),
+	}
+
+	values := map[string]any{"locked_until": nil, "updated_at": now}
+	switch {
+	case jobErr == nil:
+		values["status"] = domains.WebhookJobDone
+		values["completed_at"] = now
+		values["last_error"] = nil
+	case job.Attempts >= domains.WebhookJobMaxAttempts, errors.Is(jobErr, domains.ErrChargeOutcomeUnknown):
+		values["status"] = domains.WebhookJobDead
+		values["last_error"] = jobErr.Error()
+		q.logger.Error("webhook: job failed, giving up", append(fields, zap.Error(jobErr))...)
+	default:
+		delay := domains.WebhookJobRetryDelay(job.Attempts)
+		values["status"] = domains.WebhookJobPending
+		values["run_at"] = now.Add(delay)
+		values["last_error"] = jobErr.Error()
+		q.logger.Warn("webhook: job failed, will retry", append(fields, zap.Error(jobErr), zap.Duration("retryIn", delay))...)
+	}
+
+	// Only while still ours: past the lease another worker may hold it.
+	result := q.db.WithContext(ctx).Model(&dbModels.WebhookJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, domains.WebhookJobRunning, job.Attempts).
+		Updates(values)
+	if result.Error != nil {
+		q.logger.Error("webhook: failed to record job result", append(fields, zap.Error(result.Error))...)
+		return
+	}
+	if result.RowsAffected == 0 {
+		q.logger.Warn("webhook: job was reclaimed before it finished", fields...)
+	}
+}
+
+func (q *webhookQueue) List(ctx context.Context, req models.ListWebhookJobsRequest) (*models.WebhookJobPage, error) {
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = webhookJobsDefaultPageSize
+	}
+
+	query := q.db.WithContext(ctx).Model(&dbModels.WebhookJob{})
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+	if req.Topic != "" {
+		query = query.Where("topic = ?", req.Topic)
+	}
+	if req.OrderID != "" {
+		query = query.Where("order_id = ?", req.OrderID)
+	}
+
+	page := &models.WebhookJobPage{Page: req.Page, PageSize: req.PageSize}
+	if err := query.Count(&page.Total).Error; err != nil {
+		q.logger.Error("failed to count webhook jobs", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	page.Items = make([]dbModels.WebhookJob, 0, req.PageSize)
+	if err := query.Order("id DESC").
+		Offset((req.Page - 1) * req.PageSize).
+		Limit(req.PageSize).
+		Find(&page.Items).Error; err != nil {
+		q.logger.Error("failed to list webhook jobs", zap.Error(err), zap.Any("filters", req))
+		return nil, err
+	}
+
+	return page, nil
+}
@@ -12,24 +12,31 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	helpers "appa_payments/pkg"
+	dbModels "appa_payments/pkg/db/models"
 	"appa_payments/pkg/r4bank"
 )
 
 type Client interface {
 	Get(ctx context.Context) (float64, error)
+	// Cached returns today's rate only if Get has already fetched it; it
+	// never touches the network or the database.
+	Cached() (float64, bool)
 }
 
 type client struct {
 	R4Repository r4bank.R4Repository
 	BCVTasa      *Rate
+	db           *gorm.DB
 	loc          *time.Location
 	logger       *zap.Logger
 }
 
-func NewClient(R4Repository r4bank.R4Repository, loc *time.Location, logger *zap.Logger) Client {
-	return &client{R4Repository: R4Repository, loc: loc, logger: logger}
+func NewClient(R4Repository r4bank.R4Repository, db *gorm.DB, loc *time.Location, logger *zap.Logger) Client {
+	return &client{R4Repository: R4Repository, db: db, loc: loc, logger: logger}
 }
 
 // GetBCV fetches the exchange rate from the BCV Website
@@ -62,9 +69,34 @@ func (c *client) Get(ctx context.Context) (float64, error) {
 	if rate == 0 {
 		return 0, fmt.Errorf("no exchange rate found on BCV page")
 	}
+
+	c.saveRate(ctx, c.BCVTasa.Date, rate)
 	return rate, nil
 }
 
+func (c *client) Cached() (float64, bool) {
+	tasa := c.BCVTasa
+	if tasa == nil || tasa.Rate == 0 || !helpers.SameDay(tasa.Date, time.Now()) {
+		return 0, false
+	}
+	return tasa.Rate, true
+}
+
+// saveRate keeps the day's rate in bcv_rates so historical amounts can be
+// converted later. The first rate of the day wins.
+func (c *client) saveRate(ctx context.Context, now time.Time, rate float64) {
+	now = now.In(c.loc)
+	record := dbModels.BCVRate{
+		Date: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, c.loc),
+		Rate: rate,
+	}
+	if err := c.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&record).Error; err != nil {
+		c.logger.Error("failed to save BCV rate", zap.Error(err), zap.Float64("rate", rate))
+	}
+}
+
 func (c *client) fetchRate() (float64, error) {
 	url := "https://www.bcv.org.ve/"
 
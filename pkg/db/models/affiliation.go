@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Affiliation is one account a customer affiliated for domiciliación, and
+// what became of it. The account is kept masked, bank code and last 4
+// digits; the full number lives only in the Shopify metafield.
+type Affiliation struct {
+	ID            int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID    string     `gorm:"column:customer_id" json:"customerId"`
+	Status        string     `gorm:"column:status" json:"status"`
+	AccountMasked string     `gorm:"column:account_masked" json:"accountMasked"`
+	Bank          string     `gorm:"column:bank" json:"bank"`
+	DNI           string     `gorm:"column:dni" json:"dni"`
+	LastCode      string     `gorm:"column:last_code" json:"lastCode,omitempty"`
+	OrderID       string     `gorm:"column:order_id" json:"orderId,omitempty"`
+	RequestedAt   *time.Time `gorm:"column:requested_at" json:"requestedAt,omitempty"`
+	ActivatedAt   *time.Time `gorm:"column:activated_at" json:"activatedAt,omitempty"`
+	RefusedAt     *time.Time `gorm:"column:refused_at" json:"refusedAt,omitempty"`
+	RevokedAt     *time.Time `gorm:"column:revoked_at" json:"revokedAt,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (Affiliation) TableName() string {
+	return "affiliations"
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ManualOrderTransition records one status change of a manual order: who
+// moved it, from what, to what, and why. Rows are only ever inserted.
+type ManualOrderTransition struct {
+	ID            int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ManualOrderID int       `gorm:"column:manual_order_id;not null" json:"manualOrderId"`
+	FromStatus    string    `gorm:"column:from_status" json:"fromStatus"`
+	ToStatus      string    `gorm:"column:to_status;not null" json:"toStatus"`
+	Reason        string    `gorm:"column:reason" json:"reason,omitempty"`
+	Actor         string    `gorm:"column:actor;not null" json:"actor"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (ManualOrderTransition) TableName() string {
+	return "appa_manual_order_transitions"
+}
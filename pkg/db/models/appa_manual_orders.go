@@ -6,16 +6,25 @@ import (
 
 type ManualOrder struct {
 	ID               int            `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	OrderName        string         `gorm:"column:order_name;size:128;unique;not null" json:"orderName"`
+	OrderName        string         `gorm:"column:order_name;size:128;not null" json:"orderName"`
 	OrderID          int            `gorm:"column:order_id;not null" json:"orderId"`
+	OrderType        string         `gorm:"column:order_type;size:20;default:Complete" json:"orderType"`
 	BillImageURL     string         `gorm:"column:bill_image_url;size:128;not null" json:"billImageUrl"`
 	Amount           float64        `gorm:"column:amount;type:decimal(10,2);not null" json:"amount"`
 	OrderTotalAmount float64        `gorm:"column:order_total_amount;type:decimal(10,2);not null" json:"orderTotalAmount"`
+	IGTFRate         float64        `gorm:"column:igtf_rate;type:decimal(5,4);default:0" json:"igtfRate"`
+	IGTFAmount       float64        `gorm:"column:igtf_amount;type:decimal(10,2);default:0" json:"igtfAmount"`
 	RequiresChange   bool           `gorm:"column:requires_change;not null" json:"requiresChange"`
 	ValidateStatus   string         `gorm:"column:validate_status;size:32;not null" json:"validateStatus"`
 	ReturnData       *[]byte        `gorm:"column:return_data;type:jsonb" json:"returnData,omitempty"`
 	PaymentMethodID  int            `gorm:"column:payment_method_id" json:"paymentMethodId,omitempty"`
 	PaymentMethod    *PaymentMethod `gorm:"foreignKey:PaymentMethodID" json:"paymentMethod,omitempty"`
+	ReceiptSHA256    string         `gorm:"column:receipt_sha256;size:64" json:"receiptSha256,omitempty"`
+	ReceiptPHash     *int64         `gorm:"column:receipt_phash" json:"receiptPhash,omitempty"`
+	DuplicateOfID    *int           `gorm:"column:duplicate_of_id" json:"duplicateOfId,omitempty"`
+	ReviewedBy       string         `gorm:"column:reviewed_by;size:128" json:"reviewedBy,omitempty"`
+	ReviewedAt       *time.Time     `gorm:"column:reviewed_at;type:timestamp" json:"reviewedAt,omitempty"`
+	RejectReason     string         `gorm:"column:reject_reason" json:"rejectReason,omitempty"`
 	CreatedAt        time.Time      `gorm:"column:created_at;type:timestamp;default:now()" json:"createdAt"`
 	UpdatedAt        time.Time      `gorm:"column:updated_at;type:timestamp;default:now()" json:"updatedAt"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent is one row of the append-only audit log: who (actor) did what
+// (action) to which subject, with the subject's state before and after.
+type AuditEvent struct {
+	ID          int             `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Actor       string          `gorm:"column:actor;size:128;not null" json:"actor"`
+	Action      string          `gorm:"column:action;size:64;not null" json:"action"`
+	SubjectType string          `gorm:"column:subject_type;size:32;not null" json:"subjectType"`
+	SubjectID   string          `gorm:"column:subject_id;size:128;not null" json:"subjectId"`
+	Before      json.RawMessage `gorm:"column:before;type:jsonb" json:"before,omitempty"`
+	After       json.RawMessage `gorm:"column:after;type:jsonb" json:"after,omitempty"`
+	RequestID   string          `gorm:"column:request_id;size:64" json:"requestId,omitempty"`
+	CreatedAt   time.Time       `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// BCVRate is the official USD rate in effect on a Caracas day, as first
+// fetched by the service that day.
+type BCVRate struct {
+	Date      time.Time `gorm:"column:date;type:date;primaryKey" json:"date"`
+	Rate      float64   `gorm:"column:rate" json:"rate"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (BCVRate) TableName() string {
+	return "bcv_rates"
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DailySettlement sums one rail's money movements over one Caracas day.
+// Amounts are bolívares; refunds and reversals are positive here and
+// subtracted in NetVES.
+type DailySettlement struct {
+	ID             int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	BusinessDate   time.Time       `gorm:"column:business_date;type:date" json:"businessDate"`
+	Rail           string          `gorm:"column:rail" json:"rail"`
+	ChargesCount   int             `gorm:"column:charges_count" json:"chargesCount"`
+	ChargesVES     float64         `gorm:"column:charges_ves" json:"chargesVes"`
+	RefundsCount   int             `gorm:"column:refunds_count" json:"refundsCount"`
+	RefundsVES     float64         `gorm:"column:refunds_ves" json:"refundsVes"`
+	ReversalsCount int             `gorm:"column:reversals_count" json:"reversalsCount"`
+	ReversalsVES   float64         `gorm:"column:reversals_ves" json:"reversalsVes"`
+	NetVES         float64         `gorm:"column:net_ves" json:"netVes"`
+	BCVRate        *float64        `gorm:"column:bcv_rate" json:"bcvRate"`
+	NetUSD         *float64        `gorm:"column:net_usd" json:"netUsd"`
+	FailedCount    int             `gorm:"column:failed_count" json:"failedCount"`
+	FailedByCode   json.RawMessage `gorm:"column:failed_by_code;type:jsonb" json:"failedByCode"`
+	CreatedAt      time.Time       `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time       `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (DailySettlement) TableName() string {
+	return "daily_settlements"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// IdempotencyKey is one Idempotency-Key seen on a route, with the response
+// it produced once the first request finished.
+type IdempotencyKey struct {
+	ID             int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Key            string     `gorm:"column:key" json:"key"`
+	Route          string     `gorm:"column:route" json:"route"`
+	Fingerprint    string     `gorm:"column:fingerprint" json:"fingerprint"`
+	Status         string     `gorm:"column:status" json:"status"`
+	ResponseStatus *int       `gorm:"column:response_status" json:"responseStatus,omitempty"`
+	ResponseBody   []byte     `gorm:"column:response_body" json:"-"`
+	ContentType    string     `gorm:"column:content_type" json:"contentType,omitempty"`
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	CompletedAt    *time.Time `gorm:"column:completed_at" json:"completedAt,omitempty"`
+	ExpiresAt      time.Time  `gorm:"column:expires_at" json:"expiresAt"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
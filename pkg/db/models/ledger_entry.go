@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// LedgerEntry is one side of a double-entry posting. Debits are positive and
+// credits negative; the entries sharing a TransactionID sum to zero.
+type LedgerEntry struct {
+	ID            int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	TransactionID string    `gorm:"column:transaction_id" json:"transactionId"`
+	Account       string    `gorm:"column:account" json:"account"`
+	Kind          string    `gorm:"column:kind" json:"kind"`
+	AmountVES     float64   `gorm:"column:amount_ves" json:"amountVes"`
+	AmountUSD     *float64  `gorm:"column:amount_usd" json:"amountUsd,omitempty"`
+	Source        string    `gorm:"column:source" json:"source"`
+	SourceID      int       `gorm:"column:source_id" json:"sourceId"`
+	Reference     string    `gorm:"column:reference" json:"reference,omitempty"`
+	OrderID       string    `gorm:"column:order_id" json:"orderId,omitempty"`
+	OrderName     string    `gorm:"column:order_name" json:"orderName,omitempty"`
+	CartID        string    `gorm:"column:cart_id" json:"cartId,omitempty"`
+	CustomerID    string    `gorm:"column:customer_id" json:"customerId,omitempty"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// OTPCode is the current one-time code for an order or cart. Only a hash of
+// the code is kept.
+type OTPCode struct {
+	ID         int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Key        string     `gorm:"column:key" json:"key"`
+	CodeHash   string     `gorm:"column:code_hash" json:"-"`
+	Attempts   int        `gorm:"column:attempts" json:"attempts"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at" json:"expiresAt"`
+	ConsumedAt *time.Time `gorm:"column:consumed_at" json:"consumedAt,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (OTPCode) TableName() string {
+	return "otp_codes"
+}
+
+// OTPSend records one code mailed to a scope (an order, cart or customer),
+// for the resend cooldown and daily cap.
+type OTPSend struct {
+	ID     int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Scope  string    `gorm:"column:scope" json:"scope"`
+	SentAt time.Time `gorm:"column:sent_at" json:"sentAt"`
+}
+
+func (OTPSend) TableName() string {
+	return "otp_sends"
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RateLimitCounter counts requests for one key in one fixed window.
+type RateLimitCounter struct {
+	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Key         string    `gorm:"column:key" json:"key"`
+	WindowStart time.Time `gorm:"column:window_start" json:"windowStart"`
+	Count       int       `gorm:"column:count" json:"count"`
+	ExpiresAt   time.Time `gorm:"column:expires_at" json:"expiresAt"`
+}
+
+func (RateLimitCounter) TableName() string {
+	return "rate_limit_counters"
+}
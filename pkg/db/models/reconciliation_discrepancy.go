@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ReconciliationDiscrepancy is one mismatch between an R4 table and Shopify
+// found by a reconciliation run. A run records each (type, order) once.
+type ReconciliationDiscrepancy struct {
+	ID            int       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	RunDate       time.Time `gorm:"column:run_date;type:date;not null" json:"runDate"`
+	Type          string    `gorm:"column:type;size:32;not null" json:"type"`
+	OrderID       string    `gorm:"column:order_id;size:100;not null" json:"orderId"`
+	OrderName     string    `gorm:"column:order_name;size:100" json:"orderName,omitempty"`
+	Sources       string    `gorm:"column:sources;size:255" json:"sources,omitempty"`
+	References    string    `gorm:"column:r4_references;size:255" json:"references,omitempty"`
+	Amount        float64   `gorm:"column:amount;type:numeric(12,2)" json:"amount"`
+	ShopifyStatus string    `gorm:"column:shopify_status;size:32" json:"shopifyStatus,omitempty"`
+	Detail        string    `gorm:"column:detail" json:"detail,omitempty"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (ReconciliationDiscrepancy) TableName() string {
+	return "reconciliation_discrepancies"
+}
@@ -3,15 +3,20 @@ package models
 import "time"
 
 // RecurrentPendingPayment tracks a recurrent direct-debit charge that was
-// declined by R4 at webhook time and is awaiting the daily retry job.
+// declined by R4 at webhook time and is awaiting the daily retry job. A row
+// given up on stays, with GaveUpAt set, and is no longer retried.
 type RecurrentPendingPayment struct {
-	ID            int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	OrderID       string    `gorm:"column:order_id;unique" json:"orderId"`
-	OrderName     string    `gorm:"column:order_name" json:"orderName"`
-	Attempts      int       `gorm:"column:attempts;default:1" json:"attempts"`
-	LastAttemptAt time.Time `gorm:"column:last_attempt_at" json:"lastAttemptAt"`
-	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime;default:CURRENT_TIMESTAMP" json:"createdAt"`
-	UpdatedAt     time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+	ID            int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID       string     `gorm:"column:order_id;unique" json:"orderId"`
+	OrderName     string     `gorm:"column:order_name" json:"orderName"`
+	Attempts      int        `gorm:"column:attempts;default:1" json:"attempts"`
+	LastAttemptAt time.Time  `gorm:"column:last_attempt_at" json:"lastAttemptAt"`
+	LastCode      string     `gorm:"column:last_code" json:"lastCode,omitempty"`
+	NextRetryAt   *time.Time `gorm:"column:next_retry_at" json:"nextRetryAt,omitempty"`
+	GaveUpAt      *time.Time `gorm:"column:gave_up_at" json:"gaveUpAt,omitempty"`
+	GiveUpReason  string     `gorm:"column:give_up_reason" json:"giveUpReason,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime;default:CURRENT_TIMESTAMP" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
 }
 
 func (RecurrentPendingPayment) TableName() string {
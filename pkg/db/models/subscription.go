@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Subscription is a customer's recurring purchase, billed by this service:
+// every interval the scheduler creates a draft order for the line items,
+// charges the customer's affiliated account and completes it.
+//
+// Period is the index of the charge NextChargeAt is for, counted from
+// StartsAt. DraftOrderID is set from the period's draft being created until
+// it is charged; Attempts, LastCode and FirstDeclinedAt track that period's
+// declines.
+type Subscription struct {
+	ID              int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID      string          `gorm:"column:customer_id" json:"customerId"`
+	LineItems       json.RawMessage `gorm:"column:line_items;type:jsonb" json:"lineItems"`
+	IntervalUnit    string          `gorm:"column:interval_unit" json:"intervalUnit"`
+	IntervalCount   int             `gorm:"column:interval_count" json:"intervalCount"`
+	StartsAt        time.Time       `gorm:"column:starts_at" json:"startsAt"`
+	Period          int             `gorm:"column:period" json:"period"`
+	NextChargeAt    time.Time       `gorm:"column:next_charge_at" json:"nextChargeAt"`
+	Status          string          `gorm:"column:status" json:"status"`
+	PauseReason     string          `gorm:"column:pause_reason" json:"pauseReason,omitempty"`
+	DraftOrderID    *string         `gorm:"column:draft_order_id" json:"draftOrderId,omitempty"`
+	DraftOrderName  string          `gorm:"column:draft_order_name" json:"draftOrderName,omitempty"`
+	Attempts        int             `gorm:"column:attempts" json:"attempts"`
+	LastCode        string          `gorm:"column:last_code" json:"lastCode,omitempty"`
+	FirstDeclinedAt *time.Time      `gorm:"column:first_declined_at" json:"firstDeclinedAt,omitempty"`
+	LastOrderID     string          `gorm:"column:last_order_id" json:"lastOrderId,omitempty"`
+	LastOrderName   string          `gorm:"column:last_order_name" json:"lastOrderName,omitempty"`
+	LastChargedAt   *time.Time      `gorm:"column:last_charged_at" json:"lastChargedAt,omitempty"`
+	LockedUntil     *time.Time      `gorm:"column:locked_until" json:"lockedUntil,omitempty"`
+	PausedAt        *time.Time      `gorm:"column:paused_at" json:"pausedAt,omitempty"`
+	CancelledAt     *time.Time      `gorm:"column:cancelled_at" json:"cancelledAt,omitempty"`
+	CreatedAt       time.Time       `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time       `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// UnattachedCartCharge tracks a successful cart-path charge that no order was
+// attached to in time, from the first alert to its refund or late attach.
+type UnattachedCartCharge struct {
+	ID          int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Source      string     `gorm:"column:source" json:"source"`
+	ChargeID    int        `gorm:"column:charge_id" json:"chargeId"`
+	CartID      string     `gorm:"column:cart_id" json:"cartId"`
+	Reference   string     `gorm:"column:reference" json:"reference"`
+	Amount      float64    `gorm:"column:amount" json:"amount"`
+	ChargedAt   time.Time  `gorm:"column:charged_at" json:"chargedAt"`
+	RefundedAt  *time.Time `gorm:"column:refunded_at" json:"refundedAt,omitempty"`
+	RefundError string     `gorm:"column:refund_error" json:"refundError,omitempty"`
+	ResolvedAt  *time.Time `gorm:"column:resolved_at" json:"resolvedAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (UnattachedCartCharge) TableName() string {
+	return "unattached_cart_charges"
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// WebhookJob is one webhook delivery waiting for, or done with, a worker.
+type WebhookJob struct {
+	ID          int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Topic       string     `gorm:"column:topic" json:"topic"`
+	OrderID     string     `gorm:"column:order_id" json:"orderId"`
+	Status      string     `gorm:"column:status" json:"status"`
+	Attempts    int        `gorm:"column:attempts" json:"attempts"`
+	LastError   *string    `gorm:"column:last_error" json:"lastError,omitempty"`
+	RunAt       time.Time  `gorm:"column:run_at" json:"runAt"`
+	LockedUntil *time.Time `gorm:"column:locked_until" json:"lockedUntil,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+	CompletedAt *time.Time `gorm:"column:completed_at" json:"completedAt,omitempty"`
+}
+
+func (WebhookJob) TableName() string {
+	return "webhook_jobs"
+}
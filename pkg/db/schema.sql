@@ -72,4 +72,317 @@ CREATE TABLE IF NOT EXISTS r4_appa_mobile_payments_reversals (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE UNIQUE INDEX idx_r4_appa_mobile_payments_reversals_id ON r4_appa_mobile_payments_reversals(id);
\ No newline at end of file
+CREATE UNIQUE INDEX idx_r4_appa_mobile_payments_reversals_id ON r4_appa_mobile_payments_reversals(id);
+-- appa_manual_orders predates this file; only the receipt columns are managed here.
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS receipt_sha256 varchar(64);
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS receipt_phash int8;
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS duplicate_of_id int4;
+
+CREATE INDEX IF NOT EXISTS idx_appa_manual_orders_receipt_sha256 ON appa_manual_orders(receipt_sha256);
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS order_type varchar(20) DEFAULT 'Complete';
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS reviewed_by varchar(128);
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP;
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS reject_reason text;
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS igtf_rate numeric(5,4) DEFAULT 0;
+ALTER TABLE appa_manual_orders ADD COLUMN IF NOT EXISTS igtf_amount numeric(10,2) DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_appa_manual_orders_validate_status ON appa_manual_orders(validate_status);
+
+-- A rejected receipt doesn't hold its order_name: the buyer can submit again.
+-- Replaces the table's original unique constraint.
+ALTER TABLE appa_manual_orders DROP CONSTRAINT IF EXISTS appa_manual_orders_order_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appa_manual_orders_order_name ON appa_manual_orders(order_name) WHERE validate_status <> 'REJECTED';
+
+CREATE TABLE IF NOT EXISTS appa_manual_order_transitions (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    manual_order_id int4 NOT NULL,
+    from_status varchar(32),
+    to_status varchar(32) NOT NULL,
+    reason text,
+    actor varchar(128) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_appa_manual_order_transitions_manual_order_id ON appa_manual_order_transitions(manual_order_id);
+
+-- Manual-review rails (domains.PaymentMethod*). payment_methods predates this
+-- file; the ids are fixed because the code refers to them.
+INSERT INTO payment_methods (id, name) VALUES
+    (1, 'Zelle'),
+    (2, 'Efectivo'),
+    (4, 'Pago Móvil')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id int8 GENERATED ALWAYS AS IDENTITY NOT NULL PRIMARY KEY,
+    actor varchar(128) NOT NULL,
+    action varchar(64) NOT NULL,
+    subject_type varchar(32) NOT NULL,
+    subject_id varchar(128) NOT NULL,
+    before jsonb,
+    after jsonb,
+    request_id varchar(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_events_subject ON audit_events(subject_type, subject_id);
+CREATE INDEX idx_audit_events_actor ON audit_events(actor);
+CREATE INDEX idx_audit_events_request_id ON audit_events(request_id);
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
+
+-- Append-only: the table refuses UPDATE and DELETE, whoever runs them.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TABLE IF NOT EXISTS reconciliation_discrepancies (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    run_date date NOT NULL,
+    type varchar(32) NOT NULL,
+    order_id varchar(100) NOT NULL,
+    order_name varchar(100),
+    sources varchar(255),
+    r4_references varchar(255),
+    amount numeric(12,2),
+    shopify_status varchar(32),
+    detail text,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_reconciliation_discrepancies_type_order ON reconciliation_discrepancies(type, order_id);
+CREATE INDEX idx_reconciliation_discrepancies_order_id ON reconciliation_discrepancies(order_id);
+
+-- Set when an orphaned pago móvil (no order, no cart) is refunded; refunded
+-- rows can no longer be matched.
+ALTER TABLE r4_appa_mobile_payments ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_r4_appa_mobile_payments_orphan ON r4_appa_mobile_payments(created_at)
+    WHERE order_id IS NULL AND cart_id IS NULL;
+
+-- Set when a cart charge never attached to an order is refunded; refunded
+-- rows can no longer be attached.
+ALTER TABLE r4_appa_debits_direct ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS unattached_cart_charges (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    source varchar(64) NOT NULL,
+    charge_id int4 NOT NULL,
+    cart_id varchar(255) NOT NULL,
+    reference varchar(100),
+    amount numeric(12,2),
+    charged_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    refunded_at TIMESTAMP WITH TIME ZONE,
+    refund_error text,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_unattached_cart_charges_charge ON unattached_cart_charges(source, charge_id);
+
+-- One row per Caracas day, written by the BCV client the first time it
+-- fetches that day's rate. Exports convert historical VES amounts with it.
+CREATE TABLE IF NOT EXISTS bcv_rates (
+    date date PRIMARY KEY,
+    rate numeric(14,4) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS daily_settlements (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    business_date date NOT NULL,
+    rail varchar(32) NOT NULL,
+    charges_count int4 NOT NULL DEFAULT 0,
+    charges_ves numeric(14,2) NOT NULL DEFAULT 0,
+    refunds_count int4 NOT NULL DEFAULT 0,
+    refunds_ves numeric(14,2) NOT NULL DEFAULT 0,
+    reversals_count int4 NOT NULL DEFAULT 0,
+    reversals_ves numeric(14,2) NOT NULL DEFAULT 0,
+    net_ves numeric(14,2) NOT NULL DEFAULT 0,
+    bcv_rate numeric(14,4),
+    net_usd numeric(14,2),
+    failed_count int4 NOT NULL DEFAULT 0,
+    failed_by_code jsonb NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_daily_settlements_day_rail ON daily_settlements(business_date, rail);
+
+-- Double-entry ledger: every posting is two rows sharing transaction_id,
+-- a debit (positive) and a credit (negative) that sum to zero.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    transaction_id varchar(32) NOT NULL,
+    account varchar(32) NOT NULL,
+    kind varchar(16) NOT NULL,
+    amount_ves numeric(14,2) NOT NULL,
+    amount_usd numeric(14,2),
+    source varchar(64) NOT NULL,
+    source_id int4 NOT NULL,
+    reference varchar(100),
+    order_id varchar(100),
+    order_name varchar(100),
+    cart_id varchar(255),
+    customer_id varchar(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ledger_entries_transaction_id ON ledger_entries(transaction_id);
+CREATE INDEX idx_ledger_entries_order_id ON ledger_entries(order_id);
+CREATE INDEX idx_ledger_entries_customer_id ON ledger_entries(customer_id);
+CREATE INDEX idx_ledger_entries_cart_reference ON ledger_entries(cart_id, reference);
+CREATE INDEX idx_ledger_entries_source ON ledger_entries(source, source_id);
+
+-- Idempotency-Key header on the charging endpoints: the first request claims
+-- (key, route) in_progress; its response is stored for replay until
+-- expires_at. An in_progress row left by a crash expires after the lock
+-- timeout.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    key varchar(255) NOT NULL,
+    route varchar(255) NOT NULL,
+    fingerprint varchar(64) NOT NULL,
+    status varchar(16) NOT NULL,
+    response_status int4,
+    response_body bytea,
+    content_type varchar(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_idempotency_keys_key_route ON idempotency_keys(key, route);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- One R4 pago móvil reference can back one order or cart only. Rows are
+-- claimed with a conditional UPDATE; this catches anything that slips past.
+-- Existing duplicates have to be resolved before it can be created.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_r4_appa_mobile_payments_linked_reference ON r4_appa_mobile_payments(reference)
+    WHERE order_id IS NOT NULL OR cart_id IS NOT NULL;
+
+-- OTPs for domiciliación charges, shared by every instance. One row per
+-- order/cart key; a new code replaces the old one. code_hash is an
+-- HMAC-SHA256 of the key and the code under OTP_HASH_SECRET.
+CREATE TABLE IF NOT EXISTS otp_codes (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    key varchar(255) NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_otp_codes_key ON otp_codes(key);
+CREATE INDEX idx_otp_codes_expires_at ON otp_codes(expires_at);
+
+-- Wrong guesses at the current code; reaching OTP_MAX_ATTEMPTS locks it.
+ALTER TABLE otp_codes ADD COLUMN IF NOT EXISTS attempts int4 NOT NULL DEFAULT 0;
+
+-- Every code mailed, once per scope it counts against (order/cart key and
+-- customer), for the resend cooldown and daily cap.
+CREATE TABLE IF NOT EXISTS otp_sends (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    scope varchar(255) NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_otp_sends_scope_sent_at ON otp_sends(scope, sent_at);
+
+-- Rate limit counters on the public routes, one row per key (group, kind and
+-- value, e.g. "otp:phone:04141234567") and fixed window.
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    key varchar(255) NOT NULL,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    count int4 NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_rate_limit_counters_key_window ON rate_limit_counters(key, window_start);
+CREATE INDEX idx_rate_limit_counters_expires_at ON rate_limit_counters(expires_at);
+
+-- Webhook deliveries, processed by the workers in services/webhook_queue.go.
+-- One row per (topic, order_id): Shopify's redeliveries don't add jobs.
+CREATE TABLE IF NOT EXISTS webhook_jobs (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    topic varchar(64) NOT NULL,
+    order_id varchar(255) NOT NULL,
+    status varchar(16) NOT NULL,
+    attempts int4 NOT NULL DEFAULT 0,
+    last_error text,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX idx_webhook_jobs_topic_order_id ON webhook_jobs(topic, order_id);
+CREATE INDEX idx_webhook_jobs_status_run_at ON webhook_jobs(status, run_at);
+
+-- Recurrent retry policy: when the next retry is due (NULL: at the next run),
+-- the last decline, and when and why the retries were given up on.
+ALTER TABLE r4_appa_recurrent_pending_payments ADD COLUMN IF NOT EXISTS last_code varchar(10);
+ALTER TABLE r4_appa_recurrent_pending_payments ADD COLUMN IF NOT EXISTS next_retry_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE r4_appa_recurrent_pending_payments ADD COLUMN IF NOT EXISTS gave_up_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE r4_appa_recurrent_pending_payments ADD COLUMN IF NOT EXISTS give_up_reason varchar(32);
+
+-- Subscriptions billed by this service (services/subscriptions.go). Period
+-- is the charge next_charge_at is for; draft_order_id is that period's draft
+-- until it is charged. locked_until is the scheduler's lease while charging.
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    customer_id varchar(255) NOT NULL,
+    line_items jsonb NOT NULL,
+    interval_unit varchar(8) NOT NULL,
+    interval_count int4 NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    period int4 NOT NULL DEFAULT 0,
+    next_charge_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status varchar(16) NOT NULL,
+    pause_reason varchar(32),
+    draft_order_id varchar(255),
+    draft_order_name varchar(255),
+    attempts int4 NOT NULL DEFAULT 0,
+    last_code varchar(10),
+    first_declined_at TIMESTAMP WITH TIME ZONE,
+    last_order_id varchar(255),
+    last_order_name varchar(255),
+    last_charged_at TIMESTAMP WITH TIME ZONE,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    paused_at TIMESTAMP WITH TIME ZONE,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_subscriptions_status_next_charge_at ON subscriptions(status, next_charge_at);
+CREATE INDEX idx_subscriptions_customer_id ON subscriptions(customer_id);
+
+-- Domiciliación affiliations (services/affiliations.go), the history behind
+-- each customer's direct_debit_account metafield. At most one requested or
+-- active row per customer, their current affiliation.
+CREATE TABLE IF NOT EXISTS affiliations (
+    id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+    customer_id varchar(255) NOT NULL,
+    status varchar(16) NOT NULL,
+    account_masked varchar(32) NOT NULL,
+    bank varchar(4) NOT NULL,
+    dni varchar(20) NOT NULL,
+    last_code varchar(10),
+    order_id varchar(255),
+    requested_at TIMESTAMP WITH TIME ZONE,
+    activated_at TIMESTAMP WITH TIME ZONE,
+    refused_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_affiliations_current ON affiliations(customer_id) WHERE status IN ('requested', 'active');
+CREATE INDEX idx_affiliations_customer_id ON affiliations(customer_id);
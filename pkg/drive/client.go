@@ -1,10 +1,10 @@
 package drive
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"mime/multipart"
 	"strings"
 
 	"github.com/google/uuid"
@@ -12,12 +12,13 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
 // Client defines the methods for interacting with Google Drive.
 type Client interface {
-	UploadFile(ctx context.Context, fileHeader *multipart.FileHeader) (string, error)
+	UploadFile(ctx context.Context, name, mimeType string, data []byte) (string, error)
 	DeleteFile(ctx context.Context, fileID string) error
 }
 
@@ -66,37 +67,26 @@ func generateUUID() string {
 	return uuid.New().String()
 }
 
-// UploadFile uploads a file to Google Drive.
+// UploadFile uploads a file to Google Drive. mimeType is stored as given, so
+// callers pass one they established themselves (see pkg/receipt), never the
+// client's Content-Type header.
 func (c *client) UploadFile(
 	ctx context.Context,
-	fileHeader *multipart.FileHeader,
+	name, mimeType string,
+	data []byte,
 ) (string, error) {
-	// 1. Open the file from the multipart.FileHeader
-	file, err := fileHeader.Open()
-	if err != nil {
-		c.logger.Error(err.Error(), zap.Any("fileHeader", fileHeader))
-		return "", err
-	}
-	defer file.Close()
-
-	// 2. get mime type
-	mimeType := fileHeader.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
-	}
-
-	// 3. Create the Google Drive file metadata
+	// 1. Create the Google Drive file metadata
 	driveFile := &drive.File{
-		Name:     fmt.Sprintf("%s_%s", generateUUID(), fileHeader.Filename),
+		Name:     fmt.Sprintf("%s_%s", generateUUID(), name),
 		MimeType: mimeType,
 		Parents:  []string{c.folderID},
 	}
 
-	// 4. Upload the file to Google Drive
+	// 2. Upload the file to Google Drive
 	res, err := c.service.Files.
 		Create(driveFile).
 		Context(ctx).
-		Media(file).
+		Media(bytes.NewReader(data), googleapi.ContentType(mimeType)).
 		SupportsAllDrives(true).
 		Do()
 	if err != nil {
@@ -109,7 +99,7 @@ func (c *client) UploadFile(
 		return "", err
 	}
 
-	// 5. Public access
+	// 3. Public access
 	permission := &drive.Permission{
 		Type: "anyone",
 		Role: "reader",
@@ -19,3 +19,28 @@ type SupportAlertRequest struct {
 	OrderName string
 	Message   string
 }
+
+// SupportEmailRequest is a free-form notice to the support address, for
+// reports that are not about a single order's discount.
+type SupportEmailRequest struct {
+	Subject string
+	Body    string
+}
+
+// PaymentRejectedEmailRequest tells a buyer the receipt they submitted for an
+// order was not accepted.
+type PaymentRejectedEmailRequest struct {
+	To        string
+	UserName  string
+	OrderName string
+	Reason    string
+}
+
+// RecurrentChargeFailedEmailRequest tells a buyer the recurring charge of an
+// order won't be tried again.
+type RecurrentChargeFailedEmailRequest struct {
+	To        string
+	UserName  string
+	OrderName string
+	Reason    string
+}
@@ -21,6 +21,9 @@ type Repository interface {
 	SendEmail(ctx context.Context, req SendEmailRequest) error
 	SendOTPEmail(ctx context.Context, req OTPEmailRequest) error
 	SendSupportAlert(ctx context.Context, req SupportAlertRequest) error
+	SendSupportEmail(ctx context.Context, req SupportEmailRequest) error
+	SendPaymentRejectedEmail(ctx context.Context, req PaymentRejectedEmailRequest) error
+	SendRecurrentChargeFailedEmail(ctx context.Context, req RecurrentChargeFailedEmailRequest) error
 }
 
 type repository struct {
@@ -100,6 +103,46 @@ func (r *repository) SendSupportAlert(ctx context.Context, req SupportAlertReque
 	})
 }
 
+// SendSupportEmail sends a plain-text notice to the support address.
+func (r *repository) SendSupportEmail(ctx context.Context, req SupportEmailRequest) error {
+	return r.SendEmail(ctx, SendEmailRequest{
+		To:      r.supportEmail,
+		Subject: req.Subject,
+		Body:    req.Body,
+	})
+}
+
+// SendPaymentRejectedEmail tells the buyer why their receipt was rejected.
+func (r *repository) SendPaymentRejectedEmail(ctx context.Context, req PaymentRejectedEmailRequest) error {
+	body := fmt.Sprintf(
+		"<p>Hola %s,</p><p>No pudimos validar el pago que enviaste para tu pedido <strong>%s</strong>.</p><p>Motivo: %s</p><p>Si crees que se trata de un error, responde a este correo o contacta a soporte.</p>",
+		template.HTMLEscapeString(req.UserName),
+		template.HTMLEscapeString(req.OrderName),
+		template.HTMLEscapeString(req.Reason),
+	)
+	return r.SendEmail(ctx, SendEmailRequest{
+		To:      req.To,
+		Subject: fmt.Sprintf("Tu pago del pedido %s no fue aprobado — Appa", req.OrderName),
+		Body:    body,
+	})
+}
+
+// SendRecurrentChargeFailedEmail tells the buyer their recurring charge was
+// given up on, and why.
+func (r *repository) SendRecurrentChargeFailedEmail(ctx context.Context, req RecurrentChargeFailedEmailRequest) error {
+	body := fmt.Sprintf(
+		"<p>Hola %s,</p><p>No pudimos cobrar por domiciliación tu pedido <strong>%s</strong> y no volveremos a intentarlo.</p><p>Motivo: %s</p><p>Puedes pagarlo con otro método desde tu cuenta, o responder a este correo si necesitas ayuda.</p>",
+		template.HTMLEscapeString(req.UserName),
+		template.HTMLEscapeString(req.OrderName),
+		template.HTMLEscapeString(req.Reason),
+	)
+	return r.SendEmail(ctx, SendEmailRequest{
+		To:      req.To,
+		Subject: fmt.Sprintf("No pudimos cobrar tu pedido %s — Appa", req.OrderName),
+		Body:    body,
+	})
+}
+
 func (r *repository) setEmailVariables(message *mailgun.PlainMessage, vars map[string]any) error {
 	for key, value := range vars {
 		message.AddVariable(key, value)
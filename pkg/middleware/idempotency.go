@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	"appa_payments/pkg/db/models"
+)
+
+// IdempotentReplayedHeader is set on a response replayed from an earlier
+// request with the same key.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength matches the column.
+const maxIdempotencyKeyLength = 255
+
+// idempotencyFinalKey marks a response stored even though it is a 5xx.
+const idempotencyFinalKey = "idempotencyFinal"
+
+// claimIdempotencyKeyQuery takes (key, route) for a new request: a fresh
+// insert, or a row whose expiry has passed — a finished one past its TTL, or
+// one left in progress by a crashed request.
+const claimIdempotencyKeyQuery = `
+INSERT INTO idempotency_keys (key, route, fingerprint, status, expires_at)
+VALUES (@key, @route, @fingerprint, @status, @expiresAt)
+ON CONFLICT (key, route) DO UPDATE SET
+    fingerprint = EXCLUDED.fingerprint,
+    status = EXCLUDED.status,
+    response_status = NULL,
+    response_body = NULL,
+    content_type = NULL,
+    created_at = CURRENT_TIMESTAMP,
+    completed_at = NULL,
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at < CURRENT_TIMESTAMP`
+
+type idempotency struct {
+	db          *gorm.DB
+	lockTimeout time.Duration
+	ttl         time.Duration
+	logger      *zap.Logger
+}
+
+// NewIdempotency stores keys in Postgres. A request holds its key for at most
+// lockTimeout; its response is replayed for ttl after it finishes.
+func NewIdempotency(db *gorm.DB, lockTimeout, ttl time.Duration, logger *zap.Logger) domains.Idempotency {
+	return &idempotency{db: db, lockTimeout: lockTimeout, ttl: ttl, logger: logger}
+}
+
+// Handler runs a request carrying an Idempotency-Key once per route. A repeat
+// with the same body replays the stored response, or answers 409 while the
+// first is still running; the same key with a different body answers 422. A
+// 5xx isn't stored, so its repeat runs again, unless the handler called
+// KeepIdempotencyKey. Requests without the header pass through untouched.
+func (i *idempotency) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(domains.IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abort(c, http.StatusBadRequest, "idempotency_key_invalid")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abort(c, http.StatusBadRequest, "invalid_body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		route := c.FullPath()
+		fingerprint := requestFingerprint(c, body)
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		result := i.db.WithContext(ctx).Exec(claimIdempotencyKeyQuery, map[string]any{
+			"key":         key,
+			"route":       route,
+			"fingerprint": fingerprint,
+			"status":      domains.IdempotencyStatusInProgress,
+			"expiresAt":   time.Now().Add(i.lockTimeout),
+		})
+		if result.Error != nil {
+			i.logger.Error("idempotency: failed to claim key", zap.Error(result.Error), zap.String("route", route))
+			abort(c, http.StatusInternalServerError, "idempotency_unavailable")
+			return
+		}
+		if result.RowsAffected == 0 {
+			i.replay(ctx, c, key, route, fingerprint)
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			if r := recover(); r != nil {
+				i.release(ctx, key, route)
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		now := time.Now()
+		status := writer.Status()
+		if releasable(c, status) {
+			i.release(ctx, key, route)
+			return
+		}
+		if err := i.db.WithContext(ctx).
+			Model(&models.IdempotencyKey{}).
+			Where("key = ? AND route = ?", key, route).
+			Updates(map[string]any{
+				"status":          domains.IdempotencyStatusCompleted,
+				"response_status": status,
+				"response_body":   writer.body.Bytes(),
+				"content_type":    writer.Header().Get("Content-Type"),
+				"completed_at":    now,
+				"expires_at":      now.Add(i.ttl),
+			}).Error; err != nil {
+			i.logger.Error("idempotency: failed to store response", zap.Error(err), zap.String("route", route))
+		}
+	}
+}
+
+// replay answers a repeat of a key already claimed.
+func (i *idempotency) replay(ctx context.Context, c *gin.Context, key, route, fingerprint string) {
+	var stored models.IdempotencyKey
+	if err := i.db.WithContext(ctx).
+		Where("key = ? AND route = ?", key, route).
+		Limit(1).
+		Find(&stored).Error; err != nil || stored.ID == 0 {
+		i.logger.Error("idempotency: failed to load key", zap.Error(err), zap.String("route", route))
+		abort(c, http.StatusInternalServerError, "idempotency_unavailable")
+		return
+	}
+
+	switch {
+	case stored.Fingerprint != fingerprint:
+		abort(c, http.StatusUnprocessableEntity, "idempotency_key_reused")
+	case stored.Status != domains.IdempotencyStatusCompleted || stored.ResponseStatus == nil:
+		abort(c, http.StatusConflict, "request_in_progress")
+	default:
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(*stored.ResponseStatus, stored.ContentType, stored.ResponseBody)
+		c.Abort()
+	}
+}
+
+// release drops the claim of a request that panicked or answered 5xx, so the
+// client can try again rather than get the failure replayed. A response that
+// couldn't be stored keeps its claim until the lock timeout instead: the
+// charge may well have gone through.
+func (i *idempotency) release(ctx context.Context, key, route string) {
+	if err := i.db.WithContext(ctx).
+		Where("key = ? AND route = ? AND status = ?", key, route, domains.IdempotencyStatusInProgress).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		i.logger.Error("idempotency: failed to release key", zap.Error(err), zap.String("route", route))
+	}
+}
+
+// KeepIdempotencyKey has the response stored and replayed even if it is a
+// 5xx. Handlers call it when the request may have moved money, such as a
+// charge whose R4 call failed without an answer: running it again could
+// charge twice.
+func KeepIdempotencyKey(c *gin.Context) {
+	c.Set(idempotencyFinalKey, true)
+}
+
+// releasable reports whether a finished request gives its key back.
+func releasable(c *gin.Context, status int) bool {
+	return status >= http.StatusInternalServerError && !c.GetBool(idempotencyFinalKey)
+}
+
+func (i *idempotency) PurgeExpired(ctx context.Context) {
+	result := i.db.WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		i.logger.Error("idempotency: failed to purge expired keys", zap.Error(result.Error))
+		return
+	}
+	i.logger.Info("idempotency: purged expired keys", zap.Int64("count", result.RowsAffected))
+}
+
+// requestFingerprint hashes what makes two requests the same: the body and,
+// on cart routes, the cart and amount from the quote. The quote's expiry and
+// signature are left out, so a re-signed quote for the same amount still
+// matches.
+func requestFingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + " " + c.FullPath() + "\n"))
+	h.Write([]byte(c.GetHeader("X-Cart-Id") + "\n" + c.GetHeader("X-Cart-Amount") + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// capturingWriter keeps a copy of the response body for replay.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReleasable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name   string
+		status int
+		keep   bool
+		want   bool
+	}{
+		{"success is stored", http.StatusOK, false, false},
+		{"client error is stored", http.StatusConflict, false, false},
+		{"server error is released", http.StatusInternalServerError, false, true},
+		{"bad gateway is released", http.StatusBadGateway, false, true},
+		{"unknown charge outcome is stored", http.StatusInternalServerError, true, false},
+		{"kept success is stored", http.StatusOK, true, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tc.keep {
+				KeepIdempotencyKey(c)
+			}
+			if got := releasable(c, tc.status); got != tc.want {
+				t.Fatalf("releasable(%d, keep=%v) = %v, want %v", tc.status, tc.keep, got, tc.want)
+			}
+		})
+	}
+}
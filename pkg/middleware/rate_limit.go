@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"appa_payments/internal/domains"
+)
+
+type rateLimiter struct {
+	store  domains.RateLimitStore
+	limits domains.RateLimits
+	logger *zap.Logger
+}
+
+// NewRateLimiter counts requests in store against limits per route group.
+func NewRateLimiter(store domains.RateLimitStore, limits domains.RateLimits, logger *zap.Logger) domains.RateLimiter {
+	return &rateLimiter{store: store, limits: limits, logger: logger}
+}
+
+// Handler answers 429 with Retry-After once any of the request's keys went
+// over the group's limit in the current window. A key the request doesn't
+// carry (no DNI in the body, say) isn't counted. If the store fails the
+// request goes through: a counter outage mustn't stop payments.
+func (r *rateLimiter) Handler(group string, keys ...domains.RateLimitKey) gin.HandlerFunc {
+	limit, ok := r.limits[group]
+	if !ok || limit.Limit == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		values, err := rateLimitValues(c, keys)
+		if err != nil {
+			abort(c, http.StatusBadRequest, "invalid_body")
+			return
+		}
+
+		now := time.Now()
+		var retryAfter time.Duration
+		for _, key := range keys {
+			value := values[key]
+			if value == "" {
+				continue
+			}
+			counter := fmt.Sprintf("%s:%s:%s", group, key, value)
+			count, resetAt, err := r.store.Hit(context.WithoutCancel(c.Request.Context()), counter, limit.Window, now)
+			if err != nil {
+				r.logger.Error("rate limit: failed to count request", zap.Error(err), zap.String("group", group))
+				continue
+			}
+			if count > limit.Limit {
+				retryAfter = max(retryAfter, resetAt.Sub(now))
+			}
+		}
+
+		if retryAfter > 0 {
+			r.logger.Warn("rate limit: request refused",
+				zap.String("group", group),
+				zap.String("path", c.FullPath()),
+				zap.String("ip", values[domains.RateLimitByIP]))
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			abort(c, http.StatusTooManyRequests, "rate_limited")
+			return
+		}
+		c.Next()
+	}
+}
+
+func (r *rateLimiter) PurgeExpired(ctx context.Context) {
+	r.store.PurgeExpired(ctx)
+}
+
+// rateLimitValues reads each key from the request: the client IP, the order
+// id from the path, the cart id from its header, and DNI, phone and order id
+// from a JSON or form body. The body is put back for the handler.
+func rateLimitValues(c *gin.Context, keys []domains.RateLimitKey) (map[domains.RateLimitKey]string, error) {
+	values := map[domains.RateLimitKey]string{
+		domains.RateLimitByIP:    c.ClientIP(),
+		domains.RateLimitByOrder: c.Param("orderId"),
+	}
+	if cartID := c.GetHeader("X-Cart-Id"); cartID != "" {
+		values[domains.RateLimitByOrder] = cartID
+	}
+
+	needsBody := false
+	for _, key := range keys {
+		needsBody = needsBody || key == domains.RateLimitByDNI || key == domains.RateLimitByPhone ||
+			(key == domains.RateLimitByOrder && values[key] == "")
+	}
+	if !needsBody || c.Request.Body == nil {
+		return values, nil
+	}
+
+	field := func(string) string { return "" }
+	switch c.ContentType() {
+	case gin.MIMEJSON:
+		raw, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+		body := map[string]any{}
+		// A body that isn't a JSON object is left for the handler to refuse.
+		_ = json.Unmarshal(raw, &body)
+		field = func(name string) string {
+			if v, ok := body[name]; ok && v != nil {
+				return fmt.Sprint(v)
+			}
+			return ""
+		}
+	case gin.MIMEMultipartPOSTForm, gin.MIMEPOSTForm:
+		field = c.PostForm
+	}
+
+	if dni := strings.TrimSpace(field("dni")); dni != "" {
+		values[domains.RateLimitByDNI] = strings.ToUpper(strings.TrimSpace(field("dniType")) + dni)
+	}
+	values[domains.RateLimitByPhone] = digitsOnly(field("phone"))
+	if values[domains.RateLimitByOrder] == "" {
+		values[domains.RateLimitByOrder] = strings.TrimSpace(field("orderId"))
+	}
+	return values, nil
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
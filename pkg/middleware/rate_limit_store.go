@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"appa_payments/internal/domains"
+	"appa_payments/pkg/db/models"
+)
+
+// hitRateLimitQuery counts one request in (key, window_start) and returns
+// the total.
+const hitRateLimitQuery = `
+INSERT INTO rate_limit_counters (key, window_start, count, expires_at)
+VALUES (@key, @windowStart, 1, @expiresAt)
+ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limit_counters.count + 1
+RETURNING count`
+
+type postgresRateLimitStore struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewPostgresRateLimitStore keeps counters in Postgres, shared by every
+// instance.
+func NewPostgresRateLimitStore(db *gorm.DB, logger *zap.Logger) domains.RateLimitStore {
+	return &postgresRateLimitStore{db: db, logger: logger}
+}
+
+func (s *postgresRateLimitStore) Hit(ctx context.Context, key string, window time.Duration, now time.Time) (int, time.Time, error) {
+	start := now.Truncate(window)
+	resetAt := start.Add(window)
+	var count int
+	err := s.db.WithContext(ctx).Raw(hitRateLimitQuery, map[string]any{
+		"key":         key,
+		"windowStart": start,
+		"expiresAt":   resetAt,
+	}).Scan(&count).Error
+	return count, resetAt, err
+}
+
+func (s *postgresRateLimitStore) PurgeExpired(ctx context.Context) {
+	result := s.db.WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.RateLimitCounter{})
+	if result.Error != nil {
+		s.logger.Error("rate limit: failed to purge expired counters", zap.Error(result.Error))
+		return
+	}
+	s.logger.Info("rate limit: purged expired counters", zap.Int64("count", result.RowsAffected))
+}
+
+type memoryCounter struct {
+	count   int
+	resetAt time.Time
+}
+
+// memoryRateLimitStore counts per instance: with N instances a client gets
+// up to N times the limit.
+type memoryRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+}
+
+// NewMemoryRateLimitStore keeps counters in process, for a single instance
+// or local runs.
+func NewMemoryRateLimitStore() domains.RateLimitStore {
+	return &memoryRateLimitStore{counters: make(map[string]memoryCounter)}
+}
+
+func (s *memoryRateLimitStore) Hit(_ context.Context, key string, window time.Duration, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resetAt := now.Truncate(window).Add(window)
+	counter := s.counters[key]
+	if !counter.resetAt.Equal(resetAt) {
+		counter = memoryCounter{resetAt: resetAt}
+	}
+	counter.count++
+	s.counters[key] = counter
+	return counter.count, resetAt, nil
+}
+
+func (s *memoryRateLimitStore) PurgeExpired(context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, counter := range s.counters {
+		if now.After(counter.resetAt) {
+			delete(s.counters, key)
+		}
+	}
+}
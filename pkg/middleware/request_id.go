@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+
+	"appa_payments/pkg/requestctx"
+)
+
+// RequestIDHeader carries the request id in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds a caller-supplied id; longer ones are replaced.
+const maxRequestIDLength = 64
+
+// RequestID tags every request with an id — the caller's X-Request-ID when it
+// sends a sane one, a random one otherwise — echoes it back in the response
+// and puts it in the request context for the audit log.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(requestctx.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// validRequestID accepts ids of 1 to maxRequestIDLength letters, digits,
+// '-' and '_': nothing that can forge a log line or smuggle markup into the
+// audit log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,6 +25,22 @@ var endpointTimeouts = map[string]time.Duration{
 	r4DirectDebitAccountEndpoint: 150 * time.Second,
 }
 
+// APIError is R4 answering with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// Declined reports whether err is R4 refusing the request outright (a 4xx),
+// so nothing was done. Any other error, a timeout or a 5xx, leaves the
+// outcome unknown.
+func Declined(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500
+}
+
 type RestClient struct {
 	baseURL string
 	client  *http.Client
@@ -105,10 +122,10 @@ func (r *RestClient) Do(
 	data, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		if endpoint == r4ValidateImmediateEndpoint {
-			return nil, fmt.Errorf("%s", string(data))
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: string(data)}
 		}
 		r.logger.Error("R4 API error: ", zap.String("body", string(data)), zap.Any("payload", payload))
-		return nil, fmt.Errorf("R4 API error: %s", string(data))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: "R4 API error: " + string(data)}
 	}
 
 	return data, nil
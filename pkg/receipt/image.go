@@ -0,0 +1,181 @@
+package receipt
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+)
+
+// downscale shrinks img so its longest side is at most maxSide, averaging
+// each source block (box filter). Smaller images are returned untouched.
+func downscale(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+
+	nw, nh := maxSide, h*maxSide/w
+	if h > w {
+		nw, nh = w*maxSide/h, maxSide
+	}
+	return resize(img, max(nw, 1), max(nh, 1))
+}
+
+// resize scales img to exactly nw×nh by averaging the source pixels that
+// fall into each destination pixel.
+func resize(img image.Image, nw, nh int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+
+	for y := range nh {
+		y0 := b.Min.Y + y*h/nh
+		y1 := max(b.Min.Y+(y+1)*h/nh, y0+1)
+		for x := range nw {
+			x0 := b.Min.X + x*w/nw
+			x1 := max(b.Min.X+(x+1)*w/nw, x0+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// dHash is a difference hash: the image shrunk to 9×8 grayscale, one bit per
+// pixel set when it is brighter than its right-hand neighbour. Re-encoding,
+// resizing or a light crop change few bits; a different receipt changes ~half.
+func dHash(img image.Image) uint64 {
+	small := resize(img, 9, 8)
+
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			left := color.GrayModel.Convert(small.At(x, y)).(color.Gray).Y
+			right := color.GrayModel.Convert(small.At(x+1, y)).(color.Gray).Y
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+const exifOrientationTag = 0x0112
+
+// exifOrientation returns the EXIF orientation (1–8) stored in a JPEG's APP1
+// segment, or 1 when there is none or it can't be parsed.
+func exifOrientation(raw []byte) int {
+	if len(raw) < 4 || raw[0] != 0xFF || raw[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(raw); {
+		if raw[i] != 0xFF {
+			return 1
+		}
+		marker := raw[i+1]
+		if marker == 0xDA { // start of scan: no metadata past here
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(raw[i+2:]))
+		if size < 2 || i+2+size > len(raw) {
+			return 1
+		}
+		segment := raw[i+4 : i+2+size]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := range entries {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates/mirrors img so it displays upright without the
+// EXIF orientation tag.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,194 @@
+package receipt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MaxFileBytes caps an uploaded receipt. Phone photos are 3–6 MB; anything
+	// past this is not a receipt.
+	MaxFileBytes = 10 << 20
+
+	// maxDimension is the longest side a stored photo keeps. Enough to read a
+	// bank reference, a fraction of what a phone camera produces.
+	maxDimension = 1600
+
+	// maxPixels caps an image's width × height, read from its header before
+	// it is decoded: a few MB of PNG can otherwise expand to gigabytes. A
+	// 48 MP phone photo fits.
+	maxPixels = 50_000_000
+
+	jpegQuality = 85
+)
+
+const (
+	MimeJPEG = "image/jpeg"
+	MimePNG  = "image/png"
+	MimePDF  = "application/pdf"
+)
+
+// allowedTypes is keyed by the sniffed type, never the client's Content-Type.
+var allowedTypes = map[string]string{
+	MimeJPEG: ".jpg",
+	MimePNG:  ".png",
+	MimePDF:  ".pdf",
+}
+
+var (
+	ErrEmpty           = errors.New("el comprobante está vacío")
+	ErrTooLarge        = fmt.Errorf("el comprobante supera el tamaño máximo de %d MB", MaxFileBytes>>20)
+	ErrUnsupportedType = errors.New("el comprobante debe ser una imagen JPG/PNG o un PDF")
+	ErrUnreadable      = errors.New("no se pudo leer el comprobante")
+	ErrTooManyPixels   = errors.New("el comprobante tiene una resolución demasiado alta")
+)
+
+// File is a receipt after server-side validation: the bytes that get stored,
+// the type they were sniffed as, and the hashes used to spot the same receipt
+// submitted for more than one order.
+type File struct {
+	Name     string
+	MimeType string
+	Data     []byte
+	// SHA256 is the hex digest of Data, so it matches byte-identical re-uploads.
+	SHA256 string
+	// PHash is the perceptual hash of an image, matching the same photo after
+	// a re-save, resize or screenshot. Nil for a PDF.
+	PHash *int64
+}
+
+// Normalize reads an uploaded receipt and returns what should be stored.
+// The type is sniffed from the content; images are decoded and re-encoded,
+// which drops EXIF (location, device) and any other metadata, and photos
+// larger than maxDimension are downscaled. PDFs are stored as received.
+func Normalize(fileHeader *multipart.FileHeader) (*File, error) {
+	if fileHeader == nil || fileHeader.Size == 0 {
+		return nil, ErrEmpty
+	}
+	if fileHeader.Size > MaxFileBytes {
+		return nil, ErrTooLarge
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	defer f.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(f, MaxFileBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+
+	return NormalizeBytes(fileHeader.Filename, raw)
+}
+
+// NormalizeBytes is Normalize over an in-memory file.
+func NormalizeBytes(filename string, raw []byte) (*File, error) {
+	if len(raw) == 0 {
+		return nil, ErrEmpty
+	}
+	if len(raw) > MaxFileBytes {
+		return nil, ErrTooLarge
+	}
+
+	mimeType := sniff(raw)
+	ext, ok := allowedTypes[mimeType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	out := &File{MimeType: mimeType}
+	switch mimeType {
+	case MimePDF:
+		out.Data = raw
+	default:
+		cfg, err := decodeConfig(raw, mimeType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+		}
+		if cfg.Width*cfg.Height > maxPixels {
+			return nil, ErrTooManyPixels
+		}
+
+		img, err := decode(raw, mimeType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+		}
+		img = downscale(img, maxDimension)
+
+		hash := int64(dHash(img))
+		out.PHash = &hash
+
+		var buf bytes.Buffer
+		if mimeType == MimePNG {
+			err = png.Encode(&buf, img)
+		} else {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+		}
+		out.Data = buf.Bytes()
+	}
+
+	sum := sha256.Sum256(out.Data)
+	out.SHA256 = hex.EncodeToString(sum[:])
+	out.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)) + ext
+
+	return out, nil
+}
+
+// sniff returns the content type of raw, looking only at its bytes.
+func sniff(raw []byte) string {
+	mimeType := http.DetectContentType(raw)
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType
+}
+
+// decodeConfig reads a JPEG's or PNG's dimensions from its header, without
+// decoding the pixels.
+func decodeConfig(raw []byte, mimeType string) (image.Config, error) {
+	if mimeType == MimePNG {
+		return png.DecodeConfig(bytes.NewReader(raw))
+	}
+	return jpeg.DecodeConfig(bytes.NewReader(raw))
+}
+
+// decode decodes a JPEG or PNG. A JPEG's EXIF orientation is applied to the
+// pixels first, since re-encoding drops the tag that told viewers to rotate.
+func decode(raw []byte, mimeType string) (image.Image, error) {
+	if mimeType == MimePNG {
+		return png.Decode(bytes.NewReader(raw))
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return applyOrientation(img, exifOrientation(raw)), nil
+}
+
+// HammingDistance counts the bits that differ between two perceptual hashes.
+func HammingDistance(a, b int64) int {
+	x := uint64(a ^ b)
+	n := 0
+	for x != 0 {
+		x &= x - 1
+		n++
+	}
+	return n
+}
@@ -0,0 +1,133 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gradient draws a picture with enough structure for dHash to be meaningful.
+func gradient(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			v := uint8((x*255/w + y*64/h) % 256)
+			if flip {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNormalizeBytesRejectsByContent(t *testing.T) {
+	// A text file named like an image is refused on what it contains.
+	_, err := NormalizeBytes("recibo.jpg", []byte("esto no es una imagen"))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("err = %v, want ErrUnsupportedType", err)
+	}
+}
+
+func TestNormalizeBytesRejectsTooManyPixels(t *testing.T) {
+	// A tiny PNG whose header claims 20000×20000: refused before the pixels
+	// are decoded.
+	raw := encodePNG(t, gradient(4, 4, false))
+	ihdr := raw[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:], 20000)
+	binary.BigEndian.PutUint32(ihdr[4:], 20000)
+	binary.BigEndian.PutUint32(raw[8+8+13:], crc32.ChecksumIEEE(raw[8+4:8+8+13]))
+
+	_, err := NormalizeBytes("recibo.png", raw)
+	if !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("err = %v, want ErrTooManyPixels", err)
+	}
+}
+
+func TestNormalizeBytesPDF(t *testing.T) {
+	raw := []byte("%PDF-1.4\n%âãÏÓ\n1 0 obj\n<<>>\nendobj\n")
+	file, err := NormalizeBytes("zelle.pdf", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.MimeType != MimePDF || file.PHash != nil || !bytes.Equal(file.Data, raw) {
+		t.Fatalf("unexpected PDF result: %+v", file)
+	}
+}
+
+func TestNormalizeBytesDownscalesAndRenames(t *testing.T) {
+	file, err := NormalizeBytes("foto.jpeg", encodePNG(t, gradient(3200, 1000, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.MimeType != MimePNG || file.Name != "foto.png" {
+		t.Fatalf("got %s %s, want image/png foto.png", file.MimeType, file.Name)
+	}
+
+	img, err := png.Decode(bytes.NewReader(file.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != maxDimension || b.Dy() != 500 {
+		t.Fatalf("bounds = %v, want %dx500", b, maxDimension)
+	}
+}
+
+func TestPHashMatchesReencodedPhoto(t *testing.T) {
+	original, err := NormalizeBytes("a.png", encodePNG(t, gradient(800, 600, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gradient(400, 300, false), &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	resaved, err := NormalizeBytes("b.jpg", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NormalizeBytes("c.png", encodePNG(t, gradient(800, 600, true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if original.SHA256 == resaved.SHA256 {
+		t.Fatal("different encodings should not share a SHA-256")
+	}
+	if d := HammingDistance(*original.PHash, *resaved.PHash); d > 6 {
+		t.Fatalf("re-encoded photo distance = %d, want <= 6", d)
+	}
+	if d := HammingDistance(*original.PHash, *other.PHash); d <= 6 {
+		t.Fatalf("different photo distance = %d, want > 6", d)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	rotated := applyOrientation(img, 6) // 90° clockwise
+	if b := rotated.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+		t.Fatalf("bounds = %v, want 1x2", b)
+	}
+	if r, _, _, _ := rotated.At(0, 0).RGBA(); r == 0 {
+		t.Fatal("top-left pixel should move to the top after a clockwise turn")
+	}
+}
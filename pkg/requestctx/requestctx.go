@@ -0,0 +1,34 @@
+// Package requestctx carries who is behind a request, and which request it
+// is, through a context.Context down to the services that record it.
+package requestctx
+
+import "context"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	actorKey
+)
+
+// WithRequestID returns a copy of ctx carrying the request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id in ctx, or "" outside an HTTP request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithActor returns a copy of ctx carrying the authenticated caller's name.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor returns the authenticated caller in ctx, or "" when there is none.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
@@ -27,12 +27,13 @@ type gqlResponse struct {
 
 // enum shopify kind
 const (
-	OrderKind        = "Order"
-	CustomerKind     = "Customer"
-	draftOrderKind   = "DraftOrder"
-	CustomerKindID   = "gid://shopify/Customer/"
-	OrderKindID      = "gid://shopify/Order/"
-	DraftOrderKindID = "gid://shopify/DraftOrder/"
+	OrderKind          = "Order"
+	CustomerKind       = "Customer"
+	draftOrderKind     = "DraftOrder"
+	productVariantKind = "ProductVariant"
+	CustomerKindID     = "gid://shopify/Customer/"
+	OrderKindID        = "gid://shopify/Order/"
+	DraftOrderKindID   = "gid://shopify/DraftOrder/"
 )
 
 // GetOrderByIDResponse constructs a global ID for Shopify entities
@@ -205,6 +206,22 @@ type DebitDirectAccountJson struct {
 	DNI     string `json:"dni"`
 }
 
+// OrderIGTFJson is the custom.igtf order metafield: the tax paid on top of
+// the order total for a foreign-currency payment, in USD.
+type OrderIGTFJson struct {
+	PaymentMethod string  `json:"payment_method"`
+	Rate          float64 `json:"rate"`
+	BaseAmount    float64 `json:"base_amount"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+}
+
+type SetMetafieldsResponse struct {
+	MetafieldsSet struct {
+		UserErrors []UserErrors `json:"userErrors"`
+	} `json:"metafieldsSet"`
+}
+
 type AddOrderTagsResponse struct {
 	TagsAdd struct {
 		UserErrors []UserErrors `json:"userErrors"`
@@ -273,6 +290,29 @@ type GetDraftOrderByIDResponse struct {
 	DraftOrder *DraftOrder `json:"draftOrder"`
 }
 
+// DraftOrderInput is what CreateDraftOrder builds a draft from. Ids may be
+// numeric or full GIDs.
+type DraftOrderInput struct {
+	CustomerID string
+	LineItems  []DraftOrderLineItem
+	Tags       []string
+	Note       string
+}
+
+// DraftOrderLineItem is a product variant and how many of it.
+type DraftOrderLineItem struct {
+	VariantID string
+	Quantity  int
+}
+
+// CreateDraftOrderResponse is the GraphQL response wrapper for draftOrderCreate
+type CreateDraftOrderResponse struct {
+	DraftOrderCreate struct {
+		DraftOrder *DraftOrder  `json:"draftOrder"`
+		UserErrors []UserErrors `json:"userErrors"`
+	} `json:"draftOrderCreate"`
+}
+
 // CompletedOrderNode is the minimal shape draftOrderComplete returns for the
 // order it just created.
 type CompletedOrderNode struct {
@@ -293,3 +333,26 @@ type CompleteDraftOrderResponse struct {
 		UserErrors []UserErrors `json:"userErrors"`
 	} `json:"draftOrderComplete"`
 }
+
+// OrderStatus is the slice of an order reconciliation needs.
+type OrderStatus struct {
+	ID                     string  `json:"id"`
+	LegacyResourceID       string  `json:"legacyResourceId"`
+	Name                   string  `json:"name"`
+	DisplayFinancialStatus string  `json:"displayFinancialStatus"`
+	CancelledAt            *string `json:"cancelledAt"`
+}
+
+type GetOrdersStatusResponse struct {
+	Nodes []*OrderStatus `json:"nodes"`
+}
+
+type ListOrdersStatusResponse struct {
+	Orders struct {
+		Nodes    []OrderStatus `json:"nodes"`
+		PageInfo struct {
+			HasNextPage bool   `json:"hasNextPage"`
+			EndCursor   string `json:"endCursor"`
+		} `json:"pageInfo"`
+	} `json:"orders"`
+}
@@ -306,6 +306,27 @@ query draftOrderByID($id: ID!) {
   }
 }`
 
+const draftOrderCreate = `
+mutation draftOrderCreate($input: DraftOrderInput!) {
+  draftOrderCreate(input: $input) {
+    draftOrder {
+      id
+      name
+      tags
+      totalPriceSet {
+        shopMoney {
+          amount
+          currencyCode
+        }
+      }
+    }
+    userErrors {
+      field
+      message
+    }
+  }
+}`
+
 const draftOrderComplete = `
 mutation draftOrderComplete($id: ID!, $paymentPending: Boolean!) {
   draftOrderComplete(id: $id, paymentPending: $paymentPending) {
@@ -345,3 +366,51 @@ const deleteMetafield = `mutation MetafieldDelete($id: ID!, $namespace: String!,
     }
   }
 }`
+
+const setMetafield = `mutation MetafieldsSet($id: ID!, $namespace: String!, $key: String!, $type: String!, $value: String!) {
+  metafieldsSet(metafields: [
+    {
+      ownerId: $id
+      namespace: $namespace
+      key: $key
+      type: $type
+      value: $value
+    }
+  ]) {
+    metafields {
+      id
+    }
+    userErrors {
+      field
+      message
+    }
+  }
+}`
+
+const getOrdersStatusQuery = `query ordersStatus($ids: [ID!]!) {
+  nodes(ids: $ids) {
+    ... on Order {
+      id
+      legacyResourceId
+      name
+      displayFinancialStatus
+      cancelledAt
+    }
+  }
+}`
+
+const listOrdersStatusQuery = `query listOrdersStatus($query: String!, $first: Int!, $after: String) {
+  orders(first: $first, after: $after, query: $query) {
+    nodes {
+      id
+      legacyResourceId
+      name
+      displayFinancialStatus
+      cancelledAt
+    }
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+  }
+}`
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -17,6 +19,7 @@ const (
 	customerParentKey             = "parent_id"
 	customerDirectDebitKey        = "direct_debit"
 	customerDirectDebitAccountKey = "direct_debit_account"
+	orderIGTFKey                  = "igtf"
 )
 
 // Repository defines methods to interact with Shopify API
@@ -31,13 +34,20 @@ type Repository interface {
 	SetCustomerDebitDirectAccount(ctx context.Context, customerID string, jsonValue DebitDirectAccountJson) error
 	DeleteCustomerDebitDirectAccount(ctx context.Context, customerID string) error
 	AddOrderTags(ctx context.Context, orderID string, tags []string) error
+	SetOrderIGTF(ctx context.Context, orderID string, jsonValue OrderIGTFJson) error
 	AddThirtyPercentDiscountToOrder(ctx context.Context, orderID string, porcentValue float64, description string) error
 	MarkOrderAsPaid(ctx context.Context, orderID string) error
 	GetDraftOrderByID(ctx context.Context, id string) (*GetDraftOrderByIDResponse, error)
+	CreateDraftOrder(ctx context.Context, input DraftOrderInput) (*DraftOrder, error)
 	AddDraftOrderTags(ctx context.Context, gid string, tags []string) error
 	CompleteDraftOrder(ctx context.Context, draftGID string, paymentPending bool) (*CompletedOrder, error)
+	GetOrdersStatus(ctx context.Context, ids []string) (map[string]OrderStatus, error)
+	ListPaidOrders(ctx context.Context, updatedSince time.Time) ([]OrderStatus, error)
 }
 
+// ordersPageSize is the most ids/orders one Shopify query returns.
+const ordersPageSize = 250
+
 // Repository is a Shopify API repository
 type repository struct {
 	gql    *GraphQLClient
@@ -315,6 +325,36 @@ func (r *repository) AddOrderTags(ctx context.Context, gid string, tags []string
 	return nil
 }
 
+// SetOrderIGTF records the IGTF paid on an order in the custom.igtf metafield
+func (r *repository) SetOrderIGTF(ctx context.Context, gid string, jsonValues OrderIGTFJson) error {
+	jsonValue, err := json.Marshal(jsonValues)
+	if err != nil {
+		return err
+	}
+
+	gid = EnsureGID(OrderKind, gid)
+	vars := map[string]any{
+		"id":        gid,
+		"namespace": customNamespace,
+		"key":       orderIGTFKey,
+		"type":      "json",
+		"value":     string(jsonValue),
+	}
+
+	var resp SetMetafieldsResponse
+	if err := r.gql.Do(ctx, setMetafield, vars, &resp); err != nil {
+		r.Logger.Error(err.Error(), zap.String("orderID", gid), zap.String("igtf", string(jsonValue)))
+		return err
+	}
+
+	if len(resp.MetafieldsSet.UserErrors) > 0 {
+		r.Logger.Error("failed to set order IGTF", zap.Any("errors", resp.MetafieldsSet.UserErrors), zap.String("orderID", gid))
+		return errors.New("failed to set order IGTF")
+	}
+
+	return nil
+}
+
 // BeginOrderEdit begins an order edit and returns the calculated order
 func (r *repository) BeginOrderEdit(ctx context.Context, gid string) (*CalculatedOrder, error) {
 	gid = EnsureGID(OrderKind, gid)
@@ -460,6 +500,42 @@ func (r *repository) GetDraftOrderByID(
 	return &resp, nil
 }
 
+// CreateDraftOrder creates a draft order for input's customer, shipped to
+// their default address, via draftOrderCreate.
+func (r *repository) CreateDraftOrder(ctx context.Context, input DraftOrderInput) (*DraftOrder, error) {
+	lineItems := make([]map[string]any, 0, len(input.LineItems))
+	for _, item := range input.LineItems {
+		lineItems = append(lineItems, map[string]any{
+			"variantId": EnsureGID(productVariantKind, item.VariantID),
+			"quantity":  item.Quantity,
+		})
+	}
+	vars := map[string]any{
+		"input": map[string]any{
+			"purchasingEntity":          map[string]any{"customerId": EnsureGID(CustomerKind, input.CustomerID)},
+			"useCustomerDefaultAddress": true,
+			"lineItems":                 lineItems,
+			"tags":                      input.Tags,
+			"note":                      input.Note,
+		},
+	}
+
+	var resp CreateDraftOrderResponse
+	if err := r.gql.Do(ctx, draftOrderCreate, vars, &resp); err != nil {
+		r.Logger.Error(err.Error(), zap.String("customerID", input.CustomerID))
+		return nil, err
+	}
+	if len(resp.DraftOrderCreate.UserErrors) > 0 {
+		r.Logger.Error("failed to create draft order", zap.Any("errors", resp.DraftOrderCreate.UserErrors))
+		return nil, errors.New("failed to create draft order")
+	}
+	if resp.DraftOrderCreate.DraftOrder == nil {
+		return nil, errors.New("draft order created without a draft order")
+	}
+
+	return resp.DraftOrderCreate.DraftOrder, nil
+}
+
 // AddDraftOrderTags adds tags to a draft order. Accepts either a numeric ID
 // or a full Shopify GID.
 func (r *repository) AddDraftOrderTags(ctx context.Context, gid string, tags []string) error {
@@ -550,3 +626,58 @@ func getOrderFinalPrice(currentPriceStr string, transactions []Transaction) (str
 
 	return fmt.Sprintf("%.2f", currentPrice), nil
 }
+
+// GetOrdersStatus fetches the financial status of many orders at once, by
+// legacy (numeric) id. Ids Shopify doesn't know as orders — deleted orders,
+// draft ids — are absent from the result.
+func (r *repository) GetOrdersStatus(ctx context.Context, ids []string) (map[string]OrderStatus, error) {
+	statuses := make(map[string]OrderStatus, len(ids))
+	for chunk := range slices.Chunk(ids, ordersPageSize) {
+		gids := make([]string, 0, len(chunk))
+		for _, id := range chunk {
+			gids = append(gids, EnsureGID(OrderKind, id))
+		}
+
+		var resp GetOrdersStatusResponse
+		if err := r.gql.Do(ctx, getOrdersStatusQuery, map[string]any{"ids": gids}, &resp); err != nil {
+			r.Logger.Error(err.Error(), zap.Int("ids", len(gids)))
+			return nil, err
+		}
+
+		for _, node := range resp.Nodes {
+			if node == nil || node.LegacyResourceID == "" {
+				continue
+			}
+			statuses[node.LegacyResourceID] = *node
+		}
+	}
+
+	return statuses, nil
+}
+
+// ListPaidOrders lists the orders marked paid through the manual gateway —
+// how this service settles every order it charges — updated since the given
+// time.
+func (r *repository) ListPaidOrders(ctx context.Context, updatedSince time.Time) ([]OrderStatus, error) {
+	query := fmt.Sprintf("financial_status:paid gateway:manual updated_at:>='%s'", updatedSince.UTC().Format(time.RFC3339))
+
+	var (
+		orders []OrderStatus
+		after  *string
+	)
+	for {
+		var resp ListOrdersStatusResponse
+		vars := map[string]any{"query": query, "first": ordersPageSize, "after": after}
+		if err := r.gql.Do(ctx, listOrdersStatusQuery, vars, &resp); err != nil {
+			r.Logger.Error(err.Error(), zap.String("query", query))
+			return nil, err
+		}
+
+		orders = append(orders, resp.Orders.Nodes...)
+		if !resp.Orders.PageInfo.HasNextPage {
+			return orders, nil
+		}
+		cursor := resp.Orders.PageInfo.EndCursor
+		after = &cursor
+	}
+}
@@ -0,0 +1,169 @@
+// Package xlsx writes a single-sheet .xlsx workbook row by row, straight to
+// an io.Writer, so large exports never sit in memory. Strings are written
+// inline; there are no styles, formulas or shared strings.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the MIME type of an .xlsx file.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+var ErrClosed = errors.New("xlsx: writer closed")
+
+const contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+const rootRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const workbookRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+
+const workbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const sheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetFooter = `</sheetData></worksheet>`
+
+// Writer streams rows into the workbook's only sheet. Close must be called to
+// finish the file.
+type Writer struct {
+	zip    *zip.Writer
+	sheet  *bufio.Writer
+	row    int
+	closed bool
+}
+
+// NewWriter writes the workbook's fixed parts to w and opens the sheet named
+// sheetName for rows.
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+
+	var name strings.Builder
+	if err := xml.EscapeText(&name, []byte(sheetName)); err != nil {
+		return nil, err
+	}
+	parts := []struct{ path, body string }{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, name.String())},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(sheetHeader); err != nil {
+		return nil, err
+	}
+
+	return &Writer{zip: zw, sheet: sheet}, nil
+}
+
+// WriteRow appends one row. Integers and floats become numeric cells,
+// time.Time an ISO 8601 string, nil an empty cell and anything else its
+// fmt.Sprint text.
+func (w *Writer) WriteRow(values ...any) error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.row++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.row)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(w.row)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Time:
+			writeInlineString(&b, ref, v.Format(time.RFC3339))
+		default:
+			writeInlineString(&b, ref, fmt.Sprint(v))
+		}
+	}
+	b.WriteString(`</row>`)
+
+	_, err := w.sheet.WriteString(b.String())
+	return err
+}
+
+// Flush pushes buffered rows through to the underlying writer.
+func (w *Writer) Flush() error {
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Flush()
+}
+
+// Close ends the sheet and writes the zip directory. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if _, err := w.sheet.WriteString(sheetFooter); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+func writeInlineString(b *strings.Builder, ref, text string) {
+	fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+	_ = xml.EscapeText(b, []byte(text))
+	b.WriteString(`</t></is></c>`)
+}
+
+// columnName turns a zero-based column index into its letters: 0 → A,
+// 25 → Z, 26 → AA.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
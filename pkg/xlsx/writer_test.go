@@ -0,0 +1,81 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestColumnName(t *testing.T) {
+	cases := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for i, want := range cases {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestWriterProducesWorkbook(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Transacciones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow("fecha", "monto"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow("<a & b>", 12.5, nil, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow("late"); err != ErrClosed {
+		t.Fatalf("WriteRow after Close = %v, want ErrClosed", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(body)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="Transacciones"`) {
+		t.Errorf("workbook doesn't name the sheet: %s", files["xl/workbook.xml"])
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">fecha</t></is></c>`,
+		`<t xml:space="preserve">&lt;a &amp; b&gt;</t>`,
+		`<c r="B2"><v>12.5</v></c>`,
+		`<c r="D2"><v>3</v></c>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet missing %q:\n%s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="C2"`) {
+		t.Errorf("nil value should leave C2 out:\n%s", sheet)
+	}
+}